@@ -2,24 +2,38 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/aras/presto/internal/auth"
 	"github.com/aras/presto/internal/autoload"
+	"github.com/aras/presto/internal/cache"
+	"github.com/aras/presto/internal/config"
 	"github.com/aras/presto/internal/downloader"
 	"github.com/aras/presto/internal/lockfile"
 	"github.com/aras/presto/internal/packagist"
 	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/platform"
 	"github.com/aras/presto/internal/resolver"
 	"github.com/aras/presto/internal/scripts"
 	"github.com/aras/presto/internal/security"
+	"github.com/aras/presto/internal/store"
 	"github.com/spf13/cobra"
 )
 
 var version = "0.1.12"
 var verbose bool
+var offline bool
+
+var (
+	ignorePlatformReqs    []string
+	ignoreAllPlatformReqs bool
+)
 
 func main() {
 	rootCmd := &cobra.Command{
@@ -32,12 +46,13 @@ func main() {
 	rootCmd.SetVersionTemplate("🎵 Presto v{{.Version}}\n")
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Use only the local cache, never the network (same as COMPOSER_DISABLE_NETWORK=1)")
 
 	installCmd := &cobra.Command{
 		Use:   "install",
 		Short: "Install dependencies from composer.json",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runInstall(false)
+			return runInstall(nil)
 		},
 	}
 
@@ -50,13 +65,19 @@ func main() {
 		},
 	}
 
+	var updateOpts resolver.UpdateOptions
 	updateCmd := &cobra.Command{
 		Use:   "update [packages...]",
 		Short: "Update dependencies to latest versions",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runUpdate(args)
+			updateOpts.Packages = args
+			return runUpdate(updateOpts)
 		},
 	}
+	updateCmd.Flags().BoolVarP(&updateOpts.WithDependencies, "with-dependencies", "w", false, "Also update dependencies of the listed packages, except root requirements")
+	updateCmd.Flags().BoolVarP(&updateOpts.WithAllDependencies, "with-all-dependencies", "W", false, "Also update dependencies of the listed packages, including root requirements")
+	updateCmd.Flags().BoolVar(&updateOpts.PreferStable, "prefer-stable", false, "Prefer stable versions of dependencies")
+	updateCmd.Flags().BoolVar(&updateOpts.PreferLowest, "prefer-lowest", false, "Prefer lowest versions of dependencies, to test lower bounds")
 
 	removeCmd := &cobra.Command{
 		Use:   "remove [packages...]",
@@ -109,6 +130,11 @@ func main() {
 		},
 	}
 
+	for _, cmd := range []*cobra.Command{installCmd, updateCmd, requireCmd} {
+		cmd.Flags().StringArrayVar(&ignorePlatformReqs, "ignore-platform-req", nil, "Ignore a platform requirement (php, ext-*, lib-*); wildcards are allowed")
+		cmd.Flags().BoolVar(&ignoreAllPlatformReqs, "ignore-platform-reqs", false, "Ignore all platform requirements")
+	}
+
 	var strictValidate bool
 	validateCmd := &cobra.Command{
 		Use:   "validate",
@@ -128,6 +154,17 @@ func main() {
 		},
 	}
 
+	var checkLock, checkNoDev bool
+	checkPlatformCmd := &cobra.Command{
+		Use:   "check-platform-reqs",
+		Short: "Check that the PHP runtime satisfies the platform requirements",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCheckPlatformReqs(checkLock, checkNoDev)
+		},
+	}
+	checkPlatformCmd.Flags().BoolVar(&checkLock, "lock", false, "Check every package in composer.lock, not only those installed in vendor")
+	checkPlatformCmd.Flags().BoolVar(&checkNoDev, "no-dev", false, "Skip require-dev packages and requirements")
+
 	cacheCmd := &cobra.Command{
 		Use:   "cache",
 		Short: "Manage package cache",
@@ -141,7 +178,73 @@ func main() {
 		},
 	}
 
-	cacheCmd.AddCommand(cacheClearCmd)
+	cacheListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List cached files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheList()
+		},
+	}
+
+	cacheSizeCmd := &cobra.Command{
+		Use:   "size",
+		Short: "Show how much disk space the cache uses",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheSize()
+		},
+	}
+
+	var pruneMaxAge time.Duration
+	cachePruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached files that haven't been used for a while",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCachePrune(pruneMaxAge)
+		},
+	}
+	cachePruneCmd.Flags().DurationVar(&pruneMaxAge, "max-age", cache.DefaultTTL, "Remove files not fetched or revalidated within this duration")
+
+	cacheCmd.AddCommand(cacheClearCmd, cacheListCmd, cacheSizeCmd, cachePruneCmd)
+
+	storeCmd := &cobra.Command{
+		Use:   "store",
+		Short: "Manage the package store used by install-strategy store",
+	}
+
+	storeVerifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check every stored file against its hash and remove damaged packages",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStoreVerify()
+		},
+	}
+
+	storePruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove stored packages that no vendor directory links to",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStorePrune()
+		},
+	}
+
+	storeCmd.AddCommand(storeVerifyCmd, storePruneCmd)
+
+	var configGlobal, configUnset, configList bool
+	configCmd := &cobra.Command{
+		Use:   "config [key] [value]",
+		Short: "Read and write configuration",
+		Long: `Read and write configuration in composer.json, or with --global in the global config.json.
+
+Keys: ` + strings.Join(config.Keys(), ", ") + `. Platform packages and
+preferred-install patterns are set one at a time: platform.php 8.2.0.`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfig(configGlobal, configUnset, configList, args)
+		},
+	}
+	configCmd.Flags().BoolVarP(&configGlobal, "global", "g", false, "Use the global config.json in the Composer home")
+	configCmd.Flags().BoolVar(&configUnset, "unset", false, "Remove the key")
+	configCmd.Flags().BoolVarP(&configList, "list", "l", false, "List every key with its value")
 
 	runScriptCmd := &cobra.Command{
 		Use:     "run-script [script] [-- args...]",
@@ -172,7 +275,10 @@ func main() {
 		initCmd,
 		treeCmd,
 		validateCmd,
+		checkPlatformCmd,
 		cacheCmd,
+		storeCmd,
+		configCmd,
 		runScriptCmd,
 	)
 
@@ -209,7 +315,11 @@ func logVerbose(format string, args ...interface{}) {
 	}
 }
 
-func runInstall(forceResolve bool) error {
+// runInstall installs from composer.lock when it is up to date, or resolves
+// composer.json otherwise. A non-nil update always resolves, limited to the
+// packages it selects.
+func runInstall(update *resolver.UpdateOptions) error {
+	forceResolve := update != nil
 
 	fmt.Println("🎵 Presto Install")
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -222,7 +332,12 @@ func runInstall(forceResolve bool) error {
 	fmt.Printf("📦 Project: %s\n", composer.Name)
 	fmt.Printf("📝 Description: %s\n\n", composer.Description)
 
-	scriptRunner := scripts.NewRunner(verbose)
+	cfg, err := loadConfig(composer)
+	if err != nil {
+		return err
+	}
+
+	scriptRunner := newScriptRunner(cfg)
 
 	if forceResolve {
 		scriptRunner.Run("pre-update-cmd", composer)
@@ -230,10 +345,38 @@ func runInstall(forceResolve bool) error {
 		scriptRunner.Run("pre-install-cmd", composer)
 	}
 
-	client := packagist.NewClient()
+	client, err := newClient(composer)
+	if err != nil {
+		return err
+	}
 	res := resolver.NewResolver(client)
+	configurePlatform(res, cfg)
 	var packages []*resolver.Package
 
+	filesCache := cache.New(cfg.CacheDir)
+	filesCache.SetExclude(cfg.StoreDir)
+	dl := downloader.NewDownloader(8) // 8 parallel workers
+	dl.SetVendorDir(cfg.VendorDir)
+	dl.SetCache(filesCache)
+	dl.SetPreferredInstall(cfg.PreferredInstall)
+	if repos, err := composer.RepositoryList(); err == nil {
+		dl.SetRepositories(repos)
+	}
+	if cfg.InstallStrategy == "store" {
+		dl.SetStore(store.New(cfg.StoreDir))
+	}
+	dl.SetOffline(offlineMode())
+	if creds, err := loadCredentials(); err == nil {
+		dl.SetCredentials(creds)
+	}
+
+	// The prefer-stable and prefer-lowest modes end up in the lock file: an
+	// update takes them from its flags, an install keeps the lock's.
+	var preferStable, preferLowest bool
+	if update != nil {
+		preferStable, preferLowest = update.PreferStable, update.PreferLowest
+	}
+
 	if !forceResolve {
 		if _, err := os.Stat("composer.lock"); err == nil {
 			fmt.Println("🔒 Installing from composer.lock")
@@ -249,6 +392,7 @@ func runInstall(forceResolve bool) error {
 					if err != nil {
 						return fmt.Errorf("failed to resolve from lock file: %w", err)
 					}
+					preferStable, preferLowest = lock.PreferStable, lock.PreferLowest
 				}
 			} else {
 				fmt.Printf("⚠️  Failed to parse composer.lock: %v. Falling back to composer.json\n", err)
@@ -259,13 +403,35 @@ func runInstall(forceResolve bool) error {
 	if len(packages) == 0 {
 		fmt.Println("🔍 Resolving dependencies...")
 		logVerbose("Starting dependency resolution for %d required packages", len(composer.Require))
-		packages, err = res.Resolve(composer)
+		if update != nil {
+			packages, err = resolveUpdate(res, composer, *update)
+		} else {
+			packages, err = res.Resolve(composer)
+		}
 
+		// Offline, a failure may just mean that metadata isn't cached.
+		if err != nil && offlineMode() {
+			if missing := checkOffline(client, dl, nil); missing != nil {
+				return reportMissing(missing)
+			}
+		}
+
+		var failure *resolver.SolveFailure
+		if errors.As(err, &failure) {
+			printSolveFailure(failure)
+			return fmt.Errorf("dependency resolution failed")
+		}
 		if err != nil {
 			return fmt.Errorf("dependency resolution failed: %w", err)
 		}
 	}
 
+	if offlineMode() {
+		if missing := checkOffline(client, dl, packages); missing != nil {
+			return reportMissing(missing)
+		}
+	}
+
 	fmt.Printf("✅ Resolved %d packages\n\n", len(packages))
 	logVerbose("Resolved packages: %d", len(packages))
 	for _, pkg := range packages {
@@ -275,14 +441,23 @@ func runInstall(forceResolve bool) error {
 	fmt.Println("⬇️  Downloading packages...")
 	logVerbose("Starting download with %d workers", 8)
 
-	dl := downloader.NewDownloader(8) // 8 parallel workers
 	if err := dl.DownloadAll(packages); err != nil {
 		return fmt.Errorf("download failed: %w", err)
 	}
 
+	// Archives unused for cache-files-ttl go, and then the least recently
+	// used ones until the rest fit in cache-files-maxsize.
+	removed, err := filesCache.GC(cache.FilesDir, cfg.CacheFilesTTL, cfg.CacheFilesMaxSize)
+	for _, e := range removed {
+		logVerbose("Removed %s from the cache", e.Key)
+	}
+	if err != nil {
+		logVerbose("Failed to clean up the cache: %v", err)
+	}
+
 	fmt.Println("🔄 Updating package information...")
 	for _, pkg := range packages {
-		jsonPath := filepath.Join("vendor", pkg.Name, "composer.json")
+		jsonPath := filepath.Join(cfg.VendorDir, pkg.Name, "composer.json")
 		content, err := os.ReadFile(jsonPath)
 		if err != nil {
 			logVerbose("Could not read composer.json for %s: %v", pkg.Name, err)
@@ -302,6 +477,10 @@ func runInstall(forceResolve bool) error {
 	logVerbose("Generating PSR-4 autoload files")
 
 	gen := autoload.NewGenerator()
+	gen.SetVendorDir(cfg.VendorDir)
+	gen.SetOptimize(cfg.OptimizeAutoloader)
+	gen.SetPlatformCheck(cfg.PlatformCheck)
+	gen.SetIgnoredPlatformReqs(platformIgnoreList())
 	scriptRunner.Run("pre-autoload-dump", composer)
 	if err := gen.Generate(composer, packages); err != nil {
 		return fmt.Errorf("autoload generation failed: %w", err)
@@ -312,6 +491,8 @@ func runInstall(forceResolve bool) error {
 	logVerbose("Generating lock file")
 
 	lockGen := lockfile.NewGeneratorWithClient(client)
+	lockGen.SetPreferences(preferStable, preferLowest)
+	lockGen.SetPlatform(cfg.Platform)
 	if err := lockGen.Generate(composer, packages); err != nil {
 		return fmt.Errorf("lock file generation failed: %w", err)
 	}
@@ -336,7 +517,10 @@ func runRequire(packages []string) error {
 		return err
 	}
 
-	client := packagist.NewClient()
+	client, err := newClient(composer)
+	if err != nil {
+		return err
+	}
 
 	for _, pkg := range packages {
 		fmt.Printf("🔍 Fetching %s...\n", pkg)
@@ -357,19 +541,183 @@ func runRequire(packages []string) error {
 		return err
 	}
 
-	return runInstall(true)
+	return runInstall(&resolver.UpdateOptions{})
 }
 
-func runUpdate(packages []string) error {
+func runUpdate(opts resolver.UpdateOptions) error {
 	fmt.Println("🎵 Updating dependencies...")
 
-	if len(packages) == 0 {
+	if len(opts.Packages) == 0 {
 		fmt.Println("📦 Updating all packages")
 	} else {
-		fmt.Printf("📦 Updating: %v\n", packages)
+		fmt.Printf("📦 Updating: %v\n", opts.Packages)
+	}
+
+	return runInstall(&opts)
+}
+
+// newClient returns a client for the project's repositories and Packagist,
+// limited to the disk cache when the network is disabled.
+func newClient(composer *parser.ComposerJSON) (*packagist.Client, error) {
+	creds, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(composer)
+	if err != nil {
+		return nil, err
+	}
+
+	client := packagist.NewClient()
+	client.SetCache(cache.New(cfg.CacheDir))
+	client.SetOffline(offlineMode())
+	client.SetCredentials(creds)
+
+	repos, err := composer.RepositoryList()
+	if err == nil {
+		err = client.SetRepositories(repos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid repositories in composer.json: %w", err)
+	}
+	return client, nil
+}
+
+// loadCredentials reads the global and project auth.json and COMPOSER_AUTH,
+// once per run. Only the hosts are logged, never the secrets.
+var loadCredentials = sync.OnceValues(func() (*auth.Credentials, error) {
+	creds, err := auth.Load(config.Home(), ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+	if hosts := creds.Hosts(); len(hosts) > 0 {
+		logVerbose("Using credentials for %s", strings.Join(hosts, ", "))
 	}
+	return creds, nil
+})
+
+// loadConfig returns the configuration of the project composer describes or,
+// when it is nil, of the one in the current directory if any, on top of the
+// global config.json.
+func loadConfig(composer *parser.ComposerJSON) (*config.Config, error) {
+	if composer == nil {
+		composer, _ = parser.ParseComposerJSON("composer.json")
+	}
+	cfg, err := config.Load(config.Home(), composer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg, nil
+}
+
+// newScriptRunner returns a script runner with the configured vendor and bin
+// dirs and process timeout.
+func newScriptRunner(cfg *config.Config) *scripts.Runner {
+	runner := scripts.NewRunner(verbose)
+	runner.VendorDir = cfg.VendorDir
+	runner.BinDir = cfg.BinDir
+	runner.Timeout = cfg.ProcessTimeout
+	return runner
+}
 
-	return runInstall(true)
+// offlineMode reports whether the network is disabled, through --offline or
+// COMPOSER_DISABLE_NETWORK=1.
+func offlineMode() bool {
+	if offline {
+		return true
+	}
+	switch os.Getenv("COMPOSER_DISABLE_NETWORK") {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// checkOffline lists the metadata and archives that installing packages
+// needs but that are not in the cache, or returns nil when nothing is
+// missing. The metadata is needed to write composer.lock.
+func checkOffline(client *packagist.Client, dl *downloader.Downloader, packages []*resolver.Package) *cache.MissingError {
+	for _, pkg := range packages {
+		_, _ = client.GetVersion(pkg.Name, pkg.Version)
+	}
+
+	var items []string
+	for _, file := range client.Missing() {
+		items = append(items, "metadata for "+file)
+	}
+	for _, pkg := range dl.Missing(packages) {
+		if pkg.URL == "" {
+			items = append(items, fmt.Sprintf("git repository of %s %s (%s)", pkg.Name, pkg.Version, pkg.Source.URL))
+			continue
+		}
+		items = append(items, fmt.Sprintf("archive of %s %s (%s)", pkg.Name, pkg.Version, pkg.URL))
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+	return &cache.MissingError{Items: items}
+}
+
+// reportMissing prints what an offline command needed but couldn't find in
+// the cache, and returns the error to exit with.
+func reportMissing(missing *cache.MissingError) error {
+	fmt.Printf("\n❌ The network is disabled and %d items are not in the cache:\n", len(missing.Items))
+	for _, item := range missing.Items {
+		fmt.Printf("  - %s\n", item)
+	}
+	fmt.Println("\n💡 Run the same command once with network access to fill the cache.")
+	return fmt.Errorf("offline: required files are missing from the cache")
+}
+
+// configurePlatform makes res check platform requirements against the local
+// PHP runtime with config.platform applied, minus the ignored ones. Without a
+// usable PHP binary they are not checked, as before.
+func configurePlatform(res *resolver.Resolver, cfg *config.Config) {
+	detected, err := platform.Detect(platform.Binary())
+	if err != nil {
+		// config.platform is there so that resolution doesn't need the
+		// runtime, as in CI or a container without PHP.
+		if len(cfg.Platform) > 0 {
+			fmt.Printf("⚠️  Could not detect the PHP runtime, resolving against config.platform only: %v\n", err)
+			res.SetPlatform(platform.Packages(cfg.Platform, nil), platformIgnoreList())
+			return
+		}
+		fmt.Printf("⚠️  Could not detect the PHP runtime, platform requirements are not checked: %v\n", err)
+		return
+	}
+	logVerbose("Detected platform: php %s with %d packages", detected["php"], len(detected))
+
+	res.SetPlatform(platform.Packages(cfg.Platform, detected), platformIgnoreList())
+}
+
+// platformIgnoreList returns the platform requirements ignored through
+// --ignore-platform-req and --ignore-platform-reqs.
+func platformIgnoreList() []string {
+	if ignoreAllPlatformReqs {
+		return []string{"*"}
+	}
+	return ignorePlatformReqs
+}
+
+// resolveUpdate resolves for an update. A partial update keeps every package
+// not selected by opts at its composer.lock version, or updates everything
+// when there is no usable lock file.
+func resolveUpdate(res *resolver.Resolver, composer *parser.ComposerJSON, opts resolver.UpdateOptions) ([]*resolver.Package, error) {
+	var lock *parser.ComposerLock
+	if len(opts.Packages) > 0 {
+		var err error
+		if lock, err = parser.ParseComposerLock("composer.lock"); err != nil {
+			fmt.Println("⚠️  No usable composer.lock, updating all packages")
+		}
+	}
+
+	if lock != nil {
+		for _, name := range opts.Unmatched(composer, lock) {
+			fmt.Printf("⚠️  Package \"%s\" listed for update is not locked.\n", name)
+		}
+	}
+	return res.ResolveUpdate(composer, lock, opts)
 }
 
 func runRemove(packages []string) error {
@@ -422,8 +770,19 @@ func runAudit() error {
 		return err
 	}
 
+	cfg, err := loadConfig(composer)
+	if err != nil {
+		return err
+	}
+
 	auditor := security.NewAuditor()
+	auditor.SetCache(cache.New(cfg.CacheDir))
+	auditor.SetOffline(offlineMode())
 	vulnerabilities, err := auditor.ScanProject(composer)
+	var missing *cache.MissingError
+	if errors.As(err, &missing) {
+		return reportMissing(missing)
+	}
 	if err != nil {
 		return err
 	}
@@ -459,7 +818,10 @@ func runWhy(packageName string) error {
 		return nil
 	}
 
-	client := packagist.NewClient()
+	client, err := newClient(composer)
+	if err != nil {
+		return err
+	}
 	res := resolver.NewResolver(client)
 	tree, err := res.BuildDependencyTree(composer, packageName)
 	if err != nil {
@@ -481,24 +843,28 @@ func runWhyNot(packageName, version string) error {
 		return err
 	}
 
-	client := packagist.NewClient()
+	client, err := newClient(composer)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(composer)
+	if err != nil {
+		return err
+	}
 	res := resolver.NewResolver(client)
+	configurePlatform(res, cfg)
 
-	conflicts, err := res.CheckConflicts(composer, packageName, version)
+	failure, err := res.WhyNot(composer, packageName, version)
 	if err != nil {
 		return err
 	}
 
-	if len(conflicts) == 0 {
+	if failure == nil {
 		fmt.Println("✅ No conflicts! You can install this version.")
 		return nil
 	}
 
-	fmt.Println("\n❌ Conflicts found:")
-
-	for _, conflict := range conflicts {
-		fmt.Printf("  • %s\n", conflict)
-	}
+	printSolveFailure(failure)
 
 	fmt.Println("\n💡 To install:")
 	fmt.Println("  1. Update conflicting packages")
@@ -507,6 +873,111 @@ func runWhyNot(packageName, version string) error {
 	return nil
 }
 
+// printSolveFailure prints the resolver's explanation of why no set of
+// package versions satisfies the requirements.
+func printSolveFailure(failure *resolver.SolveFailure) {
+	fmt.Println("\n❌ Your requirements could not be resolved to an installable set of packages.")
+	fmt.Println()
+	for _, line := range strings.Split(strings.TrimRight(failure.Explain(), "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println()
+}
+
+func runCheckPlatformReqs(useLock, noDev bool) error {
+	lock, err := parser.ParseComposerLock("composer.lock")
+	if err != nil {
+		return fmt.Errorf("failed to read composer.lock: %w", err)
+	}
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(cfg.VendorDir); !useLock && err != nil {
+		fmt.Println("⚠️  No vendor dir present, checking platform requirements from the lock file")
+		useLock = true
+	}
+	if useLock {
+		fmt.Println("🎵 Checking platform requirements using the lock file")
+	} else {
+		fmt.Println("🎵 Checking platform requirements for packages in the vendor dir")
+	}
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	packages := lock.Packages
+	root := lock.Platform
+	if !noDev {
+		packages = append(packages, lock.PackagesDev...)
+		root = make(map[string]string)
+		for name, constraint := range lock.PlatformDev {
+			root[name] = constraint
+		}
+		for name, constraint := range lock.Platform {
+			root[name] = constraint
+		}
+	}
+	if !useLock {
+		var installed []parser.LockedPackage
+		for _, lp := range packages {
+			if _, err := os.Stat(filepath.Join(cfg.VendorDir, lp.Name)); err == nil {
+				installed = append(installed, lp)
+			}
+		}
+		packages = installed
+	}
+
+	rootLabel := "composer.json"
+	if composer, err := parser.ParseComposerJSON("composer.json"); err == nil && composer.Name != "" {
+		rootLabel = composer.Name
+	}
+
+	detected, err := platform.Detect(platform.Binary())
+	if err != nil {
+		return fmt.Errorf("failed to detect the PHP runtime: %w", err)
+	}
+
+	checks := resolver.CheckPlatform(packages, root, rootLabel, platform.Runtime(detected))
+
+	width := 0
+	for _, check := range checks {
+		width = max(width, len(check.Name))
+	}
+
+	failed := 0
+	for _, check := range checks {
+		version := check.Version
+		if version == "" {
+			version = "n/a"
+		}
+
+		switch {
+		case check.OK() && check.ProvidedBy != "" && (check.Version == "" || len(check.Failed) > 0):
+			fmt.Printf("✅ %-*s %-10s success (provided by %s)\n", width, check.Name, version, check.ProvidedBy)
+		case check.OK():
+			fmt.Printf("✅ %-*s %-10s success\n", width, check.Name, version)
+		case check.Missing():
+			failed++
+			for _, link := range check.Links {
+				fmt.Printf("❌ %-*s %-10s %s requires %s (%s)  missing\n", width, check.Name, version, link.Source, check.Name, link.Constraint)
+			}
+		default:
+			failed++
+			for _, link := range check.Failed {
+				fmt.Printf("❌ %-*s %-10s %s requires %s (%s)  failed\n", width, check.Name, version, link.Source, check.Name, link.Constraint)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d platform requirements are not satisfied", failed)
+	}
+
+	fmt.Println("\n✨ All platform requirements are satisfied")
+	return nil
+}
+
 func runInit() error {
 	fmt.Println("🎵 Initialize new project")
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -537,17 +1008,247 @@ func runInit() error {
 func runCacheClear() error {
 	fmt.Println("🎵 Clearing cache...")
 
-	cacheDir := ".presto/cache"
-	if err := os.RemoveAll(cacheDir); err != nil {
+	c, err := configuredCache()
+	if err != nil {
+		return err
+	}
+	if err := c.Clear(); err != nil {
 		return fmt.Errorf("failed to clear cache: %w", err)
 	}
 
-	logVerbose("Removed cache directory: %s", cacheDir)
+	logVerbose("Removed cache directory: %s", c.Root())
 
 	fmt.Println("✅ Cache cleared")
 	return nil
 }
 
+func runCacheList() error {
+	c, err := configuredCache()
+	if err != nil {
+		return err
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	fmt.Printf("📂 %s\n", c.Root())
+	if len(entries) == 0 {
+		fmt.Println("Cache is empty")
+		return nil
+	}
+
+	for _, e := range entries {
+		fmt.Printf("  %s  %s  %s\n", e.Key, formatSize(e.Size), e.ModTime.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func runCacheSize() error {
+	c, err := configuredCache()
+	if err != nil {
+		return err
+	}
+	files, bytes, err := c.Size()
+	if err != nil {
+		return fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	fmt.Printf("📂 %s\n", c.Root())
+	fmt.Printf("💾 %d files, %s\n", files, formatSize(bytes))
+	return nil
+}
+
+func runCachePrune(maxAge time.Duration) error {
+	fmt.Println("🎵 Pruning cache...")
+
+	c, err := configuredCache()
+	if err != nil {
+		return err
+	}
+	removed, err := c.Prune(maxAge)
+	var freed int64
+	for _, e := range removed {
+		logVerbose("Removed %s", e.Key)
+		freed += e.Size
+	}
+	if err != nil {
+		return fmt.Errorf("failed to prune cache: %w", err)
+	}
+
+	fmt.Printf("✅ Removed %d files, freed %s\n", len(removed), formatSize(freed))
+	return nil
+}
+
+func runStoreVerify() error {
+	fmt.Println("🎵 Verifying store...")
+
+	s, err := configuredStore()
+	if err != nil {
+		return err
+	}
+	entries, err := s.Entries()
+	if err != nil {
+		return fmt.Errorf("failed to read store: %w", err)
+	}
+	damaged, err := s.Verify()
+	for _, e := range damaged {
+		fmt.Printf("❌ Removed damaged %s\n", e.Integrity)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify store: %w", err)
+	}
+
+	fmt.Printf("✅ Checked %d packages, removed %d damaged\n", len(entries), len(damaged))
+	return nil
+}
+
+func runStorePrune() error {
+	fmt.Println("🎵 Pruning store...")
+
+	s, err := configuredStore()
+	if err != nil {
+		return err
+	}
+	removed, err := s.Prune()
+	var freed int64
+	for _, e := range removed {
+		logVerbose("Removed %s", e.Integrity)
+		freed += e.Size
+	}
+	if err != nil {
+		return fmt.Errorf("failed to prune store: %w", err)
+	}
+
+	fmt.Printf("✅ Removed %d packages, freed %s\n", len(removed), formatSize(freed))
+	return nil
+}
+
+// runConfig prints the value of a key, or all of them with list, or sets or
+// unsets it in composer.json or, with global, in the global config.json.
+func runConfig(global, unset, list bool, args []string) error {
+	if list || (len(args) == 1 && !unset) {
+		var cfg *config.Config
+		var err error
+		if global {
+			cfg, err = config.Load(config.Home(), nil)
+		} else {
+			cfg, err = loadConfig(nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		keys := config.Keys()
+		if !list {
+			keys = args
+		}
+		for _, key := range keys {
+			value, err := cfg.Get(key)
+			if err != nil {
+				return err
+			}
+			switch {
+			case list && verbose:
+				fmt.Printf("[%s] %s (%s)\n", key, config.Format(value), cfg.Source(key))
+			case list:
+				fmt.Printf("[%s] %s\n", key, config.Format(value))
+			default:
+				fmt.Println(config.Format(value))
+			}
+		}
+		return nil
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("specify a config key, or --list")
+	}
+	key := args[0]
+	if unset && len(args) > 1 {
+		return fmt.Errorf("--unset takes no value")
+	}
+
+	edit := func(section map[string]interface{}) error {
+		if unset {
+			return config.Unset(section, key)
+		}
+		return config.Set(section, key, args[1])
+	}
+
+	if global {
+		home := config.Home()
+		section, err := config.ReadGlobal(home)
+		if err != nil {
+			return err
+		}
+		if section == nil {
+			section = make(map[string]interface{})
+		}
+		if err := edit(section); err != nil {
+			return err
+		}
+		if err := config.WriteGlobal(home, section); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Updated %s\n", config.GlobalFile(home))
+		return nil
+	}
+
+	composer, err := parser.ParseComposerJSON("composer.json")
+	if err != nil {
+		return fmt.Errorf("failed to parse composer.json: %w", err)
+	}
+	if composer.Config == nil {
+		composer.Config = make(map[string]interface{})
+	}
+	if err := edit(composer.Config); err != nil {
+		return err
+	}
+	// A value can be fine by itself and still clash with the global config.
+	if _, err := config.Load(config.Home(), composer); err != nil {
+		return err
+	}
+	if err := config.WriteProject("composer.json", composer.Config); err != nil {
+		return err
+	}
+	fmt.Println("✅ Updated composer.json")
+	return nil
+}
+
+// configuredStore returns the store in the configured store-dir.
+func configuredStore() (*store.Store, error) {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	return store.New(cfg.StoreDir), nil
+}
+
+// configuredCache returns the cache in the configured cache-dir.
+func configuredCache() (*cache.Cache, error) {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	c := cache.New(cfg.CacheDir)
+	c.SetExclude(cfg.StoreDir)
+	return c, nil
+}
+
+// formatSize renders a byte count as e.g. "1.5 MiB".
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
 func runTree() error {
 	fmt.Println("🌳 Generating dependency map...")
 
@@ -556,7 +1257,10 @@ func runTree() error {
 		return fmt.Errorf("failed to parse composer.json: %w", err)
 	}
 
-	client := packagist.NewClient()
+	client, err := newClient(pkgJson)
+	if err != nil {
+		return err
+	}
 	res := resolver.NewResolver(client)
 
 	fmt.Println("🔍 Resolving dependencies (this may take a moment)...")
@@ -682,6 +1386,9 @@ func runScript(scriptName string, scriptArgs ...string) error {
 		return fmt.Errorf("script not found: %q", scriptName)
 	}
 
-	runner := scripts.NewRunner(verbose)
-	return runner.Run(scriptName, composer, scriptArgs...)
+	cfg, err := loadConfig(composer)
+	if err != nil {
+		return err
+	}
+	return newScriptRunner(cfg).Run(scriptName, composer, scriptArgs...)
 }
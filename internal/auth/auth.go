@@ -0,0 +1,218 @@
+// Package auth loads the credentials Composer keeps in auth.json and
+// $COMPOSER_AUTH, and adds them to the requests sent to the hosts they are
+// for.
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Credentials holds the sections of auth.json, each keyed by host.
+type Credentials struct {
+	HTTPBasic   map[string]BasicAuth   `json:"http-basic,omitempty"`
+	Bearer      map[string]string      `json:"bearer,omitempty"`
+	GitHubOAuth map[string]string      `json:"github-oauth,omitempty"`
+	GitLabToken map[string]GitLabToken `json:"gitlab-token,omitempty"`
+	GitLabOAuth map[string]string      `json:"gitlab-oauth,omitempty"`
+}
+
+// BasicAuth is an http-basic entry.
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// String hides the password.
+func (b BasicAuth) String() string {
+	return b.Username + ":***"
+}
+
+// GitLabToken is a gitlab-token entry: a private token, or a deploy token
+// with its username.
+type GitLabToken struct {
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token"`
+}
+
+// UnmarshalJSON accepts the token alone as a string.
+func (t *GitLabToken) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &t.Token)
+	}
+	type plain GitLabToken
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+// String hides the token.
+func (t GitLabToken) String() string {
+	return t.Username + ":***"
+}
+
+// Load reads the global auth.json in home, then the project's in dir, then
+// $COMPOSER_AUTH. Each replaces the credentials of the ones before it for
+// the same host. Missing files are fine.
+func Load(home, dir string) (*Credentials, error) {
+	creds := &Credentials{}
+
+	for _, path := range []string{filepath.Join(home, "auth.json"), filepath.Join(dir, "auth.json")} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := creds.merge(data); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+	}
+
+	if env := os.Getenv("COMPOSER_AUTH"); env != "" {
+		if err := creds.merge([]byte(env)); err != nil {
+			return nil, fmt.Errorf("invalid COMPOSER_AUTH: %w", err)
+		}
+	}
+	return creds, nil
+}
+
+// merge adds the credentials in an auth.json document, replacing those for
+// the same hosts.
+func (c *Credentials) merge(data []byte) error {
+	var doc Credentials
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	c.HTTPBasic = mergeHosts(c.HTTPBasic, doc.HTTPBasic)
+	c.Bearer = mergeHosts(c.Bearer, doc.Bearer)
+	c.GitHubOAuth = mergeHosts(c.GitHubOAuth, doc.GitHubOAuth)
+	c.GitLabToken = mergeHosts(c.GitLabToken, doc.GitLabToken)
+	c.GitLabOAuth = mergeHosts(c.GitLabOAuth, doc.GitLabOAuth)
+	return nil
+}
+
+func mergeHosts[T any](dst, src map[string]T) map[string]T {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]T, len(src))
+	}
+	for host, v := range src {
+		dst[strings.ToLower(host)] = v
+	}
+	return dst
+}
+
+// lookup returns the entry for host: an exact match on host and port, or
+// else on the host name alone.
+func lookup[T any](entries map[string]T, host, hostname string) (T, bool) {
+	if v, ok := entries[host]; ok {
+		return v, true
+	}
+	v, ok := entries[hostname]
+	return v, ok
+}
+
+// Authorize adds the credentials for req's host to req, unless it carries
+// some already. It reports whether there were any. Like Composer's
+// secure-http, credentials are only ever sent over https.
+func (c *Credentials) Authorize(req *http.Request) bool {
+	if c == nil || req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return false
+	}
+	host := strings.ToLower(req.URL.Host)
+	hostname := strings.ToLower(req.URL.Hostname())
+
+	if basic, ok := lookup(c.HTTPBasic, host, hostname); ok {
+		req.SetBasicAuth(basic.Username, basic.Password)
+		return true
+	}
+	if token, ok := lookup(c.Bearer, host, hostname); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return true
+	}
+	if token, ok := lookup(c.GitLabToken, host, hostname); ok {
+		if token.Username != "" {
+			req.SetBasicAuth(token.Username, token.Token)
+		} else {
+			req.Header.Set("PRIVATE-TOKEN", token.Token)
+		}
+		return true
+	}
+	if token, ok := lookup(c.GitLabOAuth, host, hostname); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return true
+	}
+	// A GitHub token is for the API host as well, where archives are
+	// downloaded from.
+	if token, ok := lookup(c.GitHubOAuth, host, hostname); ok {
+		req.Header.Set("Authorization", "token "+token)
+		return true
+	}
+	if apiHost, ok := strings.CutPrefix(hostname, "api."); ok {
+		if token, ok := c.GitHubOAuth[apiHost]; ok {
+			req.Header.Set("Authorization", "token "+token)
+			return true
+		}
+	}
+	return false
+}
+
+// Hosts lists the hosts there are credentials for and their kind, e.g.
+// "repo.example.com (http-basic)", without the secrets.
+func (c *Credentials) Hosts() []string {
+	var hosts []string
+	add := func(kind string, keys []string) {
+		for _, host := range keys {
+			hosts = append(hosts, host+" ("+kind+")")
+		}
+	}
+	add("http-basic", keys(c.HTTPBasic))
+	add("bearer", keys(c.Bearer))
+	add("github-oauth", keys(c.GitHubOAuth))
+	add("gitlab-token", keys(c.GitLabToken))
+	add("gitlab-oauth", keys(c.GitLabOAuth))
+	sort.Strings(hosts)
+	return hosts
+}
+
+// String lists the hosts, so that printing the credentials by mistake doesn't
+// reveal them.
+func (c *Credentials) String() string {
+	return strings.Join(c.Hosts(), ", ")
+}
+
+func keys[T any](m map[string]T) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
+
+// Transport adds credentials to every request it sends, for the host that
+// request goes to. Requests that follow a redirect to another host get that
+// host's credentials, if any, rather than the original ones.
+type Transport struct {
+	Credentials *Credentials
+	Base        http.RoundTripper // http.DefaultTransport if nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	authorized := req.Clone(req.Context())
+	if t.Credentials.Authorize(authorized) {
+		req = authorized
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	home, project := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(home, "auth.json"), []byte(`{
+		"http-basic": {"Repo.Example.com": {"username": "global", "password": "g"}, "other.example.com": {"username": "other", "password": "o"}},
+		"github-oauth": {"github.com": "ghp_global"}
+	}`), 0644)
+	os.WriteFile(filepath.Join(project, "auth.json"), []byte(`{
+		"http-basic": {"repo.example.com": {"username": "project", "password": "p"}},
+		"gitlab-token": {"gitlab.com": "glpat-project", "gitlab.example.com": {"username": "deploy", "token": "gldt"}}
+	}`), 0644)
+	t.Setenv("COMPOSER_AUTH", `{"github-oauth": {"github.com": "ghp_env"}}`)
+
+	creds, err := Load(home, project)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	if got := creds.HTTPBasic["repo.example.com"].Username; got != "project" {
+		t.Errorf("repo.example.com user = %q, want the project's", got)
+	}
+	if got := creds.HTTPBasic["other.example.com"].Username; got != "other" {
+		t.Errorf("other.example.com user = %q, want the global one", got)
+	}
+	if got := creds.GitHubOAuth["github.com"]; got != "ghp_env" {
+		t.Errorf("github.com token = %q, want COMPOSER_AUTH's", got)
+	}
+	if got := creds.GitLabToken["gitlab.com"]; got.Token != "glpat-project" || got.Username != "" {
+		t.Errorf("gitlab.com token = %+v, want a private token", got)
+	}
+
+	if s := fmt.Sprint(creds, creds.HTTPBasic, creds.GitLabToken); strings.Contains(s, "ghp_env") || strings.Contains(s, "gldt") || strings.Contains(s, `"p"`) {
+		t.Errorf("printing credentials revealed a secret: %s", s)
+	}
+
+	t.Setenv("COMPOSER_AUTH", `{"bearer": `)
+	if _, err := Load(home, project); err == nil || !strings.Contains(err.Error(), "COMPOSER_AUTH") {
+		t.Errorf("Load() with invalid COMPOSER_AUTH = %v, want an error naming it", err)
+	}
+}
+
+func TestCredentials_Authorize(t *testing.T) {
+	creds := &Credentials{
+		HTTPBasic:   map[string]BasicAuth{"repo.example.com": {Username: "user", Password: "pass"}, "localhost:8080": {Username: "port", Password: "pass"}},
+		Bearer:      map[string]string{"api.example.com": "bearer-token"},
+		GitHubOAuth: map[string]string{"github.com": "ghp_token"},
+		GitLabToken: map[string]GitLabToken{"gitlab.com": {Token: "glpat"}, "gitlab.example.com": {Username: "deploy", Token: "gldt"}},
+		GitLabOAuth: map[string]string{"gitlab.internal": "oauth-token"},
+	}
+
+	basic := func(user, pass string) string {
+		req, _ := http.NewRequest("GET", "https://x", nil)
+		req.SetBasicAuth(user, pass)
+		return req.Header.Get("Authorization")
+	}
+
+	tests := []struct {
+		url    string
+		header string
+		want   string
+	}{
+		{"https://repo.example.com/packages.json", "Authorization", basic("user", "pass")},
+		{"https://REPO.example.com:443/packages.json", "Authorization", basic("user", "pass")},
+		{"https://localhost:8080/packages.json", "Authorization", basic("port", "pass")},
+		{"https://localhost:9090/packages.json", "Authorization", ""},
+		{"http://localhost:8080/packages.json", "Authorization", ""},
+		{"http://repo.example.com/packages.json", "Authorization", ""},
+		{"http://api.example.com/p2/a/a.json", "Authorization", ""},
+		{"http://gitlab.com/a.zip", "PRIVATE-TOKEN", ""},
+		{"https://api.example.com/p2/a/a.json", "Authorization", "Bearer bearer-token"},
+		{"https://api.github.com/repos/a/a/zipball/abc", "Authorization", "token ghp_token"},
+		{"https://github.com/a/a/archive/abc.zip", "Authorization", "token ghp_token"},
+		{"https://codeload.github.com/a/a/legacy.zip/abc", "Authorization", ""},
+		{"https://gitlab.com/api/v4/projects/1/repository/archive.zip", "PRIVATE-TOKEN", "glpat"},
+		{"https://gitlab.example.com/a.zip", "Authorization", basic("deploy", "gldt")},
+		{"https://gitlab.internal/a.zip", "Authorization", "Bearer oauth-token"},
+		{"https://evil.example.com/repo.example.com", "Authorization", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		creds.Authorize(req)
+		if got := req.Header.Get(tt.header); got != tt.want {
+			t.Errorf("Authorize(%s) set %s = %q, want %q", tt.url, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTransport_Redirect(t *testing.T) {
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization")
+	}))
+	defer other.Close()
+
+	var got string
+	repo := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		http.Redirect(w, r, other.URL+"/archive.zip", http.StatusFound)
+	}))
+	defer repo.Close()
+
+	host := strings.TrimPrefix(repo.URL, "https://")
+	client := &http.Client{Transport: &Transport{
+		Credentials: &Credentials{Bearer: map[string]string{host: "secret"}},
+		Base:        repo.Client().Transport,
+	}}
+	resp, err := client.Get(repo.URL + "/dist.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got != "Bearer secret" {
+		t.Errorf("repository got Authorization %q, want the bearer token", got)
+	}
+	if leaked != "" {
+		t.Errorf("redirect target got Authorization %q, want none", leaked)
+	}
+}
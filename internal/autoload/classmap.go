@@ -0,0 +1,186 @@
+package autoload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/resolver"
+)
+
+// phpIdentifier matches a namespace segment or class name.
+var phpIdentifier = regexp.MustCompile(`^[A-Za-z_\x80-\xff][A-Za-z0-9_\x80-\xff]*$`)
+
+// baseDirPHP returns the PHP expression for the project directory, given
+// $vendorDir: dirname() once per level of the vendor directory, or the
+// absolute path when it lies outside the project.
+func (g *Generator) baseDirPHP() string {
+	vendorDir, err1 := filepath.Abs(g.vendorDir)
+	projectDir, err2 := filepath.Abs(".")
+	if err1 != nil || err2 != nil {
+		return "dirname($vendorDir)"
+	}
+
+	rel, err := filepath.Rel(vendorDir, projectDir)
+	if err == nil {
+		expr := "$vendorDir"
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			if part != ".." {
+				expr = ""
+				break
+			}
+			expr = "dirname(" + expr + ")"
+		}
+		if expr != "" {
+			return expr
+		}
+	}
+	return "'" + strings.ReplaceAll(filepath.ToSlash(projectDir), "'", `\'`) + "'"
+}
+
+// classmapDir is a PSR-4 or PSR-0 directory to scan for classes.
+type classmapDir struct {
+	namespace string
+	dir       string // on disk
+	base      string // $baseDir or $vendorDir
+	prefix    string // dir relative to base
+}
+
+// generateClassmap writes autoload_classmap.php when optimizing, mapping
+// every class file under the PSR-4 and PSR-0 directories to its path, so
+// those classes load without probing the file system. It returns false,
+// removing any stale map, when not optimizing.
+func (g *Generator) generateClassmap(composer *parser.ComposerJSON, packages []*resolver.Package) (bool, error) {
+	mapPath := filepath.Join(g.vendorDir, "autoload_classmap.php")
+	if !g.optimize {
+		if err := os.Remove(mapPath); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	var dirs []classmapDir
+	add := func(namespace string, paths interface{}, base, prefix string) {
+		namespace = strings.Trim(strings.TrimSpace(namespace), "\\")
+		if namespace != "" {
+			namespace += "\\"
+		}
+		var list []string
+		switch v := paths.(type) {
+		case string:
+			list = append(list, v)
+		case []interface{}:
+			for _, p := range v {
+				if s, ok := p.(string); ok {
+					list = append(list, s)
+				}
+			}
+		}
+		root := "."
+		if base == "$vendorDir" {
+			root = g.vendorDir
+		}
+		for _, p := range list {
+			p = path.Join(prefix, strings.Trim(p, "/"))
+			dirs = append(dirs, classmapDir{namespace, filepath.Join(root, filepath.FromSlash(p)), base, p})
+		}
+	}
+
+	for _, config := range []parser.AutoloadConfig{composer.Autoload, composer.AutoloadDev} {
+		for namespace, paths := range config.PSR4 {
+			add(namespace, paths, "$baseDir", "")
+		}
+		for namespace, paths := range config.PSR0 {
+			add(namespace, paths, "$baseDir", "")
+		}
+	}
+	for _, pkg := range packages {
+		var config struct {
+			PSR4 map[string]interface{} `json:"psr-4"`
+			PSR0 map[string]interface{} `json:"psr-0"`
+		}
+		if len(pkg.Autoload) == 0 || json.Unmarshal(pkg.Autoload, &config) != nil {
+			continue
+		}
+		for namespace, paths := range config.PSR4 {
+			add(namespace, paths, "$vendorDir", pkg.Name)
+		}
+		for namespace, paths := range config.PSR0 {
+			add(namespace, paths, "$vendorDir", pkg.Name)
+		}
+	}
+
+	classes := make(map[string]string)
+	for _, d := range dirs {
+		if err := g.scanClasses(d, classes); err != nil {
+			return false, err
+		}
+	}
+
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("<?php\n\n// autoload_classmap.php @generated by Presto\n\n")
+	sb.WriteString("$vendorDir = __DIR__;\n")
+	sb.WriteString("$baseDir = " + g.baseDirPHP() + ";\n\n")
+	sb.WriteString("return array(\n")
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("    '%s' => %s,\n", strings.ReplaceAll(name, "\\", "\\\\"), classes[name]))
+	}
+	sb.WriteString(");\n")
+
+	return true, os.WriteFile(mapPath, []byte(sb.String()), 0644)
+}
+
+// scanClasses adds the class each .php file under d stands for to classes,
+// named after its path the way the PSR-4 loader looks it up. The vendor
+// directory and hidden directories are skipped; the first file found for a
+// class wins.
+func (g *Generator) scanClasses(d classmapDir, classes map[string]string) error {
+	vendorDir, _ := filepath.Abs(g.vendorDir)
+
+	err := filepath.WalkDir(d.dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			abs, _ := filepath.Abs(file)
+			if file != d.dir && (abs == vendorDir || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.dir, file)
+		if err != nil || !strings.HasSuffix(rel, ".php") {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(strings.TrimSuffix(rel, ".php")), "/")
+		for _, part := range parts {
+			if !phpIdentifier.MatchString(part) {
+				return nil
+			}
+		}
+
+		class := d.namespace + strings.Join(parts, "\\")
+		if _, ok := classes[class]; !ok {
+			classes[class] = fmt.Sprintf("%s . '/%s'", d.base, path.Join(d.prefix, filepath.ToSlash(rel)))
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
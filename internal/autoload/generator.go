@@ -13,7 +13,10 @@ import (
 
 // Generator generates autoload files
 type Generator struct {
-	vendorDir string
+	vendorDir      string
+	ignorePlatform []string
+	optimize       bool
+	platformCheck  string
 }
 
 // NewGenerator creates a new autoload generator
@@ -23,13 +26,46 @@ func NewGenerator() *Generator {
 	}
 }
 
+// SetIgnoredPlatformReqs leaves platform requirements matching the patterns
+// out of platform_check.php, like --ignore-platform-req does for resolution.
+func (g *Generator) SetIgnoredPlatformReqs(patterns []string) {
+	g.ignorePlatform = patterns
+}
+
+// SetVendorDir sets the vendor directory path
+func (g *Generator) SetVendorDir(dir string) {
+	g.vendorDir = dir
+}
+
+// SetOptimize turns on optimize-autoloader: a class map of the PSR-4 and
+// PSR-0 directories is generated and looked up before them.
+func (g *Generator) SetOptimize(optimize bool) {
+	g.optimize = optimize
+}
+
+// SetPlatformCheck sets the platform-check mode: "php-only", "true" or
+// "false".
+func (g *Generator) SetPlatformCheck(mode string) {
+	g.platformCheck = mode
+}
+
 // Generate generates autoload.php and related files
 func (g *Generator) Generate(composer *parser.ComposerJSON, packages []*resolver.Package) error {
 	if err := os.MkdirAll(g.vendorDir, 0755); err != nil {
 		return err
 	}
 
-	if err := g.generateAutoloadPHP(); err != nil {
+	platformCheck, err := g.generatePlatformCheck(composer, packages)
+	if err != nil {
+		return err
+	}
+
+	classmap, err := g.generateClassmap(composer, packages)
+	if err != nil {
+		return err
+	}
+
+	if err := g.generateAutoloadPHP(platformCheck, classmap); err != nil {
 		return err
 	}
 
@@ -49,7 +85,7 @@ func (g *Generator) generateAutoloadFilesPHP(composer *parser.ComposerJSON, pack
 	var sb strings.Builder
 	sb.WriteString("<?php\n\n// autoload_files.php @generated by Presto\n\n")
 	sb.WriteString("$vendorDir = __DIR__;\n")
-	sb.WriteString("$baseDir = dirname($vendorDir);\n\n")
+	sb.WriteString("$baseDir = " + g.baseDirPHP() + ";\n\n")
 
 	// 1. Root Project Files
 	processRootFiles := func(config parser.AutoloadConfig) {
@@ -87,7 +123,7 @@ func (g *Generator) generateAutoloadFilesPHP(composer *parser.ComposerJSON, pack
 }
 
 // generateAutoloadPHP generates the main autoload.php file, dummy ClassLoader, and InstalledVersions
-func (g *Generator) generateAutoloadPHP() error {
+func (g *Generator) generateAutoloadPHP(platformCheck, classmap bool) error {
 	// 1. Create vendor/composer directory
 	composerDir := filepath.Join(g.vendorDir, "composer")
 	if err := os.MkdirAll(composerDir, 0755); err != nil {
@@ -184,13 +220,37 @@ class InstalledVersions
 	// 4. Generate autoload.php content
 	content := `<?php
 // autoload.php @generated by Presto
+`
+	if platformCheck {
+		content += `
+// 0. Fail fast when the platform doesn't match the installed packages
+require __DIR__ . '/composer/platform_check.php';
+`
+	}
+	if classmap {
+		content += `
+// 1. Load the class map and PSR-4 map
+$classMap = require __DIR__ . '/autoload_classmap.php';
+$map = require __DIR__ . '/autoload_psr4.php';
 
+// 2. Register Autoloader
+spl_autoload_register(function ($class) use ($classMap, $map) {
+    if (isset($classMap[$class])) {
+        require $classMap[$class];
+        return true;
+    }
+
+    foreach`
+	} else {
+		content += `
 // 1. Load PSR-4 map
 $map = require __DIR__ . '/autoload_psr4.php';
 
 // 2. Register Autoloader
 spl_autoload_register(function ($class) use ($map) {
-    foreach ($map as $prefix => $paths) {
+    foreach`
+	}
+	content += ` ($map as $prefix => $paths) {
         $len = strlen($prefix);
         if (strncmp($prefix, $class, $len) !== 0) {
             continue;
@@ -277,7 +337,7 @@ func (g *Generator) generatePSR4(composer *parser.ComposerJSON, packages []*reso
 	var mappings strings.Builder
 	mappings.WriteString("<?php\n\n// autoload_psr4.php @generated by Presto\n\n")
 	mappings.WriteString("$vendorDir = __DIR__;\n")
-	mappings.WriteString("$baseDir = dirname($vendorDir);\n\n")
+	mappings.WriteString("$baseDir = " + g.baseDirPHP() + ";\n\n")
 	mappings.WriteString("return array(\n")
 
 	for ns, paths := range psr4Map {
@@ -0,0 +1,122 @@
+package autoload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/resolver"
+)
+
+const platformCheckFooter = `if ($issues) {
+    if (!headers_sent()) {
+        header('HTTP/1.1 500 Internal Server Error');
+    }
+    if (!ini_get('display_errors')) {
+        if (PHP_SAPI === 'cli' || PHP_SAPI === 'phpdbg') {
+            fwrite(STDERR, 'Composer detected issues in your platform:' . PHP_EOL.PHP_EOL . implode(PHP_EOL, $issues) . PHP_EOL.PHP_EOL);
+        } elseif (!headers_sent()) {
+            echo 'Composer detected issues in your platform:' . PHP_EOL.PHP_EOL . str_replace('You are running '.PHP_VERSION.'.', '', implode(PHP_EOL, $issues)) . PHP_EOL.PHP_EOL;
+        }
+    }
+    trigger_error(
+        'Composer detected issues in your platform: ' . implode(' ', $issues),
+        E_USER_ERROR
+    );
+}
+`
+
+// platformCheckMode reads the platform-check setting: "true" checks the PHP
+// version and extensions, "php-only" (the default) only the PHP version, and
+// "false" disables the check.
+func platformCheckMode(mode string) (enabled, extensions bool) {
+	switch mode {
+	case "true":
+		return true, true
+	case "false":
+		return false, false
+	}
+	return true, false
+}
+
+// generatePlatformCheck writes vendor/composer/platform_check.php, which fails
+// at runtime when the PHP version or extensions don't match what the
+// packages require. It returns false, removing any stale file, when there is
+// nothing to check.
+func (g *Generator) generatePlatformCheck(composer *parser.ComposerJSON, packages []*resolver.Package) (bool, error) {
+	path := filepath.Join(g.vendorDir, "composer", "platform_check.php")
+
+	content := ""
+	if enabled, extensions := platformCheckMode(g.platformCheck); enabled {
+		reqs := resolver.CollectRuntimeRequirements(composer, packages, g.ignorePlatform)
+		if !extensions {
+			reqs.Extensions = nil
+		}
+		content = platformCheckPHP(reqs)
+	}
+
+	if content == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// platformCheckPHP renders the checks, or "" when there are none.
+func platformCheckPHP(reqs resolver.RuntimeRequirements) string {
+	if reqs.PHP == "" && !reqs.PHP64Bit && len(reqs.Extensions) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<?php\n\n// platform_check.php @generated by Presto\n\n$issues = array();\n\n")
+
+	if reqs.PHP != "" {
+		operator := ">"
+		if reqs.PHPInclusive {
+			operator = ">="
+		}
+		sb.WriteString(fmt.Sprintf("if (!(PHP_VERSION_ID %s %d)) {\n", operator, phpVersionID(reqs.PHP)))
+		sb.WriteString(fmt.Sprintf("    $issues[] = 'Your Composer dependencies require a PHP version \"%s %s\". You are running ' . PHP_VERSION . '.';\n}\n\n", operator, reqs.PHP))
+	}
+
+	if reqs.PHP64Bit {
+		sb.WriteString("if (PHP_INT_SIZE !== 8) {\n    $issues[] = 'Your Composer dependencies require a 64-bit build of PHP.';\n}\n\n")
+	}
+
+	if len(reqs.Extensions) > 0 {
+		sb.WriteString("$missingExtensions = array();\n")
+		for _, extension := range reqs.Extensions {
+			sb.WriteString(fmt.Sprintf("extension_loaded('%s') || $missingExtensions[] = '%s';\n", extension, extension))
+		}
+		sb.WriteString("\nif ($missingExtensions) {\n    $issues[] = 'Your Composer dependencies require the following PHP extensions to be installed: ' . implode(', ', $missingExtensions) . '.';\n}\n\n")
+	}
+
+	sb.WriteString(platformCheckFooter)
+	return sb.String()
+}
+
+// phpVersionID turns "8.1.0" into PHP_VERSION_ID form, 80100.
+func phpVersionID(version string) int {
+	segments := strings.SplitN(version, ".", 3)
+	id := 0
+	for i, scale := range []int{10000, 100, 1} {
+		if i < len(segments) {
+			n, _ := strconv.Atoi(segments[i])
+			id += n * scale
+		}
+	}
+	return id
+}
@@ -0,0 +1,351 @@
+// Package cache stores files in the user-level cache directory that every
+// project shares. The layout follows Composer's, so COMPOSER_CACHE_DIR can
+// point at an existing Composer cache.
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrOffline is returned for anything that has to come from the network
+// while it is disabled, and isn't cached.
+var ErrOffline = errors.New("not available offline")
+
+// MissingError lists what a command needed from the cache while the network
+// was disabled, but didn't find there.
+type MissingError struct {
+	Items []string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("%d items are not in the cache: %s", len(e.Items), strings.Join(e.Items, ", "))
+}
+
+// VCSDir is the directory that holds git mirrors, one per repository. Each
+// mirror counts as a single entry, so pruning never breaks one up.
+const VCSDir = "vcs"
+
+// FilesDir is the directory that holds dist archives.
+const FilesDir = "files"
+
+// DefaultTTL is how long an entry may go unused before Prune removes it,
+// Composer's default cache-ttl of six months.
+const DefaultTTL = 180 * 24 * time.Hour
+
+// Dir returns the cache directory: $COMPOSER_CACHE_DIR if set, otherwise
+// "presto" under the user cache directory ($XDG_CACHE_HOME or ~/.cache on
+// Linux).
+func Dir() string {
+	if dir := os.Getenv("COMPOSER_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "presto")
+	}
+	return filepath.Join(os.TempDir(), "presto-cache")
+}
+
+// Cache is a directory of files addressed by slash-separated keys such as
+// "repo/https---repo.packagist.org/provider-vendor~name.json". An entry's
+// modification time records when it was last written or revalidated.
+type Cache struct {
+	root    string
+	exclude string
+}
+
+// Entry describes one cached file.
+type Entry struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// New returns a cache rooted at root, which is created on first write.
+func New(root string) *Cache {
+	return &Cache{root: root}
+}
+
+// SetExclude leaves dir out of the cache, for a package store kept under the
+// cache directory: it is neither listed, pruned nor cleared.
+func (c *Cache) SetExclude(dir string) {
+	c.exclude = dir
+}
+
+// excluded reports whether path is the excluded directory, and within reports
+// whether the excluded directory is under path.
+func (c *Cache) excluded(path string) (excluded, within bool) {
+	if c.exclude == "" {
+		return false, false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, false
+	}
+	exclude, err := filepath.Abs(c.exclude)
+	if err != nil {
+		return false, false
+	}
+	rel, err := filepath.Rel(abs, exclude)
+	if err != nil || !filepath.IsLocal(rel) {
+		return false, false
+	}
+	return rel == ".", true
+}
+
+// Root returns the cache directory.
+func (c *Cache) Root() string {
+	return c.root
+}
+
+// Path returns the file that holds key.
+func (c *Cache) Path(key string) string {
+	return filepath.Join(c.root, filepath.FromSlash(key))
+}
+
+// Has reports whether key is cached.
+func (c *Cache) Has(key string) bool {
+	_, err := os.Stat(c.Path(key))
+	return err == nil
+}
+
+// Read returns the contents of key and when it was last written or touched.
+func (c *Cache) Read(key string) ([]byte, time.Time, error) {
+	path := c.Path(key)
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, stat.ModTime(), nil
+}
+
+// Write stores data under key.
+func (c *Cache) Write(key string, data []byte) error {
+	return c.CopyFrom(key, bytes.NewReader(data))
+}
+
+// CopyFrom stores everything read from r under key. The file is replaced
+// atomically, so concurrent readers see either the old or the new contents.
+func (c *Cache) CopyFrom(key string, r io.Reader) error {
+	path := c.Path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Touch marks key as fresh without rewriting it.
+func (c *Cache) Touch(key string) error {
+	now := time.Now()
+	return os.Chtimes(c.Path(key), now, now)
+}
+
+// Entries lists every cached file, and every mirror under VCSDir, sorted by
+// key. A missing cache directory has no entries.
+func (c *Cache) Entries() ([]Entry, error) {
+	entries, _, err := c.entries(c.root)
+	return entries, err
+}
+
+// entries lists the entries under dir, which is the cache directory or one
+// of its subdirectories. Temporary files and mirrors, named ".tmp-*", aren't
+// entries: those left for more than an hour by an interrupted write are
+// returned as stale, to be removed.
+func (c *Cache) entries(dir string) (entries []Entry, stale []string, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(c.root, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			if time.Since(info.ModTime()) > time.Hour {
+				stale = append(stale, path)
+			}
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if excluded, _ := c.excluded(path); excluded {
+				return fs.SkipDir
+			}
+			if filepath.Dir(rel) != VCSDir {
+				return nil
+			}
+			size, err := dirSize(path)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, Entry{Key: filepath.ToSlash(rel), Size: size, ModTime: info.ModTime()})
+			return fs.SkipDir
+		}
+
+		entries = append(entries, Entry{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, stale, nil
+}
+
+// removeStale removes what interrupted writes left behind.
+func removeStale(paths []string) error {
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size returns the number of cached files and their total size in bytes.
+func (c *Cache) Size() (files int, size int64, err error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, e := range entries {
+		size += e.Size
+	}
+	return len(entries), size, nil
+}
+
+// Prune removes the entries that haven't been written or touched within
+// maxAge, and returns them. Stale temporary files go too, unreported.
+func (c *Cache) Prune(maxAge time.Duration) ([]Entry, error) {
+	entries, stale, err := c.entries(c.root)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeStale(stale); err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var removed []Entry
+	for _, e := range entries {
+		if !e.ModTime.Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(c.Path(e.Key)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+// GC removes the entries under dir, such as FilesDir, that haven't been
+// written or touched within ttl, and then the least recently used ones until
+// the rest take up at most maxSize bytes. It returns what it removed, besides
+// stale temporary files. A ttl or maxSize of 0 is no limit.
+func (c *Cache) GC(dir string, ttl time.Duration, maxSize int64) ([]Entry, error) {
+	entries, stale, err := c.entries(c.Path(dir))
+	if err != nil {
+		return nil, err
+	}
+	if err := removeStale(stale); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].ModTime.Before(entries[j].ModTime) })
+
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	cutoff := time.Now().Add(-ttl)
+	var removed []Entry
+	for _, e := range entries {
+		expired := ttl > 0 && e.ModTime.Before(cutoff)
+		if !expired && (maxSize <= 0 || size <= maxSize) {
+			break
+		}
+		if err := os.RemoveAll(c.Path(e.Key)); err != nil {
+			return removed, err
+		}
+		size -= e.Size
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// Clear removes the whole cache directory, but for the excluded one.
+func (c *Cache) Clear() error {
+	return c.clear(c.root)
+}
+
+func (c *Cache) clear(dir string) error {
+	if excluded, within := c.excluded(dir); excluded {
+		return nil
+	} else if !within {
+		return os.RemoveAll(dir)
+	}
+	names, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := c.clear(filepath.Join(dir, name.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCache_EntriesAndPrune(t *testing.T) {
+	c := New(t.TempDir())
+
+	for key, data := range map[string]string{
+		"repo/example/provider-a~a.json": "aa",
+		"repo/example/provider-b~b.json": "bbb",
+		"files/c/c.zip":                  "c",
+	} {
+		if err := c.Write(key, []byte(data)); err != nil {
+			t.Fatalf("Write(%s) returned error: %v", key, err)
+		}
+	}
+
+	files, bytes, err := c.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 3 || bytes != 6 {
+		t.Errorf("Size() = %d files, %d bytes, want 3 files, 6 bytes", files, bytes)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := c.Touch("repo/example/provider-a~a.json"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"repo/example/provider-b~b.json", "files/c/c.zip"} {
+		if err := os.Chtimes(c.Path(key), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := c.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Prune() returned error: %v", err)
+	}
+	var keys []string
+	for _, e := range removed {
+		keys = append(keys, e.Key)
+	}
+	if want := []string{"files/c/c.zip", "repo/example/provider-b~b.json"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Prune() removed %v, want %v", keys, want)
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "repo/example/provider-a~a.json" {
+		t.Errorf("Entries() after prune = %v, want only provider-a~a.json", entries)
+	}
+
+	data, _, err := c.Read("repo/example/provider-a~a.json")
+	if err != nil || string(data) != "aa" {
+		t.Errorf("Read() = %q, %v, want \"aa\"", data, err)
+	}
+}
+
+func TestCache_GC(t *testing.T) {
+	c := New(t.TempDir())
+
+	// Oldest first: a is past the TTL, b and c are within it.
+	for i, key := range []string{"files/a/a.zip", "files/b/b.zip", "files/c/c.zip", "repo/example/packages.json"} {
+		if err := c.Write(key, []byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		used := time.Now().Add(-time.Duration(10-i) * 24 * time.Hour)
+		if err := os.Chtimes(c.Path(key), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := c.GC(FilesDir, 9*24*time.Hour+time.Hour, 0)
+	if err != nil {
+		t.Fatalf("GC() returned error: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Key != "files/a/a.zip" {
+		t.Errorf("GC() by TTL removed %v, want files/a/a.zip", removed)
+	}
+
+	// Touching b makes c the least recently used.
+	if err := c.Touch("files/b/b.zip"); err != nil {
+		t.Fatal(err)
+	}
+	removed, err = c.GC(FilesDir, 0, 15)
+	if err != nil {
+		t.Fatalf("GC() returned error: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Key != "files/c/c.zip" {
+		t.Errorf("GC() by size removed %v, want files/c/c.zip", removed)
+	}
+	if !c.Has("files/b/b.zip") || !c.Has("repo/example/packages.json") {
+		t.Error("GC() removed a recently used archive, or something outside files/")
+	}
+
+	if removed, err := New(t.TempDir()).GC(FilesDir, time.Hour, 1); err != nil || len(removed) != 0 {
+		t.Errorf("GC() of an empty cache = %v, %v, want nothing", removed, err)
+	}
+}
+
+func TestCache_MirrorIsOneEntry(t *testing.T) {
+	c := New(t.TempDir())
+	for _, key := range []string{"vcs/example/HEAD", "vcs/example/objects/ab/cdef"} {
+		if err := c.Write(key, []byte("xx")); err != nil {
+			t.Fatalf("Write(%s) returned error: %v", key, err)
+		}
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "vcs/example" || entries[0].Size != 4 {
+		t.Fatalf("Entries() = %v, want vcs/example with 4 bytes", entries)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(c.Path("vcs/example"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Prune(24 * time.Hour); err != nil {
+		t.Fatalf("Prune() returned error: %v", err)
+	}
+	if c.Has("vcs/example") {
+		t.Error("Prune() left the stale mirror behind")
+	}
+}
+
+func TestCache_ExcludedStore(t *testing.T) {
+	c := New(t.TempDir())
+	c.SetExclude(c.Path("files/store"))
+	for _, key := range []string{"files/acme/lib/1.0.0-abc.zip", "files/store/v1/ab/cdef/files/composer.json", "repo/example/packages.json"} {
+		if err := c.Write(key, []byte("xx")); err != nil {
+			t.Fatalf("Write(%s) returned error: %v", key, err)
+		}
+		old := time.Now().Add(-48 * time.Hour)
+		os.Chtimes(c.Path(key), old, old)
+	}
+	stored := c.Path("files/store/v1/ab/cdef/files/composer.json")
+
+	entries, err := c.Entries()
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Entries() = %v, %v, want the store left out", entries, err)
+	}
+	if _, err := c.Prune(24 * time.Hour); err != nil {
+		t.Fatalf("Prune() returned error: %v", err)
+	}
+	if _, err := os.Stat(stored); err != nil {
+		t.Errorf("Prune() removed a stored file: %v", err)
+	}
+	if c.Has("files/acme/lib/1.0.0-abc.zip") {
+		t.Error("Prune() left a stale archive behind")
+	}
+
+	c.Write("repo/example/packages.json", []byte("xx"))
+	if err := c.Clear(); err != nil {
+		t.Fatalf("Clear() returned error: %v", err)
+	}
+	if _, err := os.Stat(stored); err != nil {
+		t.Errorf("Clear() removed a stored file: %v", err)
+	}
+	if c.Has("repo/example/packages.json") {
+		t.Error("Clear() left a cached file behind")
+	}
+}
+
+func TestCache_TempFiles(t *testing.T) {
+	c := New(t.TempDir())
+	for _, key := range []string{"files/acme/lib/1.0.0-abc.zip", "files/acme/lib/.tmp-123", "files/acme/lib/.tmp-456", "vcs/.tmp-789/HEAD"} {
+		if err := c.Write(key, []byte("xx")); err != nil {
+			t.Fatalf("Write(%s) returned error: %v", key, err)
+		}
+	}
+	// Left by an interrupted write, unlike one still being written.
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(c.Path("files/acme/lib/.tmp-123"), old, old)
+	os.Chtimes(c.Path("vcs/.tmp-789"), old, old)
+
+	entries, err := c.Entries()
+	if err != nil || len(entries) != 1 || entries[0].Key != "files/acme/lib/1.0.0-abc.zip" {
+		t.Errorf("Entries() = %v, %v, want only the archive", entries, err)
+	}
+
+	removed, err := c.GC(FilesDir, time.Hour, 0)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("GC() = %v, %v, want nothing reported", removed, err)
+	}
+	if c.Has("files/acme/lib/.tmp-123") || !c.Has("files/acme/lib/.tmp-456") {
+		t.Error("GC() should remove the stale temporary file and keep the fresh one")
+	}
+	if removed, err := c.Prune(24 * time.Hour); err != nil || len(removed) != 0 {
+		t.Errorf("Prune() = %v, %v, want nothing reported", removed, err)
+	}
+	if c.Has("vcs/.tmp-789") {
+		t.Error("Prune() left a stale temporary mirror behind")
+	}
+}
+
+func TestCache_MissingDirectory(t *testing.T) {
+	c := New(t.TempDir() + "/missing")
+
+	entries, err := c.Entries()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Entries() = %v, %v, want no entries", entries, err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("COMPOSER_CACHE_DIR", "/tmp/composer-cache")
+	if got := Dir(); got != "/tmp/composer-cache" {
+		t.Errorf("Dir() = %q, want $COMPOSER_CACHE_DIR", got)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	t.Setenv("COMPOSER_CACHE_DIR", "")
+	t.Setenv("XDG_CACHE_HOME", "/tmp/xdg")
+	if got := Dir(); got != "/tmp/xdg/presto" {
+		t.Errorf("Dir() = %q, want /tmp/xdg/presto", got)
+	}
+}
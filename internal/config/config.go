@@ -0,0 +1,490 @@
+// Package config reads Composer's configuration. Every setting is taken from
+// the last of these that sets it: the default, the global config.json in
+// Composer's home, the project's composer.json "config" and the COMPOSER_*
+// environment variable.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aras/presto/internal/cache"
+	"github.com/aras/presto/internal/parser"
+)
+
+// Source tells where the value of a setting comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceGlobal  Source = "global"
+	SourceProject Source = "project"
+	SourceEnv     Source = "env"
+)
+
+type kind int
+
+const (
+	kindDir kind = iota
+	kindSeconds
+	kindBool
+	kindPlatform
+	kindInstall
+	kindSize
+	kindStrategy
+	kindPlatformCheck
+)
+
+// setting describes a configuration key: the type of its value and the
+// environment variable that overrides it, if any.
+type setting struct {
+	kind kind
+	env  string
+}
+
+var settings = map[string]setting{
+	"vendor-dir":          {kindDir, "COMPOSER_VENDOR_DIR"},
+	"bin-dir":             {kindDir, "COMPOSER_BIN_DIR"},
+	"cache-dir":           {kindDir, "COMPOSER_CACHE_DIR"},
+	"process-timeout":     {kindSeconds, "COMPOSER_PROCESS_TIMEOUT"},
+	"platform":            {kindPlatform, ""},
+	"preferred-install":   {kindInstall, ""},
+	"optimize-autoloader": {kindBool, ""},
+	"cache-files-ttl":     {kindSeconds, ""},
+	"cache-files-maxsize": {kindSize, ""},
+	"install-strategy":    {kindStrategy, ""},
+	"store-dir":           {kindDir, ""},
+	"platform-check":      {kindPlatformCheck, "COMPOSER_PLATFORM_CHECK"},
+}
+
+func defaults() map[string]interface{} {
+	return map[string]interface{}{
+		"vendor-dir":          "vendor",
+		"bin-dir":             "{$vendor-dir}/bin",
+		"cache-dir":           cache.Dir(),
+		"process-timeout":     300,
+		"platform":            map[string]interface{}{},
+		"preferred-install":   "dist",
+		"optimize-autoloader": false,
+		"cache-files-ttl":     int(cache.DefaultTTL / time.Second),
+		"cache-files-maxsize": "300MiB",
+		"install-strategy":    "extract",
+		"store-dir":           "{$cache-dir}-store",
+		"platform-check":      "php-only",
+	}
+}
+
+// Config is the configuration the project is installed with.
+type Config struct {
+	VendorDir          string
+	BinDir             string
+	CacheDir           string
+	ProcessTimeout     time.Duration // 0 for no limit
+	Platform           map[string]interface{}
+	PreferredInstall   PreferredInstall
+	OptimizeAutoloader bool
+	CacheFilesTTL      time.Duration // 0 for no limit
+	CacheFilesMaxSize  int64         // bytes, 0 for no limit
+	InstallStrategy    string        // "extract", or "store" to link packages from StoreDir
+	StoreDir           string
+	PlatformCheck      string // "php-only", or "true" to check extensions too, or "false"
+
+	home    string
+	values  map[string]interface{}
+	sources map[string]Source
+}
+
+// Home returns Composer's home directory, which holds the global config.json
+// and auth.json: $COMPOSER_HOME, or ~/.composer if it exists, or else
+// composer under the user config directory (~/.config/composer on Linux).
+func Home() string {
+	if dir := os.Getenv("COMPOSER_HOME"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if _, err := os.Stat(filepath.Join(home, ".composer")); err == nil {
+			return filepath.Join(home, ".composer")
+		}
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "composer")
+	}
+	return ""
+}
+
+// GlobalFile returns the path of the global config.json in home.
+func GlobalFile(home string) string {
+	return filepath.Join(home, "config.json")
+}
+
+// Load reads the configuration of the project described by composer, which
+// may be nil outside of a project, on top of the global config.json in home.
+func Load(home string, composer *parser.ComposerJSON) (*Config, error) {
+	c := &Config{home: home, values: defaults(), sources: make(map[string]Source)}
+	for key := range settings {
+		c.sources[key] = SourceDefault
+	}
+
+	global, err := ReadGlobal(home)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.merge(global, SourceGlobal); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", GlobalFile(home), err)
+	}
+	if composer != nil {
+		if err := c.merge(composer.Config, SourceProject); err != nil {
+			return nil, fmt.Errorf("invalid config in composer.json: %w", err)
+		}
+	}
+
+	for key, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		env := os.Getenv(s.env)
+		if env == "" {
+			continue
+		}
+		value, err := parseArg(s.kind, env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+		c.values[key], c.sources[key] = value, SourceEnv
+	}
+
+	if err := c.apply(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// merge sets the known keys of a "config" section, validating their values.
+// Like Composer, platform packages are merged with those set before, and so
+// are preferred-install patterns.
+func (c *Config) merge(section map[string]interface{}, source Source) error {
+	for key, raw := range section {
+		s, ok := settings[key]
+		if !ok {
+			continue
+		}
+		value, err := check(s.kind, raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		if m, ok := value.(map[string]interface{}); ok {
+			if prev, ok := c.values[key].(map[string]interface{}); ok {
+				merged := make(map[string]interface{}, len(prev)+len(m))
+				for k, v := range prev {
+					merged[k] = v
+				}
+				for k, v := range m {
+					merged[k] = v
+				}
+				value = merged
+			}
+		}
+		c.values[key], c.sources[key] = value, source
+	}
+	return nil
+}
+
+// apply fills the typed fields from the merged values.
+func (c *Config) apply() error {
+	for key, field := range map[string]*string{
+		"vendor-dir": &c.VendorDir,
+		"bin-dir":    &c.BinDir,
+		"cache-dir":  &c.CacheDir,
+		"store-dir":  &c.StoreDir,
+	} {
+		dir, err := c.dir(key, make(map[string]bool))
+		if err != nil {
+			return err
+		}
+		*field = dir
+	}
+	c.ProcessTimeout = time.Duration(c.values["process-timeout"].(int)) * time.Second
+	c.Platform = c.values["platform"].(map[string]interface{})
+	c.OptimizeAutoloader = c.values["optimize-autoloader"].(bool)
+	c.CacheFilesTTL = time.Duration(c.values["cache-files-ttl"].(int)) * time.Second
+	c.CacheFilesMaxSize, _ = parseSize(fmt.Sprint(c.values["cache-files-maxsize"]))
+	c.InstallStrategy = c.values["install-strategy"].(string)
+	c.PlatformCheck = fmt.Sprint(c.values["platform-check"])
+
+	switch v := c.values["preferred-install"].(type) {
+	case string:
+		c.PreferredInstall = PreferredInstall{"*": v}
+	case map[string]interface{}:
+		c.PreferredInstall = make(PreferredInstall, len(v))
+		for pattern, mode := range v {
+			c.PreferredInstall[pattern] = mode.(string)
+		}
+	}
+	return nil
+}
+
+// dir returns the directory setting key with {$home}, {$vendor-dir} and
+// {$cache-dir} replaced. expanding holds the keys being expanded, so that a
+// setting referring back to itself is an error rather than endless.
+func (c *Config) dir(key string, expanding map[string]bool) (string, error) {
+	if expanding[key] {
+		return "", fmt.Errorf("%s refers to itself", key)
+	}
+	expanding[key] = true
+	defer delete(expanding, key)
+
+	dir := strings.ReplaceAll(c.values[key].(string), "{$home}", c.home)
+	for _, ref := range []string{"vendor-dir", "cache-dir"} {
+		if v := "{$" + ref + "}"; strings.Contains(dir, v) {
+			expanded, err := c.dir(ref, expanding)
+			if err != nil {
+				return "", err
+			}
+			dir = strings.ReplaceAll(dir, v, strings.TrimRight(expanded, `/\`))
+		}
+	}
+	return dir, nil
+}
+
+// Keys lists the settings Presto knows, sorted.
+func Keys() []string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Get returns the value of key, which may name a platform package or
+// preferred-install pattern after a dot, as in "platform.php".
+func (c *Config) Get(key string) (interface{}, error) {
+	name, sub, dotted := strings.Cut(key, ".")
+	if _, ok := settings[name]; !ok {
+		return nil, fmt.Errorf("unknown config key %q", key)
+	}
+
+	value := c.values[name]
+	if settings[name].kind == kindDir {
+		dir, err := c.dir(name, make(map[string]bool))
+		if err != nil {
+			return nil, err
+		}
+		value = dir
+	}
+	if !dotted {
+		return value, nil
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		if v, ok := m[sub]; ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("config key %q is not set", key)
+}
+
+// Source returns where the value of key comes from.
+func (c *Config) Source(key string) Source {
+	name, _, _ := strings.Cut(key, ".")
+	return c.sources[name]
+}
+
+// Format renders a value for printing: maps as JSON, the rest as is.
+func Format(value interface{}) string {
+	if m, ok := value.(map[string]interface{}); ok {
+		data, _ := json.Marshal(m)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// PreferredInstall is preferred-install: "dist", "source" or "auto" by
+// package name pattern, where "*" matches any characters. A single mode is
+// stored under "*".
+type PreferredInstall map[string]string
+
+// Source reports whether the package should be installed from source, as a
+// clone of its repository, rather than from its dist archive. The most
+// specific matching pattern wins; "auto" picks source for dev versions.
+func (p PreferredInstall) Source(name, version string) bool {
+	mode, best := "dist", -1
+	for pattern, m := range p {
+		if len(pattern) > best && matchPattern(pattern, name) {
+			mode, best = m, len(pattern)
+		}
+	}
+
+	switch mode {
+	case "source":
+		return true
+	case "auto":
+		return strings.HasPrefix(version, "dev-") || strings.HasSuffix(version, "-dev")
+	}
+	return false
+}
+
+func matchPattern(pattern, name string) bool {
+	expr := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(pattern)), `\*`, ".*")
+	return regexp.MustCompile("^" + expr + "$").MatchString(strings.ToLower(name))
+}
+
+// check validates a value read from a configuration file and returns it in
+// the form Config keeps: whole seconds as int, platform and preferred-install
+// patterns as maps.
+func check(k kind, value interface{}) (interface{}, error) {
+	switch k {
+	case kindDir:
+		if s, ok := value.(string); ok && s != "" {
+			return s, nil
+		}
+		return nil, fmt.Errorf("expected a path, got %v", value)
+	case kindSeconds:
+		switch v := value.(type) {
+		case float64:
+			if v >= 0 && v == float64(int(v)) {
+				return int(v), nil
+			}
+		case int:
+			if v >= 0 {
+				return v, nil
+			}
+		case string:
+			return parseArg(k, v)
+		}
+		return nil, fmt.Errorf("expected a number of seconds, got %v", value)
+	case kindBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("expected true or false, got %v", value)
+	case kindPlatform:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object of package versions, got %v", value)
+		}
+		res := make(map[string]interface{}, len(m))
+		for name, v := range m {
+			switch v.(type) {
+			case string, bool:
+				res[strings.ToLower(name)] = v
+			default:
+				return nil, fmt.Errorf("%s: expected a version or false, got %v", name, v)
+			}
+		}
+		return res, nil
+	case kindInstall:
+		switch v := value.(type) {
+		case string:
+			if err := checkInstallMode(v); err != nil {
+				return nil, err
+			}
+			return v, nil
+		case map[string]interface{}:
+			res := make(map[string]interface{}, len(v))
+			for pattern, mode := range v {
+				s, _ := mode.(string)
+				if err := checkInstallMode(s); err != nil {
+					return nil, fmt.Errorf("%s: %w", pattern, err)
+				}
+				res[pattern] = s
+			}
+			return res, nil
+		}
+		return nil, fmt.Errorf("expected dist, source, auto or an object of them, got %v", value)
+	case kindSize:
+		switch v := value.(type) {
+		case float64:
+			if v >= 0 && v == float64(int(v)) {
+				return int(v), nil
+			}
+		case int:
+			if v >= 0 {
+				return v, nil
+			}
+		case string:
+			if _, err := parseSize(v); err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a size such as 300MiB, got %v", value)
+	case kindStrategy:
+		if s, ok := value.(string); ok && (s == "extract" || s == "store") {
+			return s, nil
+		}
+		return nil, fmt.Errorf("expected extract or store, got %v", value)
+	case kindPlatformCheck:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if v == "php-only" {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("expected true, false or php-only, got %v", value)
+	}
+	return value, nil
+}
+
+// sizePattern matches a size the way Composer reads cache-files-maxsize: a
+// number of bytes, or of KiB, MiB or GiB after k, m or g, with an optional
+// "b" or "ib".
+var sizePattern = regexp.MustCompile(`(?i)^\s*([0-9]+(?:\.[0-9]+)?)\s*(?:([kmg])(?:i?b)?)?\s*$`)
+
+// parseSize returns the number of bytes in a size such as "300MiB".
+func parseSize(s string) (int64, error) {
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("expected a size such as 300MiB, got %q", s)
+	}
+	size, _ := strconv.ParseFloat(m[1], 64)
+	switch strings.ToLower(m[2]) {
+	case "g":
+		size *= 1 << 30
+	case "m":
+		size *= 1 << 20
+	case "k":
+		size *= 1 << 10
+	}
+	return int64(size), nil
+}
+
+func checkInstallMode(mode string) error {
+	switch mode {
+	case "dist", "source", "auto":
+		return nil
+	}
+	return fmt.Errorf("expected dist, source or auto, got %q", mode)
+}
+
+// parseArg parses a value given on the command line or in the environment.
+func parseArg(k kind, arg string) (interface{}, error) {
+	switch k {
+	case kindSeconds:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("expected a number of seconds, got %q", arg)
+		}
+		return n, nil
+	case kindBool, kindPlatformCheck:
+		switch arg {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+		if k == kindBool {
+			return nil, fmt.Errorf("expected true or false, got %q", arg)
+		}
+	}
+	return check(k, arg)
+}
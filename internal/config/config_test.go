@@ -0,0 +1,305 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+func TestLoad(t *testing.T) {
+	home := t.TempDir()
+	os.WriteFile(GlobalFile(home), []byte(`{
+		"config": {
+			"cache-dir": "{$home}/cache",
+			"process-timeout": 600,
+			"platform": {"php": "8.1.0", "ext-redis": "5.3.7"},
+			"preferred-install": "source",
+			"platform-check": false
+		},
+		"repositories": []
+	}`), 0644)
+	composer := &parser.ComposerJSON{Config: map[string]interface{}{
+		"vendor-dir":        "lib/vendor",
+		"platform":          map[string]interface{}{"PHP": "8.2.0", "ext-xdebug": false},
+		"sort-packages":     true,
+		"preferred-install": map[string]interface{}{"acme/*": "dist"},
+	}}
+	t.Setenv("COMPOSER_CACHE_DIR", "")
+	t.Setenv("COMPOSER_VENDOR_DIR", "")
+	t.Setenv("COMPOSER_BIN_DIR", "")
+	t.Setenv("COMPOSER_PROCESS_TIMEOUT", "0")
+	t.Setenv("COMPOSER_PLATFORM_CHECK", "")
+
+	cfg, err := Load(home, composer)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	if cfg.VendorDir != "lib/vendor" || cfg.BinDir != "lib/vendor/bin" {
+		t.Errorf("vendor-dir, bin-dir = %q, %q, want lib/vendor and lib/vendor/bin", cfg.VendorDir, cfg.BinDir)
+	}
+	if want := filepath.Join(home, "cache"); filepath.Clean(cfg.CacheDir) != want {
+		t.Errorf("cache-dir = %q, want %q", cfg.CacheDir, want)
+	}
+	if want := filepath.Join(home, "cache-store"); filepath.Clean(cfg.StoreDir) != want || cfg.InstallStrategy != "extract" {
+		t.Errorf("store-dir, install-strategy = %q, %q, want %q next to cache-dir and extract", cfg.StoreDir, cfg.InstallStrategy, want)
+	}
+	if cfg.ProcessTimeout != 0 {
+		t.Errorf("process-timeout = %s, want COMPOSER_PROCESS_TIMEOUT's 0", cfg.ProcessTimeout)
+	}
+	want := map[string]interface{}{"php": "8.2.0", "ext-redis": "5.3.7", "ext-xdebug": false}
+	if !reflect.DeepEqual(cfg.Platform, want) {
+		t.Errorf("platform = %v, want %v", cfg.Platform, want)
+	}
+	if cfg.OptimizeAutoloader {
+		t.Error("optimize-autoloader = true, want the default false")
+	}
+	if cfg.PlatformCheck != "false" {
+		t.Errorf("platform-check = %q, want the global false", cfg.PlatformCheck)
+	}
+	if cfg.CacheFilesTTL != 180*24*time.Hour || cfg.CacheFilesMaxSize != 300<<20 {
+		t.Errorf("cache-files-ttl, cache-files-maxsize = %s, %d, want the defaults of 180 days and 300MiB", cfg.CacheFilesTTL, cfg.CacheFilesMaxSize)
+	}
+
+	sources := map[string]Source{
+		"vendor-dir":          SourceProject,
+		"bin-dir":             SourceDefault,
+		"cache-dir":           SourceGlobal,
+		"process-timeout":     SourceEnv,
+		"platform.php":        SourceProject,
+		"optimize-autoloader": SourceDefault,
+	}
+	for key, want := range sources {
+		if got := cfg.Source(key); got != want {
+			t.Errorf("Source(%s) = %s, want %s", key, got, want)
+		}
+	}
+
+	if v, err := cfg.Get("platform.ext-redis"); err != nil || v != "5.3.7" {
+		t.Errorf("Get(platform.ext-redis) = %v, %v, want 5.3.7", v, err)
+	}
+	if _, err := cfg.Get("platform.ext-missing"); err == nil {
+		t.Error("Get() of an unset platform package expected an error")
+	}
+	if _, err := cfg.Get("sort-packages"); err == nil {
+		t.Error("Get() of an unknown key expected an error")
+	}
+
+	t.Setenv("COMPOSER_PROCESS_TIMEOUT", "")
+	t.Setenv("COMPOSER_PLATFORM_CHECK", "php-only")
+	cfg, _ = Load(home, nil)
+	if cfg.VendorDir != "vendor" || cfg.ProcessTimeout != 600*time.Second {
+		t.Errorf("without a project: vendor-dir, process-timeout = %q, %s, want vendor and 10m", cfg.VendorDir, cfg.ProcessTimeout)
+	}
+	if cfg.PlatformCheck != "php-only" {
+		t.Errorf("platform-check = %q, want COMPOSER_PLATFORM_CHECK's php-only", cfg.PlatformCheck)
+	}
+
+	composer.Config["process-timeout"] = "soon"
+	if _, err := Load(home, composer); err == nil || !strings.Contains(err.Error(), "process-timeout") {
+		t.Errorf("Load() with an invalid process-timeout = %v, want an error naming it", err)
+	}
+
+	delete(composer.Config, "process-timeout")
+	composer.Config["vendor-dir"] = "{$cache-dir}/vendor"
+	composer.Config["cache-dir"] = "{$vendor-dir}/cache"
+	if _, err := Load(home, composer); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+		t.Errorf("Load() with vendor-dir and cache-dir referring to each other = %v, want an error", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"1024":      1024,
+		"300MiB":    300 << 20,
+		"1.5g":      3 << 29,
+		"  512 KB ": 512 << 10,
+		"2M":        2 << 20,
+	}
+	for arg, want := range tests {
+		if got, err := parseSize(arg); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", arg, got, err, want)
+		}
+	}
+	for _, arg := range []string{"", "MiB", "-1", "10 TB", "1.2.3M"} {
+		if _, err := parseSize(arg); err == nil {
+			t.Errorf("parseSize(%q) expected an error", arg)
+		}
+	}
+}
+
+func TestPreferredInstall_Source(t *testing.T) {
+	p := PreferredInstall{"*": "dist", "acme/*": "source", "acme/legacy": "dist", "dev/*": "auto"}
+
+	tests := []struct {
+		name, version string
+		want          bool
+	}{
+		{"other/lib", "1.0.0", false},
+		{"acme/lib", "1.0.0", true},
+		{"Acme/Lib", "1.0.0", true},
+		{"acme/legacy", "1.0.0", false},
+		{"dev/lib", "1.0.0", false},
+		{"dev/lib", "dev-main", true},
+		{"dev/lib", "2.x-dev", true},
+	}
+	for _, tt := range tests {
+		if got := p.Source(tt.name, tt.version); got != tt.want {
+			t.Errorf("Source(%s, %s) = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+
+	if (PreferredInstall)(nil).Source("acme/lib", "dev-main") {
+		t.Error("an unset preferred-install picked source, want dist")
+	}
+}
+
+func TestSetUnset(t *testing.T) {
+	section := map[string]interface{}{"preferred-install": "dist"}
+
+	for _, kv := range [][2]string{
+		{"vendor-dir", "lib"},
+		{"process-timeout", "60"},
+		{"optimize-autoloader", "true"},
+		{"cache-files-maxsize", "1GiB"},
+		{"platform.PHP", "8.2.0"},
+		{"platform.ext-xdebug", "false"},
+		{"preferred-install.acme/*", "source"},
+		{"platform-check", "false"},
+	} {
+		if err := Set(section, kv[0], kv[1]); err != nil {
+			t.Fatalf("Set(%s, %s) returned error: %v", kv[0], kv[1], err)
+		}
+	}
+
+	want := map[string]interface{}{
+		"vendor-dir":          "lib",
+		"process-timeout":     60,
+		"optimize-autoloader": true,
+		"cache-files-maxsize": "1GiB",
+		"platform":            map[string]interface{}{"php": "8.2.0", "ext-xdebug": false},
+		"preferred-install":   map[string]interface{}{"*": "dist", "acme/*": "source"},
+		"platform-check":      false,
+	}
+	if !reflect.DeepEqual(section, want) {
+		t.Errorf("after Set: %v, want %v", section, want)
+	}
+
+	for _, kv := range [][2]string{
+		{"sort-packages", "true"},
+		{"vendor-dir.x", "lib"},
+		{"platform", "8.2.0"},
+		{"process-timeout", "-1"},
+		{"optimize-autoloader", "yes"},
+		{"preferred-install", "clone"},
+		{"cache-files-maxsize", "lots"},
+		{"install-strategy", "hardlink"},
+		{"platform-check", "extensions"},
+		{"vendor-dir", "{$vendor-dir}/x"},
+	} {
+		if err := Set(section, kv[0], kv[1]); err == nil {
+			t.Errorf("Set(%s, %s) expected an error", kv[0], kv[1])
+		}
+	}
+	cycle := map[string]interface{}{"vendor-dir": "{$cache-dir}/vendor"}
+	if err := Set(cycle, "cache-dir", "{$vendor-dir}/cache"); err == nil {
+		t.Error("Set() of a cache-dir that vendor-dir refers back to expected an error")
+	}
+
+	for _, key := range []string{"vendor-dir", "platform.php", "platform.ext-xdebug"} {
+		if err := Unset(section, key); err != nil {
+			t.Fatalf("Unset(%s) returned error: %v", key, err)
+		}
+	}
+	if _, ok := section["vendor-dir"]; ok {
+		t.Error("vendor-dir still set after Unset")
+	}
+	if _, ok := section["platform"]; ok {
+		t.Error("empty platform left behind after unsetting its packages")
+	}
+}
+
+func TestWriteGlobal(t *testing.T) {
+	home := filepath.Join(t.TempDir(), "composer")
+	if err := WriteGlobal(home, map[string]interface{}{"vendor-dir": "lib"}); err != nil {
+		t.Fatalf("WriteGlobal() returned error: %v", err)
+	}
+	os.WriteFile(GlobalFile(home), []byte(`{"config": {"vendor-dir": "lib"}, "repositories": [{"type": "vcs", "url": "x"}]}`), 0644)
+
+	if err := WriteGlobal(home, map[string]interface{}{"bin-dir": "bin"}); err != nil {
+		t.Fatalf("WriteGlobal() returned error: %v", err)
+	}
+	data, _ := os.ReadFile(GlobalFile(home))
+	if !strings.Contains(string(data), `"repositories"`) || strings.Contains(string(data), "vendor-dir") {
+		t.Errorf("config.json = %s, want the new config and the repositories kept", data)
+	}
+
+	section, err := ReadGlobal(home)
+	if err != nil || !reflect.DeepEqual(section, map[string]interface{}{"bin-dir": "bin"}) {
+		t.Errorf("ReadGlobal() = %v, %v, want the bin-dir just written", section, err)
+	}
+}
+
+func TestWriteProject(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "composer.json")
+	original := `{
+  "name": "acme/app",
+  "homepage": "https://example.com",
+  "keywords": ["app", "acme"],
+  "require": {
+    "php": ">=8.1",
+    "acme/lib": "^1.0 || >2.0 <3.0"
+  },
+  "config": {
+    "sort-packages": true
+  },
+  "suggest": {
+    "ext-redis": "For <caching> & sessions"
+  }
+}
+`
+	os.WriteFile(path, []byte(original), 0644)
+
+	section := map[string]interface{}{"sort-packages": true}
+	if err := Set(section, "vendor-dir", "lib"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteProject(path, section); err != nil {
+		t.Fatalf("WriteProject() returned error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := strings.Replace(original, `"sort-packages": true
+  }`, `"sort-packages": true,
+    "vendor-dir": "lib"
+  }`, 1)
+	if string(data) != want {
+		t.Errorf("composer.json =\n%s\nwant only the config changed:\n%s", data, want)
+	}
+
+	// Without a config left, the member goes, and the rest stays.
+	if err := WriteProject(path, nil); err != nil {
+		t.Fatalf("WriteProject() returned error: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	removed := strings.Replace(original, `  "config": {
+    "sort-packages": true
+  },
+`, "", 1)
+	if string(data) != removed {
+		t.Errorf("composer.json =\n%s\nwant the config removed:\n%s", data, removed)
+	}
+
+	// A project without a config gets one at the end.
+	if err := WriteProject(path, map[string]interface{}{"bin-dir": "bin"}); err != nil {
+		t.Fatalf("WriteProject() returned error: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if want := strings.Replace(removed, "  }\n}\n", "  },\n  \"config\": {\n    \"bin-dir\": \"bin\"\n  }\n}\n", 1); string(data) != want {
+		t.Errorf("composer.json =\n%s\nwant the config added at the end:\n%s", data, want)
+	}
+}
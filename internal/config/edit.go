@@ -0,0 +1,268 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadGlobal returns the "config" section of the global config.json in home,
+// or nil if there is none.
+func ReadGlobal(home string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(GlobalFile(home))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", GlobalFile(home), err)
+	}
+	return doc.Config, nil
+}
+
+// WriteGlobal replaces the "config" section of the global config.json in
+// home, keeping the rest of the file.
+func WriteGlobal(home string, section map[string]interface{}) error {
+	path := GlobalFile(home)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeSection(path, data, section)
+}
+
+// WriteProject replaces the "config" section of the composer.json at path.
+// Only that member is rewritten: every other key, their order and their
+// formatting stay as the user left them.
+func WriteProject(path string, section map[string]interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return writeSection(path, data, section)
+}
+
+// writeSection writes data to path with its "config" member replaced by
+// section, or removed if section is empty.
+func writeSection(path string, data []byte, section map[string]interface{}) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}\n")
+	}
+	data, err := replaceMember(data, "config", func(indent string) ([]byte, error) {
+		if len(section) == 0 {
+			return nil, nil
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if indent != "" {
+			enc.SetIndent(indent, indent)
+		}
+		if err := enc.Encode(section); err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// replaceMember returns the JSON object in data with the value of member name
+// replaced by the one encode returns, given the file's indentation ("" for an
+// object on one line), or the member removed if that is nil. The rest of data
+// is kept byte for byte.
+func replaceMember(data []byte, name string, encode func(indent string) ([]byte, error)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+
+	// Offsets of the member found: where its key starts, where its value
+	// starts and ends, where the member before it ends, and where the key
+	// of the one after it starts.
+	keyStart, start, end, before, next := -1, -1, -1, -1, -1
+	prev := int(dec.InputOffset())
+	open, members := prev, 0
+	indent := ""
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		at := prev + bytes.IndexByte(data[prev:], '"')
+		if members == 0 {
+			line := data[bytes.LastIndexByte(data[:at], '\n')+1 : at]
+			if len(bytes.Trim(line, " \t")) == 0 {
+				indent = string(line)
+			}
+		}
+		if keyStart >= 0 && next < 0 {
+			next = at
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		valueEnd := int(dec.InputOffset())
+		if key == name && keyStart < 0 {
+			keyStart, start, end, before = at, valueEnd-len(raw), valueEnd, prev
+		}
+		prev = valueEnd
+		members++
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if members == 0 {
+		indent = "    "
+	}
+
+	value, err := encode(indent)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	switch {
+	case value != nil && keyStart >= 0:
+		out = append(out, data[:start]...)
+		out = append(out, value...)
+		out = append(out, data[end:]...)
+	case value != nil:
+		key, _ := json.Marshal(name)
+		member := "\n" + indent + string(key) + ": " + string(value)
+		if indent == "" {
+			member = " " + string(key) + ": " + string(value)
+		}
+		if members == 0 {
+			out = append(out, data[:open]...)
+			out = append(out, member+"\n"...)
+			out = append(out, bytes.TrimLeft(data[open:], " \t\r\n")...)
+			break
+		}
+		out = append(out, data[:prev]...)
+		out = append(out, ","+member...)
+		out = append(out, data[prev:]...)
+	case keyStart >= 0 && next >= 0:
+		out = append(out, data[:keyStart]...)
+		out = append(out, data[next:]...)
+	case keyStart >= 0 && members > 1:
+		out = append(out, data[:before]...)
+		out = append(out, data[end:]...)
+	case keyStart >= 0:
+		out = append(out, data[:open]...)
+		out = append(out, '\n')
+		out = append(out, bytes.TrimLeft(data[end:], " \t\r\n")...)
+	default:
+		out = data
+	}
+	return out, nil
+}
+
+// Set parses value for key and stores it in section, the "config" of
+// composer.json or config.json. Platform packages and preferred-install
+// patterns are set through dotted keys such as "platform.php".
+func Set(section map[string]interface{}, key, value string) error {
+	name, sub, dotted := strings.Cut(key, ".")
+	s, ok := settings[name]
+	if !ok {
+		return fmt.Errorf("unknown config key %q", key)
+	}
+
+	switch {
+	case s.kind == kindPlatform && !dotted:
+		return fmt.Errorf("set platform packages one at a time, e.g. platform.php 8.2.0")
+	case s.kind == kindPlatform:
+		var v interface{} = value
+		if value == "false" {
+			v = false
+		}
+		setEntry(section, name, strings.ToLower(sub), v)
+		return nil
+	case dotted && s.kind != kindInstall:
+		return fmt.Errorf("unknown config key %q", key)
+	}
+
+	v, err := parseArg(s.kind, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if s.kind == kindDir {
+		if err := checkDirs(section, name, value); err != nil {
+			return err
+		}
+	}
+	if dotted {
+		if mode, ok := section[name].(string); ok {
+			section[name] = map[string]interface{}{"*": mode}
+		}
+		setEntry(section, name, sub, v)
+		return nil
+	}
+	section[name] = v
+	return nil
+}
+
+// Unset removes key from section, dropping a platform or preferred-install
+// object that it leaves empty.
+func Unset(section map[string]interface{}, key string) error {
+	name, sub, dotted := strings.Cut(key, ".")
+	if _, ok := settings[name]; !ok {
+		return fmt.Errorf("unknown config key %q", key)
+	}
+
+	if !dotted {
+		delete(section, name)
+		return nil
+	}
+	if m, ok := section[name].(map[string]interface{}); ok {
+		delete(m, sub)
+		delete(m, strings.ToLower(sub))
+		if len(m) == 0 {
+			delete(section, name)
+		}
+	}
+	return nil
+}
+
+// checkDirs reports an error if setting key to dir makes the directory
+// settings of section refer back to themselves, as in "{$vendor-dir}/lib"
+// for vendor-dir.
+func checkDirs(section map[string]interface{}, key, dir string) error {
+	c := &Config{values: defaults()}
+	for name, s := range settings {
+		if v, ok := section[name].(string); ok && s.kind == kindDir {
+			c.values[name] = v
+		}
+	}
+	c.values[key] = dir
+	_, err := c.dir(key, make(map[string]bool))
+	return err
+}
+
+func setEntry(section map[string]interface{}, name, key string, value interface{}) {
+	m, ok := section[name].(map[string]interface{})
+	if !ok {
+		m = make(map[string]interface{})
+		section[name] = m
+	}
+	m[key] = value
+}
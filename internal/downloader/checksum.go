@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aras/presto/internal/resolver"
+)
+
+// ChecksumError reports an archive that doesn't match the checksum its
+// package was locked or published with.
+type ChecksumError struct {
+	Field    string // "shasum" or "integrity"
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("archive does not match its dist %s: expected %s, got %s", e.Field, e.Expected, e.Actual)
+}
+
+// verify checks the archive at path against pkg's dist.shasum (SHA-1, as
+// published by the repository) and dist.integrity (SHA-256 in the Subresource
+// Integrity format "sha256-<base64>", as recorded in composer.lock),
+// whichever are set. An archive that passes gives pkg its integrity, if it
+// had none, for the lock file.
+func verify(pkg *resolver.Package, path string) error {
+	shasum, integrity, err := digests(path)
+	if err != nil {
+		return err
+	}
+
+	if expected := pkg.Dist.Shasum; expected != "" && !strings.EqualFold(shasum, expected) {
+		return &ChecksumError{Field: "shasum", Expected: expected, Actual: shasum}
+	}
+	if expected := pkg.Dist.Integrity; expected != "" && expected != integrity {
+		return &ChecksumError{Field: "integrity", Expected: expected, Actual: integrity}
+	}
+	pkg.Dist.Integrity = integrity
+	return nil
+}
+
+// digests returns the SHA-1 of the file at path in hex, and its SHA-256 as an
+// integrity.
+func digests(path string) (shasum, integrity string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	sha1sum, sha256sum := sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(sha1sum, sha256sum), f); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(sha1sum.Sum(nil)), "sha256-" + base64.StdEncoding.EncodeToString(sha256sum.Sum(nil)), nil
+}
@@ -1,25 +1,43 @@
 package downloader
 
 import (
-	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/aras/presto/internal/auth"
+	"github.com/aras/presto/internal/cache"
+	"github.com/aras/presto/internal/config"
+	"github.com/aras/presto/internal/parser"
 	"github.com/aras/presto/internal/resolver"
+	"github.com/aras/presto/internal/store"
+	"github.com/aras/presto/internal/vcs"
 	"github.com/schollz/progressbar/v3"
 )
 
-// Downloader handles parallel package downloads
+// Downloader handles parallel package downloads. Archives are kept in the
+// user cache directory and reused by later installs; offline, only those are
+// used.
 type Downloader struct {
 	workers    int
 	httpClient *http.Client
 	vendorDir  string
+	cache      *cache.Cache
+	offline    bool
+	preferred  config.PreferredInstall
+	store      *store.Store        // nil to extract into the vendor directory
+	local      []parser.Repository // artifact and path repositories of the project
+	maxSize    int64               // uncompressed bytes per archive
+	maxFiles   int                 // entries per archive
 }
 
 // NewDownloader creates a new downloader with specified number of workers
@@ -30,6 +48,9 @@ func NewDownloader(workers int) *Downloader {
 			Timeout: 5 * time.Minute,
 		},
 		vendorDir: "vendor",
+		cache:     cache.New(cache.Dir()),
+		maxSize:   defaultMaxExtractedSize,
+		maxFiles:  defaultMaxExtractedFiles,
 	}
 }
 
@@ -106,22 +127,105 @@ func (d *Downloader) downloadPackage(pkg *resolver.Package) error {
 	// Skip if already downloaded
 	packageDir := filepath.Join(d.vendorDir, pkg.Name)
 	if _, err := os.Stat(packageDir); err == nil {
-		return nil // Already exists
+		// Already exists. Its cached archive, if any, still gives the lock
+		// file an integrity, and counts as used, so that the archives of
+		// the packages a project has installed are the last to be evicted.
+		if d.cache != nil && pkg.URL != "" && d.cache.Has(distCacheKey(pkg)) {
+			_ = d.cache.Touch(distCacheKey(pkg))
+			if pkg.Dist.Integrity == "" {
+				_ = verify(pkg, d.cache.Path(distCacheKey(pkg)))
+			}
+		}
+		if d.cache != nil && pkg.Source.Reference != "" && d.cache.Has(gitArchiveKey(pkg)) {
+			_ = d.cache.Touch(gitArchiveKey(pkg))
+		}
+		return nil
 	}
 
-	// Download archive
-	resp, err := d.httpClient.Get(pkg.URL)
-	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
+	if pkg.Dist.Type == "path" {
+		return d.installFromPath(pkg, packageDir)
+	}
+	if d.fromSource(pkg) {
+		return d.installFromGit(pkg, packageDir)
+	}
+	// A release already in the store needs neither its archive nor the
+	// network.
+	if d.store != nil && pkg.Dist.Integrity != "" {
+		if files, ok := d.store.Lookup(pkg.Dist.Integrity); ok {
+			return store.Link(files, packageDir)
+		}
+	}
+	if path, ok, err := d.localArchive(pkg.URL); ok {
+		if err != nil {
+			return err
+		}
+		if err := verify(pkg, path); err != nil {
+			return err
+		}
+		if err := d.unpack(path, pkg.Dist.Type, pkg.Dist.Integrity, packageDir); err != nil {
+			return fmt.Errorf("extraction failed: %w", err)
+		}
+		return nil
+	}
+	if d.cache == nil {
+		return d.downloadUncached(pkg, packageDir)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP status %d", resp.StatusCode)
+	key := distCacheKey(pkg)
+	cached := d.cache.Has(key)
+	if cached {
+		_ = d.cache.Touch(key)
+		// A cached archive that doesn't match, e.g. one damaged on disk, is
+		// downloaded again rather than trusted.
+		if err := verify(pkg, d.cache.Path(key)); err != nil {
+			if d.offline {
+				return err
+			}
+			cached = false
+		}
 	}
+	if !cached {
+		if d.offline {
+			return fmt.Errorf("%s: %w", pkg.URL, cache.ErrOffline)
+		}
+
+		body, err := d.fetch(pkg.URL)
+		if err != nil {
+			return err
+		}
+		err = d.cache.CopyFrom(key, body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		if err := verify(pkg, d.cache.Path(key)); err != nil {
+			os.Remove(d.cache.Path(key))
+			return err
+		}
+	}
+
+	// Extract archive
+	if err := d.unpack(d.cache.Path(key), pkg.Dist.Type, pkg.Dist.Integrity, packageDir); err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+
+	return nil
+}
+
+// downloadUncached downloads pkg through a temporary file, without the cache.
+func (d *Downloader) downloadUncached(pkg *resolver.Package, packageDir string) error {
+	if d.offline {
+		return fmt.Errorf("%s: %w", pkg.URL, cache.ErrOffline)
+	}
+
+	body, err := d.fetch(pkg.URL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
 
 	// Create temp file
-	tmpFile, err := os.CreateTemp("", "presto-*.zip")
+	tmpFile, err := os.CreateTemp("", "presto-*."+distExt(pkg))
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -129,88 +233,331 @@ func (d *Downloader) downloadPackage(pkg *resolver.Package) error {
 	defer tmpFile.Close()
 
 	// Download to temp file
-	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
+	if _, err := io.Copy(tmpFile, body); err != nil {
 		return fmt.Errorf("download failed: %w", err)
 	}
 
 	// Close file to ensure everything is flushed to disk before extraction
 	tmpFile.Close()
 
+	if err := verify(pkg, tmpFile.Name()); err != nil {
+		return err
+	}
+
 	// Extract archive
-	if err := d.extractZip(tmpFile.Name(), packageDir); err != nil {
+	if err := d.unpack(tmpFile.Name(), pkg.Dist.Type, pkg.Dist.Integrity, packageDir); err != nil {
 		return fmt.Errorf("extraction failed: %w", err)
 	}
 
 	return nil
 }
 
-// extractZip extracts a zip archive to the destination directory
-func (d *Downloader) extractZip(zipPath, destDir string) error {
-	// Open zip file
-	reader, err := zip.OpenReader(zipPath)
+// installFromGit installs pkg from the mirror of its repository: as a working
+// copy of its commit when preferred-install asks for source, or else
+// extracted from an archive of that commit, which is cached like a dist.
+func (d *Downloader) installFromGit(pkg *resolver.Package, packageDir string) error {
+	c := d.cache
+	if c == nil {
+		c = cache.New(filepath.Join(os.TempDir(), "presto-cache"))
+	}
+	source := d.preferred.Source(pkg.Name, pkg.Version)
+	key := gitArchiveKey(pkg)
+	if !source && c.Has(key) {
+		_ = c.Touch(key)
+		if err := d.unpack(c.Path(key), "zip", "", packageDir); err != nil {
+			return fmt.Errorf("extraction failed: %w", err)
+		}
+		return nil
+	}
+
+	repo, err := vcs.Mirror(c, pkg.Source.URL, d.offline)
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
 
-	// Create destination directory
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	if source {
+		if err := os.MkdirAll(filepath.Dir(packageDir), 0755); err != nil {
+			return err
+		}
+		if err := repo.Checkout(pkg.Source.Reference, packageDir); err != nil {
+			return fmt.Errorf("failed to check out %s: %w", pkg.Source.Reference, err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path(key)), 0755); err != nil {
 		return err
 	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(c.Path(key)), ".tmp-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
 
-	// Extract files
-	for _, file := range reader.File {
-		// Get the file path
-		path := filepath.Join(destDir, file.Name)
+	if err := repo.Archive(pkg.Source.Reference, "package/", tmpFile.Name()); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", pkg.Source.Reference, err)
+	}
+	if err := os.Rename(tmpFile.Name(), c.Path(key)); err != nil {
+		return err
+	}
+	if err := d.unpack(c.Path(key), "zip", "", packageDir); err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+	return nil
+}
 
-		// Remove the first directory component (package name with version)
-		parts := strings.Split(file.Name, string(filepath.Separator))
-		if len(parts) > 1 {
-			path = filepath.Join(destDir, filepath.Join(parts[1:]...))
+// unpack extracts an archive to packageDir, or with a store, extracts it into
+// the store unless it is there already and links packageDir to it. The
+// integrity addresses the archive in the store; without one, it is computed.
+func (d *Downloader) unpack(archive, distType, integrity, packageDir string) error {
+	if d.store == nil {
+		return d.extract(archive, distType, packageDir)
+	}
+	if integrity == "" {
+		var err error
+		if _, integrity, err = digests(archive); err != nil {
+			return err
 		}
+	}
 
-		// Check for directory
-		if file.FileInfo().IsDir() {
-			_ = os.MkdirAll(path, file.Mode())
-			continue
-		}
+	files, err := d.store.Add(integrity, func(dir string) error {
+		return d.extract(archive, distType, dir)
+	})
+	if err != nil {
+		return err
+	}
+	return store.Link(files, packageDir)
+}
 
-		// Create parent directories
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+// installFromPath installs a package from a path repository by linking
+// packageDir to its directory. With the repository's "symlink" option unset,
+// a copy is made where a link can't be; true insists on the link and false
+// always copies. Links are relative unless "relative" is false.
+func (d *Downloader) installFromPath(pkg *resolver.Package, packageDir string) error {
+	src := filepath.FromSlash(pkg.Dist.URL)
+	if !d.inLocalRepository("path", src) {
+		return fmt.Errorf("%s is not in a path repository of the project", pkg.Dist.URL)
+	}
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("path repository package not found: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(packageDir), 0755); err != nil {
+		return err
+	}
+	// A link whose target has gone away still occupies the path.
+	_ = os.Remove(packageDir)
+
+	symlink, explicit := pkg.TransportOptions["symlink"].(bool)
+	if !explicit || symlink {
+		relative, ok := pkg.TransportOptions["relative"].(bool)
+		err := linkDir(src, packageDir, !ok || relative)
+		if err == nil || explicit {
 			return err
 		}
+	}
+	return copyDir(src, packageDir)
+}
 
-		// Extract file
-		if err := d.extractFile(file, path); err != nil {
+// linkDir makes link a symlink to the directory target.
+func linkDir(target, link string, relative bool) error {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	if relative {
+		absLink, err := filepath.Abs(link)
+		if err != nil {
+			return err
+		}
+		if target, err = filepath.Rel(filepath.Dir(absLink), target); err != nil {
 			return err
 		}
 	}
+	return os.Symlink(target, link)
+}
 
-	return nil
+// copyDir copies the directory src to dest, leaving out .git.
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir() && entry.Name() == ".git":
+			return filepath.SkipDir
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
 }
 
-// extractFile extracts a single file from the zip archive
-func (d *Downloader) extractFile(file *zip.File, destPath string) error {
-	// Open file in archive
-	srcFile, err := file.Open()
+func copyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
-	defer srcFile.Close()
+	defer in.Close()
 
-	// Create destination file
-	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
-
-	// Copy contents
-	if _, err := io.Copy(destFile, srcFile); err != nil {
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
 		return err
 	}
+	return out.Close()
+}
 
-	return nil
+// localArchive returns the file a dist URL points at, if it is a local path
+// rather than something to download: a file:// URL, or a plain path into one
+// of the project's artifact repositories. Any other repository naming a local
+// file gets an error, as its metadata could point at any archive on the disk.
+func (d *Downloader) localArchive(url string) (string, bool, error) {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		return path, true, nil
+	}
+	if url == "" || strings.Contains(url, "://") {
+		return "", false, nil
+	}
+	path := filepath.FromSlash(url)
+	if !d.inLocalRepository("artifact", path) {
+		return "", true, fmt.Errorf("%s is not in an artifact repository of the project", url)
+	}
+	return path, true, nil
+}
+
+// inLocalRepository reports whether path is under the directory of one of
+// the project's artifact repositories, for typ "artifact", or is a directory
+// the url of one of its path repositories matches, for typ "path".
+func (d *Downloader) inLocalRepository(typ, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, repo := range d.local {
+		if repo.Type != typ || repo.URL == "" {
+			continue
+		}
+		dir, err := filepath.Abs(filepath.FromSlash(repo.URL))
+		if err != nil {
+			continue
+		}
+		if typ == "path" {
+			if ok, _ := filepath.Match(dir, abs); ok {
+				return true
+			}
+			continue
+		}
+		if rel, err := filepath.Rel(dir, abs); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch starts downloading url and returns the response body.
+func (d *Downloader) fetch(url string) (io.ReadCloser, error) {
+	resp, err := d.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+// distCacheKey names the cached archive of pkg after the package, its
+// version and the reference it was built from:
+// files/vendor/name/<version>-<sha1>.<dist type>, hashing the reference with
+// the host the archive comes from. Every project installing that release
+// shares the archive, even through URLs that differ between requests, while
+// the host keeps a package from one repository from being served for another.
+// Without a reference, the whole URL is hashed.
+func distCacheKey(pkg *resolver.Package) string {
+	id := pkg.URL
+	if u, err := url.Parse(pkg.URL); err == nil && u.Host != "" && pkg.Dist.Reference != "" {
+		id = u.Host + " " + pkg.Dist.Reference
+	}
+	return filesKey(pkg, id, distExt(pkg))
+}
+
+// gitArchiveKey names the cached archive of the commit pkg is installed from
+// when it comes from its git repository.
+func gitArchiveKey(pkg *resolver.Package) string {
+	return filesKey(pkg, pkg.Source.URL+" "+pkg.Source.Reference, "zip")
+}
+
+// unsafeVersionChars are those replaced in the version part of a cache key.
+var unsafeVersionChars = regexp.MustCompile(`[^A-Za-z0-9._+-]`)
+
+func filesKey(pkg *resolver.Package, id, ext string) string {
+	sum := sha1.Sum([]byte(id))
+	version := unsafeVersionChars.ReplaceAllString(pkg.Version, "-")
+	return cache.FilesDir + "/" + pkg.Name + "/" + version + "-" + hex.EncodeToString(sum[:]) + "." + ext
+}
+
+// distExt returns the extension for an archive of pkg: its dist type, or zip
+// for a type that can't be extracted.
+func distExt(pkg *resolver.Package) string {
+	if archiveFormats[pkg.Dist.Type] {
+		return pkg.Dist.Type
+	}
+	return "zip"
+}
+
+// Missing returns the packages that would have to be downloaded: those not
+// in the vendor directory, not on the local disk, not in the store and not in
+// the cache, either as an archive or as a mirror of their git repository.
+func (d *Downloader) Missing(packages []*resolver.Package) []*resolver.Package {
+	var missing []*resolver.Package
+	for _, pkg := range packages {
+		if _, err := os.Stat(filepath.Join(d.vendorDir, pkg.Name)); err == nil {
+			continue
+		}
+		if _, local, _ := d.localArchive(pkg.URL); local || pkg.Dist.Type == "path" {
+			continue
+		}
+		if d.cache != nil && d.fromSource(pkg) && d.cache.Has(vcs.MirrorKey(pkg.Source.URL)) {
+			continue
+		}
+		if d.cache != nil && d.fromSource(pkg) && !d.preferred.Source(pkg.Name, pkg.Version) && d.cache.Has(gitArchiveKey(pkg)) {
+			continue
+		}
+		if d.cache != nil && !d.fromSource(pkg) && d.cache.Has(distCacheKey(pkg)) {
+			continue
+		}
+		if d.store != nil && !d.fromSource(pkg) && pkg.Dist.Integrity != "" {
+			if _, ok := d.store.Lookup(pkg.Dist.Integrity); ok {
+				continue
+			}
+		}
+		missing = append(missing, pkg)
+	}
+	return missing
 }
 
 // DownloadPackage downloads a single package (public method)
@@ -222,3 +569,53 @@ func (d *Downloader) DownloadPackage(pkg *resolver.Package) error {
 func (d *Downloader) SetVendorDir(dir string) {
 	d.vendorDir = dir
 }
+
+// SetRepositories tells the downloader the project's repositories. Local
+// archives and directories are only installed from its artifact and path
+// repositories.
+func (d *Downloader) SetRepositories(repos []parser.Repository) {
+	d.local = nil
+	for _, repo := range repos {
+		if repo.Type == "artifact" || repo.Type == "path" {
+			d.local = append(d.local, repo)
+		}
+	}
+}
+
+// SetPreferredInstall sets preferred-install: packages it selects are cloned
+// from their git source, when they have one, instead of unpacked from dist.
+func (d *Downloader) SetPreferredInstall(p config.PreferredInstall) {
+	d.preferred = p
+}
+
+// fromSource reports whether pkg is installed from its git repository: when
+// it has no dist, or preferred-install asks for source.
+func (d *Downloader) fromSource(pkg *resolver.Package) bool {
+	if pkg.Source.Type != "git" || pkg.Source.URL == "" {
+		return false
+	}
+	return pkg.URL == "" || d.preferred.Source(pkg.Name, pkg.Version)
+}
+
+// SetCredentials makes the downloader authenticate to the hosts creds has
+// credentials for.
+func (d *Downloader) SetCredentials(creds *auth.Credentials) {
+	d.httpClient.Transport = &auth.Transport{Credentials: creds, Base: d.httpClient.Transport}
+}
+
+// SetCache sets where archives are cached. nil disables the cache.
+func (d *Downloader) SetCache(c *cache.Cache) {
+	d.cache = c
+}
+
+// SetStore makes the downloader install packages from the store, linking
+// vendor directories to the files extracted there. nil extracts every
+// package into the vendor directory.
+func (d *Downloader) SetStore(s *store.Store) {
+	d.store = s
+}
+
+// SetOffline makes the downloader use cached archives only.
+func (d *Downloader) SetOffline(offline bool) {
+	d.offline = offline
+}
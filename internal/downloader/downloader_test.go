@@ -0,0 +1,576 @@
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aras/presto/internal/cache"
+	"github.com/aras/presto/internal/packagist"
+	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/resolver"
+	"github.com/aras/presto/internal/store"
+	"github.com/aras/presto/internal/vcs"
+)
+
+// makeZip returns a zip archive of files, keyed by path.
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestDownloader returns a downloader with its own vendor dir and cache.
+func newTestDownloader(t *testing.T) *Downloader {
+	t.Helper()
+
+	d := NewDownloader(1)
+	d.SetVendorDir(filepath.Join(t.TempDir(), "vendor"))
+	d.SetCache(cache.New(t.TempDir()))
+	return d
+}
+
+func TestDownloadPackage_Checksum(t *testing.T) {
+	archive := makeZip(t, map[string]string{"lib-1.0.0/composer.json": `{"name": "acme/lib"}`})
+	served := archive
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(served)
+	}))
+	defer srv.Close()
+
+	sum := sha1.Sum(archive)
+	shasum := hex.EncodeToString(sum[:])
+	newPackage := func() *resolver.Package {
+		return &resolver.Package{Name: "acme/lib", Version: "1.0.0", URL: srv.URL + "/lib.zip",
+			Dist: packagist.DistInfo{Type: "zip", Shasum: shasum}}
+	}
+
+	d := newTestDownloader(t)
+	pkg := newPackage()
+	if err := d.downloadPackage(pkg); err != nil {
+		t.Fatalf("downloadPackage() returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(d.vendorDir, "acme/lib/composer.json")); err != nil {
+		t.Errorf("package not extracted: %v", err)
+	}
+	integrity := pkg.Dist.Integrity
+	if len(integrity) != len("sha256-")+44 {
+		t.Errorf("Integrity = %q, want the archive's SHA-256", integrity)
+	}
+
+	// Installing it again counts as a use of the cached archive.
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(d.cache.Path(distCacheKey(pkg)), old, old)
+	if err := d.downloadPackage(pkg); err != nil {
+		t.Fatalf("downloadPackage() of an installed package returned error: %v", err)
+	}
+	if info, err := os.Stat(d.cache.Path(distCacheKey(pkg))); err != nil || info.ModTime().Before(time.Now().Add(-time.Hour)) {
+		t.Error("cached archive of an installed package not touched")
+	}
+
+	// A tampered archive is refused, and not kept in the cache.
+	served = makeZip(t, map[string]string{"lib-1.0.0/composer.json": `{"name": "acme/lib", "evil": true}`})
+	d = newTestDownloader(t)
+	err := d.downloadPackage(newPackage())
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Field != "shasum" {
+		t.Fatalf("downloadPackage() of a tampered archive = %v, want a shasum mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(d.vendorDir, "acme/lib")); !os.IsNotExist(err) {
+		t.Error("tampered archive was extracted")
+	}
+	if d.cache.Has(distCacheKey(newPackage())) {
+		t.Error("tampered archive was kept in the cache")
+	}
+
+	// Without a shasum, the integrity from the lock catches it.
+	pkg = newPackage()
+	pkg.Dist.Shasum, pkg.Dist.Integrity = "", integrity
+	if err := d.downloadPackage(pkg); !errors.As(err, &checksumErr) || checksumErr.Field != "integrity" {
+		t.Fatalf("downloadPackage() with a locked integrity = %v, want an integrity mismatch", err)
+	}
+
+	// A damaged cached archive is downloaded again.
+	served = archive
+	d.cache.Write(distCacheKey(pkg), []byte("damaged"))
+	if err := d.downloadPackage(pkg); err != nil {
+		t.Fatalf("downloadPackage() over a damaged cached archive returned error: %v", err)
+	}
+
+	// Offline, it can't be, so the install fails.
+	d = newTestDownloader(t)
+	d.SetOffline(true)
+	d.cache.Write(distCacheKey(pkg), []byte("damaged"))
+	if err := d.downloadPackage(newPackage()); !errors.As(err, &checksumErr) {
+		t.Errorf("downloadPackage() offline over a damaged cached archive = %v, want a checksum mismatch", err)
+	}
+}
+
+func TestDownloadPackage_Store(t *testing.T) {
+	archive := makeZip(t, map[string]string{"lib-1.0.0/composer.json": `{"name": "acme/lib"}`})
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	s := store.New(t.TempDir())
+	d := newTestDownloader(t)
+	d.SetStore(s)
+	pkg := &resolver.Package{Name: "acme/lib", Version: "1.0.0", URL: srv.URL + "/lib.zip",
+		Dist: packagist.DistInfo{Type: "zip"}}
+	if err := d.downloadPackage(pkg); err != nil {
+		t.Fatalf("downloadPackage() returned error: %v", err)
+	}
+	files, ok := s.Lookup(pkg.Dist.Integrity)
+	if !ok {
+		t.Fatal("package not added to the store")
+	}
+
+	// Another project, with a cold cache, links the locked release from the
+	// store without downloading it.
+	d = newTestDownloader(t)
+	d.SetStore(s)
+	d.SetOffline(true)
+	locked := &resolver.Package{Name: "acme/lib", Version: "1.0.0", URL: srv.URL + "/lib.zip",
+		Dist: packagist.DistInfo{Type: "zip", Integrity: pkg.Dist.Integrity}}
+	if missing := d.Missing([]*resolver.Package{locked}); len(missing) != 0 {
+		t.Errorf("Missing() = %v, want the stored package to count", missing)
+	}
+	if err := d.downloadPackage(locked); err != nil {
+		t.Fatalf("downloadPackage() from the store returned error: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want the archive downloaded once", requests)
+	}
+
+	stored, _ := os.Stat(filepath.Join(files, "composer.json"))
+	linked, err := os.Stat(filepath.Join(d.vendorDir, "acme/lib/composer.json"))
+	if err != nil || !os.SameFile(stored, linked) {
+		t.Errorf("composer.json = %v, %v, want a hard link into the store", linked, err)
+	}
+}
+
+func TestDownloadPackage_LocalPaths(t *testing.T) {
+	artifacts := t.TempDir()
+	archive := filepath.Join(artifacts, "lib-1.0.0.zip")
+	if err := os.WriteFile(archive, makeZip(t, map[string]string{"lib-1.0.0/composer.json": `{"name": "acme/lib"}`}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	packages := t.TempDir()
+	lib := filepath.Join(packages, "lib")
+	os.MkdirAll(lib, 0755)
+	elsewhere := filepath.Join(t.TempDir(), "secret.zip")
+	os.WriteFile(elsewhere, makeZip(t, map[string]string{"secret/composer.json": `{}`}), 0644)
+
+	d := newTestDownloader(t)
+	d.SetRepositories([]parser.Repository{
+		{Type: "artifact", URL: filepath.ToSlash(artifacts)},
+		{Type: "path", URL: filepath.ToSlash(packages) + "/*"},
+		{Type: "composer", URL: "https://repo.example.com"},
+	})
+
+	// Metadata of another repository can't point at an archive on the
+	// disk, nor a path package outside the path repositories.
+	for _, pkg := range []*resolver.Package{
+		{Name: "evil/archive", Version: "1.0.0", URL: filepath.ToSlash(elsewhere), Dist: packagist.DistInfo{Type: "zip"}},
+		{Name: "evil/dir", Version: "1.0.0", Dist: packagist.DistInfo{Type: "path", URL: filepath.ToSlash(t.TempDir())}},
+	} {
+		if err := d.downloadPackage(pkg); err == nil {
+			t.Errorf("downloadPackage() of %s from outside the local repositories expected an error", pkg.Name)
+		}
+		if _, err := os.Stat(filepath.Join(d.vendorDir, pkg.Name)); !os.IsNotExist(err) {
+			t.Errorf("%s was installed", pkg.Name)
+		}
+	}
+
+	for _, pkg := range []*resolver.Package{
+		{Name: "acme/lib", Version: "1.0.0", URL: filepath.ToSlash(archive), Dist: packagist.DistInfo{Type: "zip"}},
+		{Name: "acme/file", Version: "1.0.0", URL: "file://" + elsewhere, Dist: packagist.DistInfo{Type: "zip"}},
+		{Name: "acme/dir", Version: "dev-main", Dist: packagist.DistInfo{Type: "path", URL: filepath.ToSlash(lib)}},
+	} {
+		if err := d.downloadPackage(pkg); err != nil {
+			t.Errorf("downloadPackage() of %s returned error: %v", pkg.Name, err)
+		}
+	}
+}
+
+func TestDistCacheKey(t *testing.T) {
+	pkg := func(url, reference string) *resolver.Package {
+		return &resolver.Package{Name: "acme/lib", Version: "dev-feature/api", URL: url,
+			Dist: packagist.DistInfo{Type: "zip", Reference: reference}}
+	}
+
+	key := distCacheKey(pkg("https://example.com/lib.zip?token=a", "abc123"))
+	if !strings.HasPrefix(key, "files/acme/lib/dev-feature-api-") || !strings.HasSuffix(key, ".zip") {
+		t.Errorf("distCacheKey() = %s, want files/acme/lib/dev-feature-api-<sha1>.zip", key)
+	}
+	if other := distCacheKey(pkg("https://example.com/lib.zip?token=b", "abc123")); other != key {
+		t.Errorf("the same reference from the same host has keys %s and %s, want one", key, other)
+	}
+	if other := distCacheKey(pkg("https://evil.example/lib.zip", "abc123")); other == key {
+		t.Error("the same reference from another host has the same key")
+	}
+	if distCacheKey(pkg("https://example.com/a.zip", "")) == distCacheKey(pkg("https://example.com/b.zip", "")) {
+		t.Error("different URLs without a reference have the same key")
+	}
+}
+
+func TestInstallFromGit_CachesArchive(t *testing.T) {
+	work := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "--quiet")
+	os.WriteFile(filepath.Join(work, "composer.json"), []byte(`{"name": "acme/lib"}`), 0644)
+	git("add", ".")
+	git("commit", "--quiet", "-m", "Initial commit")
+	out, err := exec.Command("git", "-C", work, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := &resolver.Package{Name: "acme/lib", Version: "dev-main",
+		Source: packagist.SourceInfo{Type: "git", URL: work, Reference: strings.TrimSpace(string(out))}}
+	d := newTestDownloader(t)
+	if err := d.downloadPackage(pkg); err != nil {
+		t.Fatalf("downloadPackage() returned error: %v", err)
+	}
+	if !d.cache.Has(gitArchiveKey(pkg)) {
+		t.Fatal("archive of the commit not cached")
+	}
+
+	// Another project installs it from the cached archive alone.
+	os.RemoveAll(d.cache.Path(vcs.MirrorKey(work)))
+	os.RemoveAll(work)
+	d.SetVendorDir(filepath.Join(t.TempDir(), "vendor"))
+	d.SetOffline(true)
+	if missing := d.Missing([]*resolver.Package{pkg}); len(missing) != 0 {
+		t.Errorf("Missing() = %v, want the cached archive to count", missing)
+	}
+	if err := d.downloadPackage(pkg); err != nil {
+		t.Fatalf("downloadPackage() from the cached archive returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(d.vendorDir, "acme/lib/composer.json")); err != nil {
+		t.Errorf("package not extracted: %v", err)
+	}
+}
+
+// archiveEntry is an entry of a crafted archive; a link's body is its target.
+type archiveEntry struct {
+	name     string
+	body     string
+	mode     fs.FileMode
+	hardlink bool // tar only
+}
+
+// craftZip writes a zip archive of entries, which may be malicious, and
+// returns its path.
+func craftZip(t *testing.T, entries ...archiveEntry) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "crafted.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode == 0 {
+			e.mode = 0644
+		}
+		header.SetMode(e.mode)
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(e.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractZip_Unsafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"parent path", []archiveEntry{{name: "../evil.php", body: "<?php"}}},
+		{"parent path below the root", []archiveEntry{{name: "lib/a.php"}, {name: "lib/../../evil.php", body: "<?php"}}},
+		{"absolute path", []archiveEntry{{name: "/tmp/evil.php", body: "<?php"}}},
+		{"backslashes", []archiveEntry{{name: `..\evil.php`, body: "<?php"}}},
+		{"symlink out", []archiveEntry{{name: "link", body: "../../..", mode: fs.ModeSymlink | 0777}}},
+		{"absolute symlink", []archiveEntry{{name: "passwd", body: "/etc/passwd", mode: fs.ModeSymlink | 0777}}},
+		{"symlink out through symlinks", []archiveEntry{
+			{name: "d", body: ".", mode: fs.ModeSymlink | 0777},
+			{name: "c", body: "d/..", mode: fs.ModeSymlink | 0777},
+			{name: "c/evil", body: "x", mode: fs.ModeSymlink | 0777},
+		}},
+		{"symlink resolving out", []archiveEntry{
+			{name: "d", body: ".", mode: fs.ModeSymlink | 0777},
+			{name: "c", body: "d/..", mode: fs.ModeSymlink | 0777},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDownloader(t)
+			parent := filepath.Join(t.TempDir(), "vendor", "acme")
+			dest := filepath.Join(parent, "lib")
+
+			err := d.extractZip(craftZip(t, tt.entries...), dest)
+			if !errors.Is(err, ErrUnsafeArchive) {
+				t.Fatalf("extractZip() = %v, want ErrUnsafeArchive", err)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Error("package directory left behind")
+			}
+			for _, dir := range []string{parent, filepath.Dir(parent), filepath.Dir(filepath.Dir(parent))} {
+				for _, name := range []string{"evil.php", "evil", "link"} {
+					if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+						t.Errorf("%s written outside the package directory", filepath.Join(dir, name))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExtractZip_Limits(t *testing.T) {
+	d := newTestDownloader(t)
+	d.maxSize = 1024
+	bomb := craftZip(t, archiveEntry{name: "a.txt", body: string(make([]byte, 600))}, archiveEntry{name: "b.txt", body: string(make([]byte, 600))})
+	if err := d.extractZip(bomb, filepath.Join(t.TempDir(), "lib")); !errors.Is(err, ErrUnsafeArchive) {
+		t.Errorf("extractZip() past the size limit = %v, want ErrUnsafeArchive", err)
+	}
+
+	d = newTestDownloader(t)
+	d.maxFiles = 2
+	many := craftZip(t, archiveEntry{name: "a"}, archiveEntry{name: "b"}, archiveEntry{name: "c"})
+	if err := d.extractZip(many, filepath.Join(t.TempDir(), "lib")); !errors.Is(err, ErrUnsafeArchive) {
+		t.Errorf("extractZip() past the file limit = %v, want ErrUnsafeArchive", err)
+	}
+}
+
+func TestExtractZip_ModesAndLinks(t *testing.T) {
+	d := newTestDownloader(t)
+	dest := filepath.Join(t.TempDir(), "lib")
+	archive := craftZip(t,
+		archiveEntry{name: "lib-1.0/src/tool.php", body: "<?php", mode: 0777 | fs.ModeSetuid},
+		archiveEntry{name: "lib-1.0/src/secret.php", body: "<?php", mode: 0600},
+		archiveEntry{name: "lib-1.0/bin/tool", body: "../src/tool.php", mode: fs.ModeSymlink | 0777},
+		archiveEntry{name: "lib-1.0/bin/missing", body: "../src/missing.php", mode: fs.ModeSymlink | 0777},
+	)
+	if err := d.extractZip(archive, dest); err != nil {
+		t.Fatalf("extractZip() returned error: %v", err)
+	}
+
+	for name, want := range map[string]fs.FileMode{"src/tool.php": 0755, "src/secret.php": 0644} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != want {
+			t.Errorf("%s mode = %v, want %v", name, info.Mode(), want)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "bin/tool")); err != nil || target != "../src/tool.php" {
+		t.Errorf("bin/tool links to %q, %v, want ../src/tool.php", target, err)
+	}
+}
+
+// craftTar writes a tarball of entries, compressed with the named command
+// ("" for none, "gzip" without one), and returns its path.
+func craftTar(t *testing.T, compress string, entries ...archiveEntry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	// git archive and GitHub start tarballs with a pax global header.
+	w.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "abc123"}})
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		if e.mode != 0 {
+			header.Mode = int64(e.mode.Perm())
+		}
+		switch {
+		case e.hardlink:
+			header.Typeflag, header.Linkname, header.Size = tar.TypeLink, e.body, 0
+		case e.mode&fs.ModeSymlink != 0:
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.body, 0
+		case e.mode.IsDir():
+			header.Typeflag, header.Size = tar.TypeDir, 0
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			w.Write([]byte(e.body))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	switch compress {
+	case "":
+	case "gzip":
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(data)
+		zw.Close()
+		data = gz.Bytes()
+	default:
+		if _, err := exec.LookPath(compress); err != nil {
+			t.Skipf("%s not installed", compress)
+		}
+		cmd := exec.Command(compress, "--compress", "--stdout")
+		cmd.Stdin = bytes.NewReader(data)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = out
+	}
+
+	path := filepath.Join(t.TempDir(), "crafted.archive")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtract_Formats(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "lib-1.0/", mode: fs.ModeDir | 0755},
+		{name: "lib-1.0/composer.json", body: `{"name": "acme/lib"}`},
+		{name: "lib-1.0/bin/tool", body: "#!/usr/bin/env php", mode: 0755},
+		{name: "lib-1.0/bin/alias", body: "lib-1.0/bin/tool", hardlink: true},
+		{name: "lib-1.0/src", body: "bin", mode: fs.ModeSymlink | 0777},
+	}
+
+	tests := []struct {
+		name     string
+		distType string
+		archive  func(t *testing.T) string
+	}{
+		{"zip", "zip", func(t *testing.T) string { return craftZip(t, entries[1], entries[2]) }},
+		{"tar", "tar", func(t *testing.T) string { return craftTar(t, "", entries...) }},
+		{"tar.gz", "gzip", func(t *testing.T) string { return craftTar(t, "gzip", entries...) }},
+		{"tar.gz published as tar", "tar", func(t *testing.T) string { return craftTar(t, "gzip", entries...) }},
+		{"tar.gz without a type", "", func(t *testing.T) string { return craftTar(t, "gzip", entries...) }},
+		{"tar.bz2", "bzip2", func(t *testing.T) string { return craftTar(t, "bzip2", entries...) }},
+		{"tar.xz", "xz", func(t *testing.T) string { return craftTar(t, "xz", entries...) }},
+		{"tar.xz published as zip", "zip", func(t *testing.T) string { return craftTar(t, "xz", entries...) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDownloader(t)
+			dest := filepath.Join(t.TempDir(), "lib")
+			if err := d.extract(tt.archive(t), tt.distType, dest); err != nil {
+				t.Fatalf("extract() returned error: %v", err)
+			}
+
+			if data, err := os.ReadFile(filepath.Join(dest, "composer.json")); err != nil || string(data) != `{"name": "acme/lib"}` {
+				t.Errorf("composer.json = %q, %v, want it at the top of the package", data, err)
+			}
+			if info, err := os.Stat(filepath.Join(dest, "bin/tool")); err != nil || info.Mode() != 0755 {
+				t.Errorf("bin/tool = %v, %v, want an executable", info, err)
+			}
+			if tt.name == "zip" {
+				return // made without links
+			}
+			if data, err := os.ReadFile(filepath.Join(dest, "bin/alias")); err != nil || string(data) != "#!/usr/bin/env php" {
+				t.Errorf("hard link bin/alias = %q, %v, want a copy of bin/tool", data, err)
+			}
+			if target, err := os.Readlink(filepath.Join(dest, "src")); err != nil || target != "bin" {
+				t.Errorf("src links to %q, %v, want bin", target, err)
+			}
+		})
+	}
+
+	d := newTestDownloader(t)
+	rar := filepath.Join(t.TempDir(), "lib.rar")
+	os.WriteFile(rar, []byte("Rar!\x1a\x07\x00"), 0644)
+	if err := d.extract(rar, "rar", filepath.Join(t.TempDir(), "lib")); err == nil || !strings.Contains(err.Error(), "rar") {
+		t.Errorf("extract() of a rar archive = %v, want an unsupported dist type error", err)
+	}
+}
+
+func TestExtractTar_Unsafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"parent path", []archiveEntry{{name: "../evil.php", body: "<?php"}}},
+		{"absolute path", []archiveEntry{{name: "/tmp/evil.php", body: "<?php"}}},
+		{"symlink out", []archiveEntry{{name: "link", body: "../../..", mode: fs.ModeSymlink | 0777}}},
+		{"hard link out", []archiveEntry{{name: "passwd", body: "/etc/passwd", hardlink: true}}},
+		{"hard link to a symlink", []archiveEntry{
+			{name: "lib/link", body: ".", mode: fs.ModeSymlink | 0777},
+			{name: "lib/evil", body: "lib/link", hardlink: true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDownloader(t)
+			dest := filepath.Join(t.TempDir(), "vendor", "acme", "lib")
+			if err := d.extract(craftTar(t, "gzip", tt.entries...), "tar", dest); !errors.Is(err, ErrUnsafeArchive) {
+				t.Fatalf("extract() = %v, want ErrUnsafeArchive", err)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Error("package directory left behind")
+			}
+		})
+	}
+
+	d := newTestDownloader(t)
+	d.maxSize = 1024
+	bomb := craftTar(t, "gzip", archiveEntry{name: "a.txt", body: string(make([]byte, 2048))})
+	if err := d.extract(bomb, "gzip", filepath.Join(t.TempDir(), "lib")); !errors.Is(err, ErrUnsafeArchive) {
+		t.Errorf("extract() past the size limit = %v, want ErrUnsafeArchive", err)
+	}
+}
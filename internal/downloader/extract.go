@@ -0,0 +1,502 @@
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Limits on what a single archive may unpack to, against decompression
+// bombs. The largest packages on Packagist stay well below them.
+const (
+	defaultMaxExtractedSize  int64 = 1 << 30 // 1 GiB
+	defaultMaxExtractedFiles       = 100000
+)
+
+// ErrUnsafeArchive is returned for an archive that would write outside the
+// package directory, link out of it, or unpack past the size limits.
+var ErrUnsafeArchive = errors.New("unsafe archive")
+
+// archiveFormats are the dist types that can be extracted. "gzip", "bzip2"
+// and "xz" are tarballs compressed that way.
+var archiveFormats = map[string]bool{"zip": true, "tar": true, "gzip": true, "bzip2": true, "xz": true}
+
+// extract extracts the archive at archivePath to the destination directory,
+// stripping the top-level directory every entry is in, whatever the format.
+func (d *Downloader) extract(archivePath, distType, destDir string) error {
+	format, err := archiveFormat(archivePath, distType)
+	if err != nil {
+		return err
+	}
+	if format == "zip" {
+		return d.extractZip(archivePath, destDir)
+	}
+	return d.extractTar(archivePath, format, destDir)
+}
+
+// archiveFormat returns the format of the archive at path, as its first bytes
+// give it, or else as its dist type does. The content wins because
+// repositories often publish a tar.gz as "tar", or an archive without a type.
+func archiveFormat(path, distType string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return "zip", nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return "gzip", nil
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return "bzip2", nil
+	case bytes.HasPrefix(header, []byte("\xfd7zXZ\x00")):
+		return "xz", nil
+	case n >= 262 && string(header[257:262]) == "ustar":
+		return "tar", nil
+	}
+
+	if distType == "" {
+		return "zip", nil
+	}
+	if !archiveFormats[distType] {
+		return "", fmt.Errorf("unsupported dist type %q", distType)
+	}
+	return distType, nil
+}
+
+// extractZip extracts a zip archive to the destination directory
+func (d *Downloader) extractZip(zipPath, destDir string) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if len(reader.File) > d.maxFiles {
+		return fmt.Errorf("%w: %d entries, more than the limit of %d", ErrUnsafeArchive, len(reader.File), d.maxFiles)
+	}
+
+	names := make([]string, len(reader.File))
+	for i, file := range reader.File {
+		names[i] = file.Name
+	}
+
+	x := d.newExtractor(destDir, archiveRoot(names))
+	return x.run(func() error {
+		for _, file := range reader.File {
+			mode := file.Mode()
+			switch {
+			case mode.IsDir():
+				if err := x.dir(file.Name); err != nil {
+					return err
+				}
+			case mode&fs.ModeSymlink != 0:
+				target, err := readLink(file)
+				if err != nil {
+					return err
+				}
+				if err := x.symlink(file.Name, target); err != nil {
+					return err
+				}
+			case mode.IsRegular():
+				r, err := file.Open()
+				if err != nil {
+					return err
+				}
+				err = x.file(file.Name, mode, r)
+				r.Close()
+				if err != nil {
+					return err
+				}
+			}
+			// Devices, pipes and sockets are skipped.
+		}
+		return nil
+	})
+}
+
+// readLink returns the target of a symlink entry, stored as its content.
+func readLink(file *zip.File) (string, error) {
+	r, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	target, err := io.ReadAll(io.LimitReader(r, 4096))
+	return string(target), err
+}
+
+// extractTar extracts a tarball, compressed as format says, to the
+// destination directory. The archive is read twice, as tar has no central
+// directory: once for the names, and the sizes to check the limits against,
+// and once to extract it.
+func (d *Downloader) extractTar(tarPath, format, destDir string) error {
+	var names []string
+	var size int64
+	err := d.readTar(tarPath, format, func(header *tar.Header, _ io.Reader) error {
+		if !tarEntry(header) {
+			return nil
+		}
+		names = append(names, header.Name)
+		if len(names) > d.maxFiles {
+			return fmt.Errorf("%w: more than %d entries", ErrUnsafeArchive, d.maxFiles)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if size += header.Size; size > d.maxSize {
+				return fmt.Errorf("%w: unpacks to more than %d bytes", ErrUnsafeArchive, d.maxSize)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	x := d.newExtractor(destDir, archiveRoot(names))
+	return x.run(func() error {
+		return d.readTar(tarPath, format, func(header *tar.Header, r io.Reader) error {
+			switch header.Typeflag {
+			case tar.TypeDir:
+				return x.dir(header.Name)
+			case tar.TypeSymlink:
+				return x.symlink(header.Name, header.Linkname)
+			case tar.TypeLink:
+				return x.hardlink(header.Name, header.Linkname)
+			case tar.TypeReg:
+				return x.file(header.Name, header.FileInfo().Mode(), r)
+			}
+			// Devices, pipes and metadata entries such as the pax global
+			// header git writes are skipped.
+			return nil
+		})
+	})
+}
+
+// tarEntry reports whether header is for an entry that gets extracted.
+func tarEntry(header *tar.Header) bool {
+	switch header.Typeflag {
+	case tar.TypeDir, tar.TypeSymlink, tar.TypeLink, tar.TypeReg:
+		return true
+	}
+	return false
+}
+
+// readTar calls fn with each entry of a tarball compressed as format says.
+func (d *Downloader) readTar(tarPath, format string, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch format {
+	case "gzip":
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case "bzip2":
+		r = bzip2.NewReader(f)
+	case "xz":
+		return d.readXZ(f, func(r io.Reader) error { return forEachTar(r, fn) })
+	}
+	return forEachTar(r, fn)
+}
+
+func forEachTar(r io.Reader, fn func(*tar.Header, io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// readXZ calls fn with the decompressed content of f, which is piped through
+// the xz command, as the standard library has no xz package.
+func (d *Downloader) readXZ(f *os.File, fn func(io.Reader) error) error {
+	cmd := exec.Command("xz", "--decompress", "--stdout")
+	cmd.Stdin = f
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("xz archives need the xz command: %w", err)
+	}
+
+	err = fn(out)
+	if err == nil {
+		// Whatever follows the end of the tarball is read too, so that xz
+		// gets to check the whole stream, but no more than an archive may
+		// unpack to.
+		var n int64
+		n, err = io.Copy(io.Discard, io.LimitReader(out, d.maxSize+1))
+		if err == nil && n > d.maxSize {
+			err = fmt.Errorf("%w: unpacks to more than %d bytes", ErrUnsafeArchive, d.maxSize)
+		}
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("xz: %s", msg)
+		}
+		return fmt.Errorf("xz: %w", err)
+	}
+	return nil
+}
+
+// archiveRoot returns the top-level directory, with its trailing slash, that
+// every file in an archive is in, or "" if there is none.
+func archiveRoot(names []string) string {
+	var root string
+	for _, name := range names {
+		name = strings.TrimPrefix(name, "./")
+		if name == "" {
+			continue
+		}
+		dir, _, found := strings.Cut(name, "/")
+		if !found || dir == "" || dir == ".." || root != "" && dir+"/" != root {
+			return ""
+		}
+		root = dir + "/"
+	}
+	return root
+}
+
+// extractor writes the entries of an archive under dest, whatever the
+// format. Entries must stay inside dest once root is stripped from their
+// names, and together stay below the size and file count limits. File modes
+// are reduced to 0644, or 0755 for executables. Symlinks are created last,
+// so that no entry is written through one, and only if they point inside
+// dest.
+type extractor struct {
+	dest     string
+	root     string
+	maxSize  int64
+	maxFiles int
+
+	size     int64
+	files    int
+	symlinks [][2]string // link, target
+}
+
+func (d *Downloader) newExtractor(dest, root string) *extractor {
+	return &extractor{dest: dest, root: root, maxSize: d.maxSize, maxFiles: d.maxFiles}
+}
+
+// run creates dest, calls extract to write the entries, and then creates the
+// symlinks. If anything fails, dest is removed again.
+func (x *extractor) run(extract func() error) error {
+	if err := os.MkdirAll(x.dest, 0755); err != nil {
+		return err
+	}
+
+	err := extract()
+	if err == nil {
+		err = x.linkAll()
+	}
+	if err != nil {
+		os.RemoveAll(x.dest)
+	}
+	return err
+}
+
+// path returns where the entry called name goes, or "" for the root itself.
+func (x *extractor) path(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	rel := strings.TrimPrefix(strings.TrimPrefix(name, "./"), x.root)
+	rel = strings.TrimSuffix(rel, "/")
+	if rel == "" || rel == "." {
+		return "", nil
+	}
+	if strings.HasPrefix(rel, "/") || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf("%w: %s is outside the package directory", ErrUnsafeArchive, name)
+	}
+	return filepath.Join(x.dest, filepath.FromSlash(rel)), nil
+}
+
+// count adds an entry to the file count.
+func (x *extractor) count() error {
+	x.files++
+	if x.files > x.maxFiles {
+		return fmt.Errorf("%w: more than %d entries", ErrUnsafeArchive, x.maxFiles)
+	}
+	return nil
+}
+
+func (x *extractor) dir(name string) error {
+	dest, err := x.path(name)
+	if err != nil || dest == "" {
+		return err
+	}
+	if err := x.count(); err != nil {
+		return err
+	}
+	return os.MkdirAll(dest, 0755)
+}
+
+// file writes the content of an entry, counting what is really written
+// rather than trusting the size the archive claims.
+func (x *extractor) file(name string, mode fs.FileMode, r io.Reader) error {
+	dest, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	if dest == "" {
+		return fmt.Errorf("%w: file entry %s has no name", ErrUnsafeArchive, name)
+	}
+	if err := x.count(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	perm := fs.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	// A file left from an earlier entry of the same name is replaced rather
+	// than written through, in case it is a link.
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.LimitReader(r, x.maxSize-x.size+1))
+	x.size += n
+	if err != nil {
+		return err
+	}
+	if x.size > x.maxSize {
+		return fmt.Errorf("%w: unpacks to more than %d bytes", ErrUnsafeArchive, x.maxSize)
+	}
+	return f.Close()
+}
+
+// hardlink writes a copy of the file target, an earlier entry, as name.
+// Symlinks don't exist yet, so target can only be a file of the archive.
+func (x *extractor) hardlink(name, target string) error {
+	src, err := x.path(target)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Lstat(src); src == "" || err != nil || !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: hard link %s to %s, which is not a file of the archive", ErrUnsafeArchive, name, target)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return x.file(name, info.Mode(), f)
+}
+
+// symlink records a link to create once every file is written. Its target
+// must be relative and stay inside dest.
+func (x *extractor) symlink(name, target string) error {
+	dest, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	if dest == "" {
+		return fmt.Errorf("%w: symlink %s has no name", ErrUnsafeArchive, name)
+	}
+	if err := x.count(); err != nil {
+		return err
+	}
+
+	rel, _ := filepath.Rel(x.dest, dest)
+	resolved := path.Join(path.Dir(filepath.ToSlash(rel)), target)
+	if target == "" || path.IsAbs(target) || !filepath.IsLocal(filepath.FromSlash(resolved)) {
+		return fmt.Errorf("%w: symlink %s points outside the package directory (%s)", ErrUnsafeArchive, name, target)
+	}
+	x.symlinks = append(x.symlinks, [2]string{dest, target})
+	return nil
+}
+
+// linkAll creates the recorded symlinks, then checks that each still
+// resolves inside dest, which links through other links could get around.
+func (x *extractor) linkAll() error {
+	for _, link := range x.symlinks {
+		// A link is never created through another one, which could lead
+		// anywhere by the time it is followed.
+		for dir := filepath.Dir(link[0]); dir != x.dest && strings.HasPrefix(dir, x.dest); dir = filepath.Dir(dir) {
+			if info, err := os.Lstat(dir); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				rel, _ := filepath.Rel(x.dest, link[0])
+				return fmt.Errorf("%w: symlink %s is inside another symlink", ErrUnsafeArchive, filepath.ToSlash(rel))
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(link[0]), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(filepath.FromSlash(link[1]), link[0]); err != nil {
+			return err
+		}
+	}
+	if len(x.symlinks) == 0 {
+		return nil
+	}
+
+	dest, err := filepath.EvalSymlinks(x.dest)
+	if err != nil {
+		return err
+	}
+	for _, link := range x.symlinks {
+		resolved, err := filepath.EvalSymlinks(link[0])
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // dangling, like in the package's repository
+		}
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(dest, resolved); err != nil || !filepath.IsLocal(rel) {
+			rel, _ := filepath.Rel(x.dest, link[0])
+			return fmt.Errorf("%w: symlink %s points outside the package directory", ErrUnsafeArchive, filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
@@ -9,11 +9,16 @@ import (
 
 	"github.com/aras/presto/internal/packagist"
 	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/platform"
 	"github.com/aras/presto/internal/resolver"
 )
 
 type Generator struct {
 	client *packagist.Client
+
+	forcePreferStable bool
+	preferLowest      bool
+	platform          map[string]interface{}
 }
 
 func NewGenerator() *Generator {
@@ -24,7 +29,25 @@ func NewGeneratorWithClient(client *packagist.Client) *Generator {
 	return &Generator{client: client}
 }
 
+// SetPreferences records the --prefer-stable and --prefer-lowest modes the
+// packages were resolved with.
+func (g *Generator) SetPreferences(preferStable, preferLowest bool) {
+	g.forcePreferStable = preferStable
+	g.preferLowest = preferLowest
+}
+
+// SetPlatform sets the config.platform recorded as the lock's
+// platform-overrides, when it comes from more than composer.json.
+func (g *Generator) SetPlatform(config map[string]interface{}) {
+	g.platform = config
+}
+
 func (g *Generator) Generate(composer *parser.ComposerJSON, packages []*resolver.Package) error {
+	aliases, err := resolver.InlineAliases(composer)
+	if err != nil {
+		return err
+	}
+
 	lock := &parser.ComposerLock{
 		Readme: []string{
 			"This file locks the dependencies of your project to a known state",
@@ -34,11 +57,19 @@ func (g *Generator) Generate(composer *parser.ComposerJSON, packages []*resolver
 		ContentHash:      g.GenerateContentHash(composer),
 		Packages:         g.convertToLockedPackages(packages, false),
 		PackagesDev:      g.convertToLockedPackages(packages, true),
-		Aliases:          []interface{}{},
+		Aliases:          aliases,
 		MinimumStability: g.minimumStability(composer),
-		StabilityFlags:   map[string]int{},
+		StabilityFlags:   resolver.StabilityFlags(composer),
 		PreferStable:     g.preferStable(composer),
-		PreferLowest:     false,
+		PreferLowest:     g.preferLowest,
+	}
+
+	config := g.platform
+	if config == nil {
+		config, _ = composer.Config["platform"].(map[string]interface{})
+	}
+	if overrides, _ := platform.Overrides(config); len(overrides) > 0 {
+		lock.PlatformOverrides = overrides
 	}
 
 	// Platform requirements from require (production)
@@ -99,6 +130,13 @@ func (g *Generator) GenerateContentHash(composer *parser.ComposerJSON) string {
 		}
 	}
 
+	// config.platform changes what resolves, so it is part of the hash too
+	if platformConfig, ok := composer.Config["platform"]; ok {
+		if val, err := json.Marshal(map[string]interface{}{"platform": platformConfig}); err == nil {
+			relevant["config"] = val
+		}
+	}
+
 	// Sort keys for deterministic output (Composer sorts them too)
 	sortedKeys := make([]string, 0, len(relevant))
 	for k := range relevant {
@@ -155,8 +193,10 @@ func (g *Generator) buildLockedPackage(pkg *resolver.Package) parser.LockedPacka
 		if versionInfo, err := g.client.GetVersion(pkg.Name, pkg.Version); err == nil {
 			lockedPkg.Description = versionInfo.Description
 			lockedPkg.Keywords = versionInfo.Keywords
+			lockedPkg.Extra = versionInfo.Extra
 			lockedPkg.License = versionInfo.License
 			lockedPkg.Time = versionInfo.Time
+			lockedPkg.TransportOptions = versionInfo.TransportOptions
 
 			if versionInfo.Type != "" {
 				lockedPkg.Type = versionInfo.Type
@@ -196,12 +236,12 @@ func (g *Generator) buildLockedPackage(pkg *resolver.Package) parser.LockedPacka
 				Reference: versionInfo.Dist.Reference,
 				Shasum:    versionInfo.Dist.Shasum,
 			}
-			if lockedPkg.Dist.Type == "" {
-				lockedPkg.Dist.Type = "zip"
-			}
 			if lockedPkg.Dist.URL == "" {
 				lockedPkg.Dist.URL = pkg.URL
 			}
+			if lockedPkg.Dist.Type == "" && lockedPkg.Dist.URL != "" {
+				lockedPkg.Dist.Type = "zip"
+			}
 
 			// Autoload
 			if len(versionInfo.Autoload) > 0 && string(versionInfo.Autoload) != "null" {
@@ -212,16 +252,29 @@ func (g *Generator) buildLockedPackage(pkg *resolver.Package) parser.LockedPacka
 			}
 
 			lockedPkg.Require = versionInfo.Require
+			lockedPkg.Conflict = versionInfo.Conflict
+			lockedPkg.Provide = versionInfo.Provide
+			lockedPkg.Replace = versionInfo.Replace
 			lockedPkg.RequireDev = versionInfo.RequireDev
 		}
 	}
 
-	// Fallback values if client wasn't available or lookup failed
-	if lockedPkg.Dist.URL == "" {
+	// Fallback values if client wasn't available or lookup failed. Packages
+	// installed from their repository have no archive.
+	if lockedPkg.Dist.URL == "" && pkg.URL != "" {
 		lockedPkg.Dist = parser.DistInfo{
 			Type: "zip",
 			URL:  pkg.URL,
 		}
+		if pkg.Dist.Type != "" {
+			lockedPkg.Dist.Type = pkg.Dist.Type
+		}
+		lockedPkg.TransportOptions = pkg.TransportOptions
+	}
+	// The integrity the downloader verified or computed, for the archive it
+	// fetched.
+	if lockedPkg.Dist.URL == pkg.URL && pkg.URL != "" {
+		lockedPkg.Dist.Integrity = pkg.Dist.Integrity
 	}
 	if lockedPkg.Require == nil {
 		lockedPkg.Require = pkg.Require
@@ -247,5 +300,5 @@ func (g *Generator) minimumStability(composer *parser.ComposerJSON) string {
 }
 
 func (g *Generator) preferStable(composer *parser.ComposerJSON) bool {
-	return composer.PreferStable
+	return composer.PreferStable || g.forcePreferStable
 }
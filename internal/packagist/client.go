@@ -2,25 +2,58 @@ package packagist
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
+
+	"github.com/aras/presto/internal/auth"
+	"github.com/aras/presto/internal/cache"
 )
 
 const (
 	PackagistAPIURL = "https://repo.packagist.org"
-	CacheDir        = ".presto/cache"
+
+	// MetadataTTL is how long metadata cached on disk is used without asking
+	// the server whether it changed.
+	MetadataTTL = 5 * time.Minute
 )
 
-// Client handles communication with Packagist API
+// Client handles communication with Packagist API, and with the other
+// repositories a project declares (see SetRepositories). It is safe for
+// concurrent use: metadata is cached, and simultaneous requests for the same
+// package share a single HTTP call.
+//
+// Metadata is also kept on disk, in the user cache directory. Once it is
+// older than MetadataTTL, it is revalidated with If-Modified-Since. Offline,
+// only the disk cache is used.
 type Client struct {
-	httpClient *http.Client
-	baseURL    string
-	cache      map[string]*PackageInfo
+	httpClient  *http.Client
+	baseURL     string
+	repos       []*configuredRepository
+	disk        *cache.Cache
+	metadataTTL time.Duration
+	offline     bool
+
+	mu       sync.Mutex
+	cache    map[string]*PackageInfo
+	inflight map[string]*metadataCall
+	missing  map[string]bool // metadata files asked for offline but not cached
+}
+
+// metadataCall is a metadata request in flight. Its result is available once
+// done is closed.
+type metadataCall struct {
+	done chan struct{}
+	info *PackageInfo
+	err  error
 }
 
 // PackageInfo represents package metadata from Packagist
@@ -35,22 +68,27 @@ type PackageInfo struct {
 
 // VersionInfo represents a specific package version
 type VersionInfo struct {
-	Name              string            `json:"name"`
-	Version           string            `json:"version"`
-	VersionNormalized string            `json:"version_normalized"`
-	Description       string            `json:"description"`
-	Type              string            `json:"type"`
-	Keywords          []string          `json:"keywords"`
-	Homepage          string            `json:"homepage"`
-	License           []string          `json:"license"`
-	Authors           []Author          `json:"authors"`
-	Require           map[string]string `json:"require"`
-	RequireDev        map[string]string `json:"require-dev"`
-	Autoload          json.RawMessage   `json:"autoload"`
-	Time              string            `json:"time"`
-	Dist              DistInfo          `json:"dist"`
-	Source            SourceInfo        `json:"source"`
-	NotificationURL   string            `json:"notification-url"`
+	Name              string                 `json:"name"`
+	Version           string                 `json:"version"`
+	VersionNormalized string                 `json:"version_normalized"`
+	Description       string                 `json:"description"`
+	Type              string                 `json:"type"`
+	Keywords          []string               `json:"keywords"`
+	Homepage          string                 `json:"homepage"`
+	License           []string               `json:"license"`
+	Authors           []Author               `json:"authors"`
+	Require           map[string]string      `json:"require"`
+	RequireDev        map[string]string      `json:"require-dev"`
+	Conflict          map[string]string      `json:"conflict"`
+	Replace           map[string]string      `json:"replace"`
+	Provide           map[string]string      `json:"provide"`
+	Autoload          json.RawMessage        `json:"autoload"`
+	Extra             map[string]interface{} `json:"extra"`
+	Time              string                 `json:"time"`
+	Dist              DistInfo               `json:"dist"`
+	Source            SourceInfo             `json:"source"`
+	NotificationURL   string                 `json:"notification-url"`
+	TransportOptions  map[string]interface{} `json:"transport-options"`
 }
 
 type Author struct {
@@ -66,6 +104,7 @@ type DistInfo struct {
 	URL       string `json:"url"`
 	Reference string `json:"reference"`
 	Shasum    string `json:"shasum"`
+	Integrity string `json:"integrity,omitempty"` // recorded by presto in composer.lock
 }
 
 func (d *DistInfo) UnmarshalJSON(data []byte) error {
@@ -106,39 +145,163 @@ type PackageMetadata struct {
 	Packages map[string]map[string]*VersionInfo `json:"packages"`
 }
 
-// NewClient creates a new Packagist client
+// errNotFound is wrapped by the errors for packages a repository doesn't have.
+var errNotFound = errors.New("package not found")
+
+// NewClient creates a new client that reads packages from Packagist
 func NewClient() *Client {
-	return &Client{
+	c := &Client{
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		baseURL: PackagistAPIURL,
-		cache:   make(map[string]*PackageInfo),
+		baseURL:     PackagistAPIURL,
+		disk:        cache.New(cache.Dir()),
+		metadataTTL: MetadataTTL,
+		cache:       make(map[string]*PackageInfo),
+		inflight:    make(map[string]*metadataCall),
+		missing:     make(map[string]bool),
 	}
+	c.repos = []*configuredRepository{c.packagist()}
+	return c
 }
 
-// GetPackage fetches package information from Packagist
-func (c *Client) GetPackage(name string) (*PackageInfo, error) {
-	// Check cache
-	if cached, ok := c.cache[name]; ok {
-		return cached, nil
+// SetCredentials makes the client authenticate to the hosts creds has
+// credentials for.
+func (c *Client) SetCredentials(creds *auth.Credentials) {
+	c.httpClient.Transport = &auth.Transport{Credentials: creds, Base: c.httpClient.Transport}
+}
+
+// SetCache sets where metadata is cached on disk. nil disables the disk
+// cache.
+func (c *Client) SetCache(disk *cache.Cache) {
+	c.disk = disk
+}
+
+// SetOffline makes the client serve metadata from the disk cache only, at
+// whatever age, and never contact the server.
+func (c *Client) SetOffline(offline bool) {
+	c.offline = offline
+}
+
+// Missing lists the metadata files that were asked for offline but are not
+// in the disk cache, e.g. "vendor/name" or "vendor/name~dev".
+func (c *Client) Missing() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	missing := make([]string, 0, len(c.missing))
+	for file := range c.missing {
+		missing = append(missing, file)
 	}
+	sort.Strings(missing)
+	return missing
+}
 
+// GetPackage fetches package information from the configured repositories
+func (c *Client) GetPackage(name string) (*PackageInfo, error) {
 	// Normalize package name
 	name = strings.ToLower(strings.TrimSpace(name))
 
-	// Use the p2 API endpoint (metadata v2)
-	url := fmt.Sprintf("%s/p2/%s.json", c.baseURL, name)
+	return c.load(name, func() (*PackageInfo, error) {
+		info, err := c.collect(name, false)
+		if err != nil {
+			return nil, err
+		}
+
+		// Find latest stable version
+		info.LatestVersion = c.findLatestStable(info.Versions)
+		return info, nil
+	})
+}
+
+// GetDevPackage fetches the dev branches of a package, which Packagist
+// serves separately from tagged releases (p2/<name>~dev.json).
+func (c *Client) GetDevPackage(name string) (*PackageInfo, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	return c.load(name+"~dev", func() (*PackageInfo, error) {
+		return c.collect(name, true)
+	})
+}
+
+// load returns the cached metadata for key, or fetches it. Callers asking for
+// a key that is already being fetched wait for that request instead of
+// making their own. Failures are not cached.
+func (c *Client) load(key string, fetch func() (*PackageInfo, error)) (*PackageInfo, error) {
+	c.mu.Lock()
+	if info, ok := c.cache[key]; ok {
+		c.mu.Unlock()
+		return info, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.info, call.err
+	}
+	call := &metadataCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	call.info, call.err = fetch()
+
+	c.mu.Lock()
+	if call.err == nil {
+		c.cache[key] = call.info
+	}
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.info, call.err
+}
+
+// fetchDocument returns the JSON document at url. The document is cached on
+// disk under key and used without a request while younger than the metadata
+// TTL; after that it is revalidated with If-Modified-Since. Offline, only the
+// cached copy is used, and file (e.g. "vendor/name") is recorded as missing
+// when there is none. A 404 returns an error wrapping errNotFound.
+func (c *Client) fetchDocument(url, key, file string) ([]byte, error) {
+	cached, lastModified, age := c.cachedMetadata(key)
+	if c.offline {
+		return c.offlineDocument(key, file, cached)
+	}
+	if cached != nil && age < c.metadataTTL {
+		return cached, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch package: %w", err)
+	}
+	if cached != nil && lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
 
 	// Make request
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		// Stale metadata beats none when the server can't be reached.
+		if cached != nil {
+			return cached, nil
+		}
 		return nil, fmt.Errorf("failed to fetch package: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		_ = c.disk.Touch(key)
+		return cached, nil
+	}
+	if resp.StatusCode == http.StatusNotFound && c.disk != nil {
+		// Remember that the document doesn't exist, so that offline it isn't
+		// reported as missing from the cache. Online it is always asked again.
+		_ = c.disk.Write(notFoundCacheKey(key), nil)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s (status: %d)", errNotFound, file, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("package not found: %s (status: %d)", name, resp.StatusCode)
+		return nil, fmt.Errorf("failed to fetch %s (status: %d)", file, resp.StatusCode)
 	}
 
 	// Read response
@@ -146,73 +309,182 @@ func (c *Client) GetPackage(name string) (*PackageInfo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("failed to parse response: invalid JSON in %s", file)
+	}
+
+	c.storeMetadata(key, body, resp.Header.Get("Last-Modified"))
+	return body, nil
+}
+
+// offlineDocument serves a document from the disk cache alone, recording it
+// as missing when it isn't there.
+func (c *Client) offlineDocument(key, file string, cached []byte) ([]byte, error) {
+	if cached != nil {
+		return cached, nil
+	}
+	if c.disk != nil && c.disk.Has(notFoundCacheKey(key)) {
+		return nil, fmt.Errorf("%w: %s", errNotFound, file)
+	}
+
+	c.mu.Lock()
+	c.missing[file] = true
+	c.mu.Unlock()
+	return nil, fmt.Errorf("metadata for %s: %w", file, cache.ErrOffline)
+}
+
+var unsafeCacheChars = regexp.MustCompile(`[^a-zA-Z0-9.]`)
+
+// repoCacheKey names a file cached for the repository at repoURL the way
+// Composer does: repo/https---repo.packagist.org/<file>.
+func repoCacheKey(repoURL, file string) string {
+	return "repo/" + unsafeCacheChars.ReplaceAllString(strings.TrimRight(repoURL, "/"), "-") + "/" + file
+}
+
+// metadataCacheKey names the cached copy of a package's metadata file, e.g.
+// repo/https---repo.packagist.org/provider-vendor~name.json.
+func metadataCacheKey(repoURL, file string) string {
+	return repoCacheKey(repoURL, "provider-"+strings.ReplaceAll(file, "/", "~")+".json")
+}
+
+// notFoundCacheKey names the marker recording that the server had no document
+// for key.
+func notFoundCacheKey(key string) string {
+	return strings.TrimSuffix(key, ".json") + ".404"
+}
+
+// cachedMetadata returns the cached document for key, its Last-Modified date
+// and how long ago it was last fetched or revalidated. body is nil when
+// nothing usable is cached.
+func (c *Client) cachedMetadata(key string) (body []byte, lastModified string, age time.Duration) {
+	if c.disk == nil {
+		return nil, "", 0
+	}
+	body, modTime, err := c.disk.Read(key)
+	if err != nil {
+		return nil, "", 0
+	}
+
+	var doc struct {
+		LastModified string `json:"last-modified"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, "", 0
+	}
+	return body, doc.LastModified, time.Since(modTime)
+}
+
+// storeMetadata writes a fetched document to the disk cache, with the
+// server's Last-Modified date under "last-modified" as Composer stores it.
+// The cache is best effort: failing to write it doesn't fail the request.
+func (c *Client) storeMetadata(key string, body []byte, lastModified string) {
+	if c.disk == nil {
+		return
+	}
+	if lastModified != "" {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return
+		}
+		doc["last-modified"], _ = json.Marshal(lastModified)
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			return
+		}
+		body = encoded
+	}
+	_ = c.disk.Write(key, body)
+}
 
+// parseP2Metadata parses a metadata v2 document (p2/<name>.json) into
+// versions keyed by their pretty version string.
+func parseP2Metadata(body []byte, name string) (map[string]*VersionInfo, string, error) {
 	// Parse response - Packagist v2 format has "packages" with package name as key
 	var apiResp struct {
-		Packages map[string][]struct {
-			Version         string          `json:"version"`
-			Description     string          `json:"description"`
-			Type            string          `json:"type"`
-			Keywords        []string        `json:"keywords"`
-			Homepage        string          `json:"homepage"`
-			License         []string        `json:"license"`
-			Authors         []Author        `json:"authors"`
-			Require         json.RawMessage `json:"require"`     // Can be null, [], {}, or map
-			RequireDev      json.RawMessage `json:"require-dev"` // Can be null, [], {}, or map
-			Autoload        json.RawMessage `json:"autoload"`    // Use RawMessage for debugging
-			Time            string          `json:"time"`
-			Dist            DistInfo        `json:"dist"`
-			Source          SourceInfo      `json:"source"`
-			NotificationURL string          `json:"notification-url"`
-		} `json:"packages"`
+		Packages map[string][]map[string]json.RawMessage `json:"packages"`
+		Minified string                                  `json:"minified"`
 	}
 
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	// Get versions for this package
 	versions, ok := apiResp.Packages[name]
 	if !ok || len(versions) == 0 {
-		return nil, fmt.Errorf("no versions found for package: %s", name)
+		return nil, "", fmt.Errorf("no versions found for package %s: %w", name, errNotFound)
 	}
 
-	// Convert to our format
+	if apiResp.Minified == "composer/2.0" {
+		versions = expandMinified(versions)
+	}
+
+	versionMap, description := parseVersions(versions, name)
+	return versionMap, description, nil
+}
+
+// parseVersions converts raw version objects into versions keyed by their
+// pretty version string, and returns the first description found.
+func parseVersions(versions []map[string]json.RawMessage, name string) (map[string]*VersionInfo, string) {
 	versionMap := make(map[string]*VersionInfo)
 	var description string
 
-	for _, v := range versions {
-		// Parse require-dev flexibly
-		var requireDev map[string]string
-		if len(v.RequireDev) > 0 && string(v.RequireDev) != "null" {
-			// Try to unmarshal as map, ignore errors if it's an array (empty requirements)
-			_ = json.Unmarshal(v.RequireDev, &requireDev)
+	for _, fields := range versions {
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			continue
 		}
 
-		// Parse require flexibly
-		var require map[string]string
-		if len(v.Require) > 0 && string(v.Require) != "null" {
-
-			// Try to unmarshal as map, ignore errors if it's an array (empty requirements)
-			_ = json.Unmarshal(v.Require, &require)
+		var v struct {
+			Version           string                 `json:"version"`
+			VersionNormalized string                 `json:"version_normalized"`
+			Description       string                 `json:"description"`
+			Type              string                 `json:"type"`
+			Keywords          []string               `json:"keywords"`
+			Homepage          string                 `json:"homepage"`
+			License           []string               `json:"license"`
+			Authors           []Author               `json:"authors"`
+			Require           json.RawMessage        `json:"require"`     // Can be null, [], {}, or map
+			RequireDev        json.RawMessage        `json:"require-dev"` // Can be null, [], {}, or map
+			Conflict          json.RawMessage        `json:"conflict"`
+			Replace           json.RawMessage        `json:"replace"`
+			Provide           json.RawMessage        `json:"provide"`
+			Autoload          json.RawMessage        `json:"autoload"` // Use RawMessage for debugging
+			Extra             json.RawMessage        `json:"extra"`
+			Time              string                 `json:"time"`
+			Dist              DistInfo               `json:"dist"`
+			Source            SourceInfo             `json:"source"`
+			NotificationURL   string                 `json:"notification-url"`
+			TransportOptions  map[string]interface{} `json:"transport-options"`
+		}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			// Skip versions with malformed metadata rather than failing the
+			// whole package.
+			continue
 		}
 
 		versionMap[v.Version] = &VersionInfo{
-			Name:            name,
-			Version:         v.Version,
-			Description:     v.Description,
-			Type:            v.Type,
-			Keywords:        v.Keywords,
-			Homepage:        v.Homepage,
-			License:         v.License,
-			Authors:         v.Authors,
-			Require:         require,
-			RequireDev:      requireDev,
-			Autoload:        v.Autoload,
-			Time:            v.Time,
-			Dist:            v.Dist,
-			Source:          v.Source,
-			NotificationURL: v.NotificationURL,
+			Name:              name,
+			Version:           v.Version,
+			VersionNormalized: v.VersionNormalized,
+			Description:       v.Description,
+			Type:              v.Type,
+			Keywords:          v.Keywords,
+			Homepage:          v.Homepage,
+			License:           v.License,
+			Authors:           v.Authors,
+			Require:           parseLinks(v.Require),
+			RequireDev:        parseLinks(v.RequireDev),
+			Conflict:          parseLinks(v.Conflict),
+			Replace:           parseLinks(v.Replace),
+			Provide:           parseLinks(v.Provide),
+			Autoload:          v.Autoload,
+			Extra:             parseExtra(v.Extra),
+			Time:              v.Time,
+			Dist:              v.Dist,
+			Source:            v.Source,
+			NotificationURL:   v.NotificationURL,
+			TransportOptions:  v.TransportOptions,
 		}
 
 		if v.Description != "" && description == "" {
@@ -220,19 +492,72 @@ func (c *Client) GetPackage(name string) (*PackageInfo, error) {
 		}
 	}
 
-	info := &PackageInfo{
-		Name:        name,
-		Description: description,
-		Versions:    versionMap,
+	return versionMap, description
+}
+
+// expandMinified undoes Composer's metadata minification, where every version
+// after the first only lists the keys that changed from the previous one and
+// "__unset" marks a removed key.
+func expandMinified(versions []map[string]json.RawMessage) []map[string]json.RawMessage {
+	expanded := make([]map[string]json.RawMessage, 0, len(versions))
+	var previous map[string]json.RawMessage
+
+	for _, v := range versions {
+		current := make(map[string]json.RawMessage, len(previous)+len(v))
+		for k, val := range previous {
+			current[k] = val
+		}
+		for k, val := range v {
+			if string(val) == `"__unset"` {
+				delete(current, k)
+				continue
+			}
+			current[k] = val
+		}
+
+		expanded = append(expanded, current)
+		previous = current
+	}
+
+	return expanded
+}
+
+// parseLinks decodes a require-style map, which Packagist may also send as
+// null or an empty array.
+func parseLinks(raw json.RawMessage) map[string]string {
+	var links map[string]string
+	if len(raw) > 0 && string(raw) != "null" {
+		// Try to unmarshal as map, ignore errors if it's an array (empty requirements)
+		_ = json.Unmarshal(raw, &links)
 	}
+	return links
+}
 
-	// Find latest stable version
-	info.LatestVersion = c.findLatestStable(versionMap)
+// parseExtra decodes the "extra" object, which may also be sent as an empty
+// array.
+func parseExtra(raw json.RawMessage) map[string]interface{} {
+	var extra map[string]interface{}
+	if len(raw) > 0 && string(raw) != "null" {
+		_ = json.Unmarshal(raw, &extra)
+	}
+	return extra
+}
 
-	// Cache the result
-	c.cache[name] = info
+// BranchAliases returns the version's "extra.branch-alias" map, e.g.
+// {"dev-main": "2.x-dev"}.
+func (v *VersionInfo) BranchAliases() map[string]string {
+	raw, ok := v.Extra["branch-alias"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
 
-	return info, nil
+	aliases := make(map[string]string, len(raw))
+	for branch, alias := range raw {
+		if s, ok := alias.(string); ok {
+			aliases[branch] = s
+		}
+	}
+	return aliases
 }
 
 // normalizeFourPartVersion truncates a four-part Composer version (e.g. 9.18.1.10)
@@ -303,12 +628,22 @@ func (c *Client) findLatestStable(versions map[string]*VersionInfo) string {
 
 // GetVersion fetches a specific version of a package
 func (c *Client) GetVersion(name, version string) (*VersionInfo, error) {
+	var versionInfo *VersionInfo
 	info, err := c.GetPackage(name)
-	if err != nil {
+	ok := err == nil
+	if ok {
+		versionInfo, ok = info.Versions[version]
+	}
+	// A package may have nothing but branches, so their metadata is looked
+	// at even without releases.
+	if !ok && isDevVersion(version) {
+		if dev, devErr := c.GetDevPackage(name); devErr == nil {
+			versionInfo, ok = dev.Versions[version]
+		}
+	}
+	if !ok && err != nil {
 		return nil, err
 	}
-
-	versionInfo, ok := info.Versions[version]
 	if !ok {
 		return nil, fmt.Errorf("version %s not found for package %s", version, name)
 	}
@@ -364,38 +699,25 @@ func (c *Client) DownloadPackage(name, version string) (string, error) {
 		return "", err
 	}
 
-	if versionInfo.Dist.URL != "" {
-		return versionInfo.Dist.URL, nil
-	}
-
-	// Fallback to source if dist is missing
-	if versionInfo.Source.URL != "" {
-		url := versionInfo.Source.URL
-		ref := versionInfo.Source.Reference
-
-		// If it's a Git URL, try to convert it to a ZIP download URL
-		// as our downloader only supports ZIPs for now.
-		if versionInfo.Source.Type == "git" {
-			// GitHub: https://github.com/user/repo -> https://github.com/user/repo/archive/{ref}.zip
-			if strings.Contains(url, "github.com") {
-				repoURL := strings.TrimSuffix(url, ".git")
-				return fmt.Sprintf("%s/archive/%s.zip", repoURL, ref), nil
-			}
-			// Codeberg: https://codeberg.org/user/repo -> https://codeberg.org/user/repo/archive/{ref}.zip
-			if strings.Contains(url, "codeberg.org") {
-				repoURL := strings.TrimSuffix(url, ".git")
-				return fmt.Sprintf("%s/archive/%s.zip", repoURL, ref), nil
-			}
-			// GitLab: https://gitlab.com/user/repo -> https://gitlab.com/user/repo/-/archive/{ref}/repo-{ref}.zip
-			if strings.Contains(url, "gitlab.com") {
-				repoURL := strings.TrimSuffix(url, ".git")
-				// Simple fallback for GitLab
-				return fmt.Sprintf("%s/-/archive/%s/archive.zip", repoURL, ref), nil
-			}
-		}
+	return versionInfo.DownloadURL()
+}
 
-		return url, nil
+// DownloadURL returns the archive URL for this version, falling back to the
+// source repository's URL when there is no dist. A git repository is then
+// installed from a clone rather than downloaded.
+func (v *VersionInfo) DownloadURL() (string, error) {
+	if v.Dist.URL != "" {
+		return v.Dist.URL, nil
 	}
+	if v.Source.URL != "" {
+		return v.Source.URL, nil
+	}
+
+	return "", fmt.Errorf("no download URL found for %s@%s", v.Name, v.Version)
+}
 
-	return "", fmt.Errorf("no download URL found for %s@%s", name, version)
+// InstallsFromSource reports whether the version has no archive to download,
+// so it has to be installed from its git repository.
+func (v *VersionInfo) InstallsFromSource() bool {
+	return v.Dist.URL == "" && v.Source.Type == "git" && v.Source.URL != ""
 }
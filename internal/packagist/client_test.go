@@ -0,0 +1,287 @@
+package packagist
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aras/presto/internal/cache"
+)
+
+// lastModified is the Last-Modified date metadataServer sends with every
+// document.
+const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// metadataServer serves p2 metadata for a few packages and counts the
+// requests for every path. Requests with a matching If-Modified-Since get
+// 304 Not Modified.
+type metadataServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	requests    map[string]int
+	notModified map[string]int
+}
+
+func newMetadataServer(t *testing.T, delay time.Duration) *metadataServer {
+	t.Helper()
+
+	s := &metadataServer{requests: make(map[string]int), notModified: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.mu.Unlock()
+
+		time.Sleep(delay)
+
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			s.mu.Lock()
+			s.notModified[r.URL.Path]++
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/p2/"), ".json")
+		if strings.HasPrefix(name, "missing/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		version := "1.0.0"
+		if base, ok := strings.CutSuffix(name, "~dev"); ok {
+			name, version = base, "dev-main"
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprintf(w, `{"packages":{%q:[{"name":%q,"version":%q,"require":{"php":">=8.1"}}]}}`, name, name, version)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *metadataServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func (s *metadataServer) countNotModified(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notModified[path]
+}
+
+// newTestClient returns a client for baseURL that caches metadata in dir.
+func newTestClient(baseURL, dir string) *Client {
+	c := NewClient()
+	c.baseURL = baseURL
+	c.repos = []*configuredRepository{c.packagist()}
+	c.SetCache(cache.New(dir))
+	return c
+}
+
+func TestClient_ConcurrentRequestsAreCoalesced(t *testing.T) {
+	server := newMetadataServer(t, 20*time.Millisecond)
+	client := newTestClient(server.URL, t.TempDir())
+
+	names := []string{"a/a", "b/b", "c/c", "d/d"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 50; i++ {
+		for _, name := range names {
+			wg.Add(1)
+			go func(name string, dev bool) {
+				defer wg.Done()
+
+				get, want := client.GetPackage, "1.0.0"
+				if dev {
+					get, want = client.GetDevPackage, "dev-main"
+				}
+				info, err := get(strings.ToUpper(name))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if info.Name != name || info.Versions[want] == nil {
+					errs <- fmt.Errorf("got %s with versions %v, want %s %s", info.Name, info.Versions, name, want)
+				}
+			}(name, i%2 == 1)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for _, name := range names {
+		for _, path := range []string{"/p2/" + name + ".json", "/p2/" + name + "~dev.json"} {
+			if got := server.count(path); got != 1 {
+				t.Errorf("%s requested %d times, want 1", path, got)
+			}
+		}
+	}
+}
+
+func TestClient_ConcurrentGetVersion(t *testing.T) {
+	server := newMetadataServer(t, 0)
+	client := newTestClient(server.URL, t.TempDir())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("pkg/p%d", i%10)
+			version := "1.0.0"
+			if i%3 == 0 {
+				version = "dev-main"
+			}
+			if _, err := client.GetVersion(name, version); err != nil {
+				t.Errorf("GetVersion(%s, %s) returned error: %v", name, version, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClient_FailuresAreNotCached(t *testing.T) {
+	server := newMetadataServer(t, 0)
+	client := newTestClient(server.URL, t.TempDir())
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetPackage("missing/pkg"); err == nil {
+			t.Fatal("GetPackage(missing/pkg) expected an error")
+		}
+	}
+
+	if got := server.count("/p2/missing/pkg.json"); got != 2 {
+		t.Errorf("missing/pkg requested %d times, want 2", got)
+	}
+}
+
+func TestClient_DiskCache(t *testing.T) {
+	server := newMetadataServer(t, 0)
+	dir := t.TempDir()
+	path := "/p2/a/a.json"
+
+	get := func(client *Client) {
+		t.Helper()
+		info, err := client.GetPackage("a/a")
+		if err != nil {
+			t.Fatalf("GetPackage(a/a) returned error: %v", err)
+		}
+		if info.Versions["1.0.0"] == nil {
+			t.Fatalf("GetPackage(a/a) returned versions %v, want 1.0.0", info.Versions)
+		}
+	}
+
+	// A fresh process fetches and stores the document.
+	get(newTestClient(server.URL, dir))
+	if got := server.count(path); got != 1 {
+		t.Fatalf("%s requested %d times, want 1", path, got)
+	}
+
+	entries, err := cache.New(dir).Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Key, "/provider-a~a.json") || !strings.HasPrefix(entries[0].Key, "repo/http---127.0.0.1-") {
+		t.Fatalf("cache entries = %v, want one repo/http---127.0.0.1-*/provider-a~a.json", entries)
+	}
+
+	// Within the TTL the next process doesn't ask the server.
+	get(newTestClient(server.URL, dir))
+	if got := server.count(path); got != 1 {
+		t.Errorf("%s requested %d times within the TTL, want 1", path, got)
+	}
+
+	// Once expired, the copy is revalidated and served from disk on 304.
+	client := newTestClient(server.URL, dir)
+	client.metadataTTL = 0
+	get(client)
+	if got := server.countNotModified(path); got != 1 {
+		t.Errorf("%s revalidated %d times, want 1", path, got)
+	}
+
+	// Without the server, the stale copy is still used.
+	server.Close()
+	client = newTestClient(server.URL, dir)
+	client.metadataTTL = 0
+	get(client)
+}
+
+func TestClient_CorruptCacheIsRefetched(t *testing.T) {
+	server := newMetadataServer(t, 0)
+	dir := t.TempDir()
+
+	client := newTestClient(server.URL, dir)
+	key := metadataCacheKey(server.URL, "a/a")
+	if err := cache.New(dir).Write(key, []byte("{not json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetPackage("a/a"); err != nil {
+		t.Fatalf("GetPackage(a/a) returned error: %v", err)
+	}
+	if got := server.count("/p2/a/a.json"); got != 1 {
+		t.Errorf("/p2/a/a.json requested %d times, want 1", got)
+	}
+
+	data, err := os.ReadFile(dir + "/" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"last-modified":"`+lastModified+`"`) {
+		t.Errorf("cached document %s does not record last-modified", data)
+	}
+}
+
+func TestClient_Offline(t *testing.T) {
+	server := newMetadataServer(t, 0)
+	dir := t.TempDir()
+
+	online := newTestClient(server.URL, dir)
+	if _, err := online.GetPackage("a/a"); err != nil {
+		t.Fatalf("GetPackage(a/a) returned error: %v", err)
+	}
+	if _, err := online.GetPackage("missing/pkg"); err == nil {
+		t.Fatal("GetPackage(missing/pkg) expected an error")
+	}
+	server.Close()
+
+	client := newTestClient(server.URL, dir)
+	client.metadataTTL = 0
+	client.SetOffline(true)
+
+	if _, err := client.GetPackage("a/a"); err != nil {
+		t.Errorf("offline GetPackage(a/a) returned error: %v", err)
+	}
+
+	// Known not to exist: an error, but not a cache miss.
+	if _, err := client.GetPackage("missing/pkg"); err == nil || errors.Is(err, cache.ErrOffline) {
+		t.Errorf("offline GetPackage(missing/pkg) = %v, want a not found error", err)
+	}
+
+	if _, err := client.GetPackage("b/b"); !errors.Is(err, cache.ErrOffline) {
+		t.Errorf("offline GetPackage(b/b) = %v, want cache.ErrOffline", err)
+	}
+	if _, err := client.GetDevPackage("a/a"); !errors.Is(err, cache.ErrOffline) {
+		t.Errorf("offline GetDevPackage(a/a) = %v, want cache.ErrOffline", err)
+	}
+
+	if got, want := client.Missing(), []string{"a/a~dev", "b/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,266 @@
+package packagist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maxIncludeDepth bounds how deeply packages.json includes may nest.
+const maxIncludeDepth = 5
+
+// composerRepository reads a Composer repository: Packagist, or a private one
+// such as Satis, Private Packagist or Repman. Its packages.json may list
+// packages inline or through includes, or point at per-package files through
+// metadata-url (v2) or providers-url (v1).
+type composerRepository struct {
+	client *Client
+	url    string
+
+	once sync.Once
+	root *repositoryRoot
+	err  error
+}
+
+// repositoryRoot is what packages.json says about the repository, with its
+// includes and provider listings loaded.
+type repositoryRoot struct {
+	metadataURL       string
+	providersURL      string
+	available         map[string]bool  // if listed, the only packages there are
+	availablePatterns []*regexp.Regexp // same, as name patterns
+	providers         map[string]string
+	packages          map[string][]map[string]json.RawMessage
+}
+
+// packagesDocument is packages.json, or a file it includes.
+type packagesDocument struct {
+	Packages                 json.RawMessage                    `json:"packages"`
+	Includes                 map[string]json.RawMessage         `json:"includes"`
+	MetadataURL              string                             `json:"metadata-url"`
+	ProvidersURL             string                             `json:"providers-url"`
+	ProviderIncludes         map[string]struct{ SHA256 string } `json:"provider-includes"`
+	Providers                map[string]struct{ SHA256 string } `json:"providers"`
+	AvailablePackages        []string                           `json:"available-packages"`
+	AvailablePackagePatterns []string                           `json:"available-package-patterns"`
+}
+
+func newComposerRepository(c *Client, repoURL string) *composerRepository {
+	return &composerRepository{client: c, url: strings.TrimRight(repoURL, "/")}
+}
+
+// newPackagistRepository returns Packagist at repoURL. Its packages.json is
+// known, so it isn't fetched.
+func newPackagistRepository(c *Client, repoURL string) *composerRepository {
+	r := newComposerRepository(c, repoURL)
+	r.once.Do(func() {
+		r.root = &repositoryRoot{metadataURL: "/p2/%package%.json"}
+	})
+	return r
+}
+
+func (r *composerRepository) packageInfo(name string, dev bool) (*PackageInfo, error) {
+	root, err := r.loadRoot()
+	if err != nil {
+		return nil, err
+	}
+	if !root.has(name) {
+		return nil, fmt.Errorf("%w: %s", errNotFound, name)
+	}
+
+	if versions, ok := root.packages[name]; ok {
+		return versionsInfo(name, filterDev(versions, dev))
+	}
+
+	if root.metadataURL != "" {
+		file := name
+		if dev {
+			file += "~dev"
+		}
+		ref := strings.ReplaceAll(root.metadataURL, "%package%", file)
+		body, err := r.client.fetchDocument(r.resolve(ref), metadataCacheKey(r.url, file), file)
+		if err != nil {
+			return nil, err
+		}
+
+		versions, description, err := parseP2Metadata(body, name)
+		if err != nil {
+			return nil, err
+		}
+		return &PackageInfo{Name: name, Description: description, Versions: versions}, nil
+	}
+
+	if hash, ok := root.providers[name]; ok && root.providersURL != "" {
+		ref := strings.NewReplacer("%package%", name, "%hash%", hash).Replace(root.providersURL)
+		var doc struct {
+			Packages map[string]map[string]map[string]json.RawMessage `json:"packages"`
+		}
+		if err := r.fetchJSON(ref, "provider-"+strings.ReplaceAll(name, "/", "$")+".json", &doc); err != nil {
+			return nil, err
+		}
+
+		var versions []map[string]json.RawMessage
+		for key, byVersion := range doc.Packages {
+			if strings.ToLower(key) != name {
+				continue
+			}
+			for _, v := range byVersion {
+				versions = append(versions, v)
+			}
+		}
+		return versionsInfo(name, filterDev(versions, dev))
+	}
+
+	return nil, fmt.Errorf("%w: %s", errNotFound, name)
+}
+
+// loadRoot reads packages.json once.
+func (r *composerRepository) loadRoot() (*repositoryRoot, error) {
+	r.once.Do(func() {
+		r.root, r.err = r.readRoot()
+	})
+	return r.root, r.err
+}
+
+func (r *composerRepository) readRoot() (*repositoryRoot, error) {
+	var doc packagesDocument
+	if err := r.fetchJSON("packages.json", "packages.json", &doc); err != nil {
+		// A repository that can't be read is an error, not a repository
+		// without the package.
+		return nil, fmt.Errorf("failed to read repository %s: %v", r.url, err)
+	}
+
+	root := &repositoryRoot{
+		metadataURL:       doc.MetadataURL,
+		providersURL:      doc.ProvidersURL,
+		availablePatterns: namePatterns(doc.AvailablePackagePatterns),
+		providers:         make(map[string]string),
+		packages:          make(map[string][]map[string]json.RawMessage),
+	}
+	if len(doc.AvailablePackages) > 0 {
+		root.available = make(map[string]bool, len(doc.AvailablePackages))
+		for _, name := range doc.AvailablePackages {
+			root.available[strings.ToLower(name)] = true
+		}
+	}
+
+	if err := r.addPackages(root, &doc, 0); err != nil {
+		return nil, err
+	}
+
+	for name, p := range doc.Providers {
+		root.providers[strings.ToLower(name)] = p.SHA256
+	}
+	for path, include := range doc.ProviderIncludes {
+		path = strings.ReplaceAll(path, "%hash%", include.SHA256)
+		var listing packagesDocument
+		if err := r.fetchJSON(path, strings.ReplaceAll(path, "/", "$"), &listing); err != nil {
+			return nil, fmt.Errorf("failed to read repository %s: %v", r.url, err)
+		}
+		for name, p := range listing.Providers {
+			root.providers[strings.ToLower(name)] = p.SHA256
+		}
+	}
+
+	return root, nil
+}
+
+// addPackages adds the packages listed in doc, and in the files it includes.
+func (r *composerRepository) addPackages(root *repositoryRoot, doc *packagesDocument, depth int) error {
+	// Packagist sends an empty list rather than an object.
+	if len(doc.Packages) > 0 && doc.Packages[0] == '{' {
+		var packages map[string]map[string]map[string]json.RawMessage
+		if err := json.Unmarshal(doc.Packages, &packages); err != nil {
+			return fmt.Errorf("failed to parse repository %s: %w", r.url, err)
+		}
+		for name, byVersion := range packages {
+			name = strings.ToLower(name)
+			for _, v := range byVersion {
+				root.packages[name] = append(root.packages[name], v)
+			}
+		}
+	}
+
+	if depth >= maxIncludeDepth {
+		return nil
+	}
+	for path := range doc.Includes {
+		var included packagesDocument
+		if err := r.fetchJSON(path, strings.ReplaceAll(path, "/", "$"), &included); err != nil {
+			return fmt.Errorf("failed to read repository %s: %v", r.url, err)
+		}
+		if err := r.addPackages(root, &included, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchJSON decodes the document at ref, relative to the repository URL,
+// into v. It is cached under the repository's directory as cacheName.
+func (r *composerRepository) fetchJSON(ref, cacheName string, v interface{}) error {
+	docURL := r.resolve(ref)
+	body, err := r.client.fetchDocument(docURL, repoCacheKey(r.url, cacheName), docURL)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", docURL, err)
+	}
+	return nil
+}
+
+// resolve turns a URL from packages.json into an absolute one. Paths starting
+// with "/" are relative to the host, others to the repository URL.
+func (r *composerRepository) resolve(ref string) string {
+	base, err := url.Parse(r.url + "/")
+	if err != nil {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// has reports whether the repository may have name, going by the available
+// packages it declares, if any.
+func (root *repositoryRoot) has(name string) bool {
+	if root.available == nil && len(root.availablePatterns) == 0 {
+		return true
+	}
+	return root.available[name] || matchesAny(root.availablePatterns, name)
+}
+
+// versionsInfo builds the metadata of name from raw version objects.
+func versionsInfo(name string, versions []map[string]json.RawMessage) (*PackageInfo, error) {
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNotFound, name)
+	}
+	versionMap, description := parseVersions(versions, name)
+	return &PackageInfo{Name: name, Description: description, Versions: versionMap}, nil
+}
+
+// filterDev keeps the dev branches of versions if dev, or else the tagged
+// releases, as Packagist serves them apart.
+func filterDev(versions []map[string]json.RawMessage, dev bool) []map[string]json.RawMessage {
+	var res []map[string]json.RawMessage
+	for _, v := range versions {
+		var version string
+		_ = json.Unmarshal(v["version"], &version)
+		if isDevVersion(version) == dev {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// isDevVersion reports whether version names a branch: "dev-main" or
+// "2.x-dev".
+func isDevVersion(version string) bool {
+	return strings.HasPrefix(version, "dev-") || strings.HasSuffix(version, "-dev")
+}
@@ -0,0 +1,144 @@
+package packagist
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// newInlineRepository returns a "package" repository, whose versions are
+// written out in composer.json: one version object, or a list of them.
+func newInlineRepository(raw json.RawMessage) (*packageList, error) {
+	var versions []map[string]json.RawMessage
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '{' {
+		var v map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("invalid package repository: %w", err)
+		}
+		versions = append(versions, v)
+	} else if err := json.Unmarshal(raw, &versions); err != nil {
+		return nil, fmt.Errorf("invalid package repository: %w", err)
+	}
+
+	packages := make(map[string][]map[string]json.RawMessage)
+	for _, v := range versions {
+		var name, version string
+		_ = json.Unmarshal(v["name"], &name)
+		_ = json.Unmarshal(v["version"], &version)
+		if name == "" || version == "" {
+			return nil, fmt.Errorf("invalid package repository: every package needs a name and a version")
+		}
+		name = strings.ToLower(name)
+		packages[name] = append(packages[name], v)
+	}
+
+	return &packageList{load: func() (map[string][]map[string]json.RawMessage, error) {
+		return packages, nil
+	}}, nil
+}
+
+// artifactRepository reads the zip archives in a local directory, such as
+// vendored releases of packages that aren't published anywhere. Each archive
+// is one version, described by the composer.json inside it, which must have
+// a version.
+type artifactRepository struct {
+	packageList
+	url string
+}
+
+func newArtifactRepository(dir string) *artifactRepository {
+	r := &artifactRepository{url: dir}
+	r.load = r.read
+	return r
+}
+
+func (r *artifactRepository) read() (map[string][]map[string]json.RawMessage, error) {
+	packages := make(map[string][]map[string]json.RawMessage)
+	err := filepath.WalkDir(r.url, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".zip") {
+			return nil
+		}
+
+		v, err := readArtifact(path)
+		if err != nil || v == nil {
+			// Archives that aren't packages are skipped, as Composer does.
+			return nil
+		}
+
+		var name string
+		_ = json.Unmarshal(v["name"], &name)
+		name = strings.ToLower(name)
+		packages[name] = append(packages[name], v)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact repository %s: %w", r.url, err)
+	}
+	return packages, nil
+}
+
+// readArtifact returns the version object of the archive at path: its
+// composer.json, at the top or in a top-level directory, with the archive as
+// the dist. It is nil if there's no composer.json with a name and version.
+func readArtifact(path string) (map[string]json.RawMessage, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var manifest *zip.File
+	for _, f := range archive.File {
+		depth := strings.Count(strings.TrimPrefix(f.Name, "/"), "/")
+		if filepath.Base(f.Name) != "composer.json" || depth > 1 {
+			continue
+		}
+		if manifest == nil || depth == 0 {
+			manifest = f
+		}
+	}
+	if manifest == nil {
+		return nil, nil
+	}
+
+	rc, err := manifest.Open()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var v map[string]json.RawMessage
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	var name, version string
+	_ = json.Unmarshal(v["name"], &name)
+	_ = json.Unmarshal(v["version"], &version)
+	if name == "" || version == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(contents)
+	v["dist"], _ = json.Marshal(DistInfo{Type: "zip", URL: filepath.ToSlash(path), Shasum: hex.EncodeToString(sum[:])})
+	return v, nil
+}
@@ -0,0 +1,92 @@
+package packagist
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aras/presto/internal/vcs"
+)
+
+// pathRepository reads packages from local directories, typically the other
+// packages of a monorepo. Its url is a path, relative to the project, that
+// may hold "*" wildcards; each matching directory with a composer.json is a
+// package.
+type pathRepository struct {
+	packageList
+	url     string
+	options map[string]interface{}
+}
+
+func newPathRepository(repoURL string, options map[string]interface{}) *pathRepository {
+	r := &pathRepository{url: repoURL, options: options}
+	r.load = r.read
+	return r
+}
+
+// read builds a version object for every directory the url matches. Its
+// dist points at the directory, so the downloader links or copies it.
+func (r *pathRepository) read() (map[string][]map[string]json.RawMessage, error) {
+	dirs, err := filepath.Glob(r.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path repository %s: %w", r.url, err)
+	}
+
+	packages := make(map[string][]map[string]json.RawMessage)
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, "composer.json"))
+		if err != nil {
+			continue
+		}
+
+		var v map[string]json.RawMessage
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, "composer.json"), err)
+		}
+		var name string
+		if err := json.Unmarshal(v["name"], &name); err != nil || name == "" {
+			continue
+		}
+
+		version, reference := pathVersion(dir, v)
+		if reference == "" {
+			sum := sha1.Sum(data)
+			reference = hex.EncodeToString(sum[:])
+		}
+
+		v["version"], _ = json.Marshal(version)
+		delete(v, "version_normalized")
+		v["dist"], _ = json.Marshal(DistInfo{Type: "path", URL: filepath.ToSlash(dir), Reference: reference})
+		if len(r.options) > 0 {
+			v["transport-options"], _ = json.Marshal(r.options)
+		}
+
+		name = strings.ToLower(name)
+		packages[name] = append(packages[name], v)
+	}
+	return packages, nil
+}
+
+// pathVersion returns the version of the package in dir: the "version" of
+// its composer.json, or else the tag or branch checked out there, or else
+// dev-main. The reference is the checked out commit, if any.
+func pathVersion(dir string, v map[string]json.RawMessage) (version, reference string) {
+	head, headErr := vcs.Head(dir)
+	if headErr == nil {
+		reference = head.Commit
+	}
+
+	if err := json.Unmarshal(v["version"], &version); err == nil && version != "" {
+		return version, reference
+	}
+	if headErr == nil {
+		if version := refVersion(head); version != "" {
+			return version, reference
+		}
+	}
+	return "dev-main", reference
+}
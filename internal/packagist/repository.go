@@ -0,0 +1,205 @@
+package packagist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+// repository is a source of package metadata: Packagist, or one of the
+// project's "repositories".
+type repository interface {
+	// packageInfo returns name's tagged releases, or its dev branches if dev.
+	// A repository without them returns an error wrapping errNotFound.
+	packageInfo(name string, dev bool) (*PackageInfo, error)
+}
+
+// packageList is a repository whose packages are all read at once, on first
+// use, by load: a git repository's refs, local directories or archives, or
+// inline definitions.
+type packageList struct {
+	load func() (map[string][]map[string]json.RawMessage, error)
+
+	once     sync.Once
+	packages map[string][]map[string]json.RawMessage
+	err      error
+}
+
+func (l *packageList) packageInfo(name string, dev bool) (*PackageInfo, error) {
+	l.once.Do(func() {
+		l.packages, l.err = l.load()
+	})
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	versions, ok := l.packages[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errNotFound, name)
+	}
+	return versionsInfo(name, filterDev(versions, dev))
+}
+
+// configuredRepository is a repository with the options that decide which
+// packages are looked up in it.
+type configuredRepository struct {
+	repository
+	canonical bool
+	only      []*regexp.Regexp
+	exclude   []*regexp.Regexp
+}
+
+// serves reports whether name may be looked up in the repository, according
+// to its only and exclude options.
+func (r *configuredRepository) serves(name string) bool {
+	if len(r.only) > 0 && !matchesAny(r.only, name) {
+		return false
+	}
+	return !matchesAny(r.exclude, name)
+}
+
+// packagist returns the default repository, Packagist at c.baseURL.
+func (c *Client) packagist() *configuredRepository {
+	return &configuredRepository{repository: newPackagistRepository(c, c.baseURL), canonical: true}
+}
+
+// SetRepositories makes the client look packages up in repos, in order, and
+// then on Packagist unless a {"packagist.org": false} entry disables it.
+func (c *Client) SetRepositories(repos []parser.Repository) error {
+	var configured []*configuredRepository
+	usePackagist := true
+
+	for _, r := range repos {
+		if r.Disabled {
+			if r.Name == "packagist.org" || r.Name == "packagist" {
+				usePackagist = false
+			}
+			continue
+		}
+
+		var repo repository
+		switch r.Type {
+		case "composer":
+			if r.URL == "" {
+				return fmt.Errorf("composer repository %s has no url", r.Name)
+			}
+			repo = newComposerRepository(c, r.URL)
+		case "vcs", "git":
+			if r.URL == "" {
+				return fmt.Errorf("%s repository %s has no url", r.Type, r.Name)
+			}
+			repo = newVCSRepository(c, r.URL)
+		case "path":
+			if r.URL == "" {
+				return fmt.Errorf("path repository %s has no url", r.Name)
+			}
+			repo = newPathRepository(r.URL, r.Options)
+		case "package":
+			inline, err := newInlineRepository(r.Package)
+			if err != nil {
+				return err
+			}
+			repo = inline
+		case "artifact":
+			if r.URL == "" {
+				return fmt.Errorf("artifact repository %s has no url", r.Name)
+			}
+			repo = newArtifactRepository(r.URL)
+		default:
+			return fmt.Errorf("unsupported repository type %q", r.Type)
+		}
+
+		configured = append(configured, &configuredRepository{
+			repository: repo,
+			canonical:  r.IsCanonical(),
+			only:       namePatterns(r.Only),
+			exclude:    namePatterns(r.Exclude),
+		})
+	}
+
+	if usePackagist {
+		configured = append(configured, c.packagist())
+	}
+	c.repos = configured
+	return nil
+}
+
+// collect merges name's versions from every repository that serves it, in
+// priority order. Once a canonical repository has the package, later
+// repositories aren't asked for it, and a version found in an earlier
+// repository wins over the same version in a later one.
+func (c *Client) collect(name string, dev bool) (*PackageInfo, error) {
+	var merged *PackageInfo
+	var notFound error
+
+	for _, repo := range c.repos {
+		if !repo.serves(name) {
+			continue
+		}
+
+		info, err := repo.packageInfo(name, dev)
+		switch {
+		case errors.Is(err, errNotFound):
+			if notFound == nil {
+				notFound = err
+			}
+		case err != nil:
+			return nil, err
+		case merged == nil:
+			merged = info
+		default:
+			for version, v := range info.Versions {
+				if _, ok := merged.Versions[version]; !ok {
+					merged.Versions[version] = v
+				}
+			}
+			if merged.Description == "" {
+				merged.Description = info.Description
+			}
+		}
+
+		if repo.canonical && (err == nil || dev && hasPackage(repo, name)) {
+			break
+		}
+	}
+
+	if merged == nil {
+		if notFound == nil {
+			notFound = fmt.Errorf("%w: %s", errNotFound, name)
+		}
+		return nil, notFound
+	}
+	return merged, nil
+}
+
+// hasPackage reports whether repo has tagged releases of name, so that a
+// canonical repository hides the dev branches of its packages in later
+// repositories too.
+func hasPackage(repo repository, name string) bool {
+	_, err := repo.packageInfo(name, false)
+	return err == nil
+}
+
+// namePatterns compiles package name patterns, where "*" matches anything.
+func namePatterns(patterns []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		quoted := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(p)), `\*`, ".*")
+		res = append(res, regexp.MustCompile("^"+quoted+"$"))
+	}
+	return res
+}
+
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
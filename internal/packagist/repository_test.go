@@ -0,0 +1,526 @@
+package packagist
+
+import (
+	"archive/zip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/vcs"
+)
+
+// staticServer serves fixed documents by path, with "$URL" replaced by the
+// server's URL, and records the paths requested.
+type staticServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	requested []string
+}
+
+func newStaticServer(t *testing.T, files map[string]string) *staticServer {
+	t.Helper()
+
+	s := &staticServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requested = append(s.requested, r.URL.Path)
+		s.mu.Unlock()
+
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(strings.ReplaceAll(body, "$URL", s.URL)))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *staticServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requested...)
+}
+
+// newRepositoryClient returns a client for repos, in the order given, followed
+// by the Packagist stand-in at packagistURL.
+func newRepositoryClient(t *testing.T, packagistURL string, repos string) *Client {
+	t.Helper()
+
+	client := newTestClient(packagistURL, t.TempDir())
+	composer := &parser.ComposerJSON{Repositories: []byte(repos)}
+	list, err := composer.RepositoryList()
+	if err != nil {
+		t.Fatalf("RepositoryList() returned error: %v", err)
+	}
+	if err := client.SetRepositories(list); err != nil {
+		t.Fatalf("SetRepositories() returned error: %v", err)
+	}
+	return client
+}
+
+func versionList(info *PackageInfo) []string {
+	var versions []string
+	for v := range info.Versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+func TestClient_ComposerRepository_Includes(t *testing.T) {
+	packagist := newMetadataServer(t, 0)
+	satis := newStaticServer(t, map[string]string{
+		"/packages.json": `{"packages": [], "includes": {"include/all$1234.json": {"sha1": "1234"}}}`,
+		"/include/all$1234.json": `{"packages": {
+			"acme/private": {
+				"1.0.0": {"name": "acme/private", "version": "1.0.0", "description": "Private", "dist": {"type": "zip", "url": "$URL/dist/private.zip"}},
+				"dev-main": {"name": "acme/private", "version": "dev-main"}
+			},
+			"a/a": {"2.0.0": {"name": "a/a", "version": "2.0.0"}}
+		}}`,
+	})
+
+	tests := []struct {
+		name  string
+		repos string
+		want  []string
+	}{
+		{
+			name:  "Canonical repository hides Packagist",
+			repos: `[{"type": "composer", "url": "` + satis.URL + `"}]`,
+			want:  []string{"2.0.0"},
+		},
+		{
+			name:  "Non-canonical repository is merged with Packagist",
+			repos: `[{"type": "composer", "url": "` + satis.URL + `", "canonical": false}]`,
+			want:  []string{"1.0.0", "2.0.0"},
+		},
+		{
+			name:  "Excluded package comes from Packagist",
+			repos: `[{"type": "composer", "url": "` + satis.URL + `", "exclude": ["a/*"]}]`,
+			want:  []string{"1.0.0"},
+		},
+		{
+			name:  "Only lists the packages the repository is used for",
+			repos: `{"satis": {"type": "composer", "url": "` + satis.URL + `", "only": ["acme/*"]}}`,
+			want:  []string{"1.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newRepositoryClient(t, packagist.URL, tt.repos)
+
+			info, err := client.GetPackage("a/a")
+			if err != nil {
+				t.Fatalf("GetPackage(a/a) returned error: %v", err)
+			}
+			if got := versionList(info); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetPackage(a/a) versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	before := len(satis.requests())
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "composer", "url": "`+satis.URL+`"}]`)
+	info, err := client.GetPackage("Acme/Private")
+	if err != nil {
+		t.Fatalf("GetPackage(acme/private) returned error: %v", err)
+	}
+	if got := versionList(info); !reflect.DeepEqual(got, []string{"1.0.0"}) {
+		t.Errorf("GetPackage(acme/private) versions = %v, want [1.0.0]", got)
+	}
+	if url := info.Versions["1.0.0"].Dist.URL; url != satis.URL+"/dist/private.zip" {
+		t.Errorf("dist url = %s, want %s/dist/private.zip", url, satis.URL)
+	}
+
+	dev, err := client.GetDevPackage("acme/private")
+	if err != nil {
+		t.Fatalf("GetDevPackage(acme/private) returned error: %v", err)
+	}
+	if got := versionList(dev); !reflect.DeepEqual(got, []string{"dev-main"}) {
+		t.Errorf("GetDevPackage(acme/private) versions = %v, want [dev-main]", got)
+	}
+	if got := packagist.count("/p2/acme/private~dev.json"); got != 0 {
+		t.Errorf("Packagist asked for acme/private~dev %d times, want 0", got)
+	}
+
+	if got := satis.requests()[before:]; len(got) != 2 {
+		t.Errorf("repository requests = %v, want packages.json and its include once", got)
+	}
+}
+
+func TestClient_ComposerRepository_MetadataURL(t *testing.T) {
+	packagist := newMetadataServer(t, 0)
+	satis := newStaticServer(t, map[string]string{
+		"/packages.json":            `{"packages": [], "metadata-url": "/p2/%package%.json", "available-packages": ["acme/private"]}`,
+		"/p2/acme/private.json":     `{"packages": {"acme/private": [{"name": "acme/private", "version": "1.0.0"}, {"version": "1.1.0"}]}, "minified": "composer/2.0"}`,
+		"/p2/acme/private~dev.json": `{"packages": {"acme/private": [{"name": "acme/private", "version": "dev-main"}]}}`,
+	})
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "composer", "url": "`+satis.URL+`/"}]`)
+
+	info, err := client.GetPackage("acme/private")
+	if err != nil {
+		t.Fatalf("GetPackage(acme/private) returned error: %v", err)
+	}
+	if got := versionList(info); !reflect.DeepEqual(got, []string{"1.0.0", "1.1.0"}) {
+		t.Errorf("GetPackage(acme/private) versions = %v, want [1.0.0 1.1.0]", got)
+	}
+
+	if _, err := client.GetPackage("a/a"); err != nil {
+		t.Fatalf("GetPackage(a/a) returned error: %v", err)
+	}
+
+	want := []string{"/packages.json", "/p2/acme/private.json"}
+	if got := satis.requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("repository requests = %v, want %v: a/a isn't available there", got, want)
+	}
+}
+
+func TestClient_ComposerRepository_Providers(t *testing.T) {
+	packagist := newMetadataServer(t, 0)
+	satis := newStaticServer(t, map[string]string{
+		"/packages.json": `{"packages": [], "providers-url": "/p/%package%$%hash%.json",
+			"provider-includes": {"p/provider-latest$%hash%.json": {"sha256": "aaa"}}}`,
+		"/p/provider-latest$aaa.json": `{"providers": {"acme/legacy": {"sha256": "bbb"}}}`,
+		"/p/acme/legacy$bbb.json": `{"packages": {"acme/legacy": {
+			"1.0.0": {"name": "acme/legacy", "version": "1.0.0"},
+			"1.x-dev": {"name": "acme/legacy", "version": "1.x-dev"}
+		}}}`,
+	})
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "composer", "url": "`+satis.URL+`"}]`)
+
+	info, err := client.GetPackage("acme/legacy")
+	if err != nil {
+		t.Fatalf("GetPackage(acme/legacy) returned error: %v", err)
+	}
+	if got := versionList(info); !reflect.DeepEqual(got, []string{"1.0.0"}) {
+		t.Errorf("GetPackage(acme/legacy) versions = %v, want [1.0.0]", got)
+	}
+
+	dev, err := client.GetDevPackage("acme/legacy")
+	if err != nil {
+		t.Fatalf("GetDevPackage(acme/legacy) returned error: %v", err)
+	}
+	if got := versionList(dev); !reflect.DeepEqual(got, []string{"1.x-dev"}) {
+		t.Errorf("GetDevPackage(acme/legacy) versions = %v, want [1.x-dev]", got)
+	}
+}
+
+func TestClient_PackagistDisabled(t *testing.T) {
+	packagist := newMetadataServer(t, 0)
+	satis := newStaticServer(t, map[string]string{
+		"/packages.json": `{"packages": {"acme/private": {"1.0.0": {"name": "acme/private", "version": "1.0.0"}}}}`,
+	})
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "composer", "url": "`+satis.URL+`"}, {"packagist.org": false}]`)
+
+	if _, err := client.GetPackage("acme/private"); err != nil {
+		t.Fatalf("GetPackage(acme/private) returned error: %v", err)
+	}
+	if _, err := client.GetPackage("a/a"); err == nil {
+		t.Error("GetPackage(a/a) expected an error with Packagist disabled")
+	}
+	if got := packagist.count("/p2/a/a.json"); got != 0 {
+		t.Errorf("Packagist asked for a/a %d times, want 0", got)
+	}
+}
+
+func TestClient_ComposerRepository_Unreachable(t *testing.T) {
+	packagist := newMetadataServer(t, 0)
+	satis := newStaticServer(t, nil)
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "composer", "url": "`+satis.URL+`"}]`)
+
+	if _, err := client.GetPackage("a/a"); err == nil || !strings.Contains(err.Error(), "failed to read repository") {
+		t.Errorf("GetPackage(a/a) = %v, want an error about the repository", err)
+	}
+}
+
+// gitRun runs git in dir with a fixed identity.
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+// commitComposerJSON commits composer.json with the given contents in work.
+func commitComposerJSON(t *testing.T, work, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(work, "composer.json"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, work, "add", "composer.json")
+	gitRun(t, work, "commit", "--quiet", "-m", contents)
+}
+
+func TestClient_VCSRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	work := t.TempDir()
+	gitRun(t, work, "init", "--quiet", "--initial-branch=main")
+	commitComposerJSON(t, work, `{"name": "Acme/Lib", "require": {"php": ">=7.4"}}`)
+	gitRun(t, work, "tag", "-a", "v1.0.0", "-m", "v1.0.0")
+	commitComposerJSON(t, work, `{"name": "acme/lib", "version": "9.9.9", "require": {"php": ">=8.1"},
+		"dist": {"type": "zip", "url": "https://evil.example/lib.zip"}, "transport-options": {"symlink": true}}`)
+	gitRun(t, work, "tag", "1.1.0")
+	gitRun(t, work, "tag", "nightly")
+	gitRun(t, work, "branch", "1.x")
+	gitRun(t, work, "checkout", "--quiet", "-b", "feature/api")
+	commitComposerJSON(t, work, `{"name": "acme/lib", "require": {"php": ">=8.2"}}`)
+	gitRun(t, work, "checkout", "--quiet", "--orphan", "docs")
+	gitRun(t, work, "rm", "--quiet", "-rf", ".")
+	commitComposerJSON(t, work, `{"name": "acme/docs"}`)
+
+	bare := filepath.Join(t.TempDir(), "lib.git")
+	gitRun(t, work, "clone", "--quiet", "--bare", work, bare)
+
+	packagist := newMetadataServer(t, 0)
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "vcs", "url": "`+bare+`"}]`)
+
+	info, err := client.GetPackage("acme/lib")
+	if err != nil {
+		t.Fatalf("GetPackage(acme/lib) returned error: %v", err)
+	}
+	if got := versionList(info); !reflect.DeepEqual(got, []string{"1.1.0", "v1.0.0"}) {
+		t.Errorf("GetPackage(acme/lib) versions = %v, want [1.1.0 v1.0.0]", got)
+	}
+	release := info.Versions["1.1.0"]
+	if release.Require["php"] != ">=8.1" {
+		t.Errorf("1.1.0 requires php %q, want the composer.json of its tag", release.Require["php"])
+	}
+	if release.Source.Type != "git" || release.Source.URL != bare || len(release.Source.Reference) != 40 {
+		t.Errorf("1.1.0 source = %+v, want the commit in %s", release.Source, bare)
+	}
+	if release.Dist.URL != "" || release.TransportOptions != nil {
+		t.Errorf("1.1.0 dist = %+v, transport-options = %v, want none from its composer.json", release.Dist, release.TransportOptions)
+	}
+	if !release.InstallsFromSource() {
+		t.Error("1.1.0 should be installed from its repository")
+	}
+
+	dev, err := client.GetDevPackage("acme/lib")
+	if err != nil {
+		t.Fatalf("GetDevPackage(acme/lib) returned error: %v", err)
+	}
+	if got := versionList(dev); !reflect.DeepEqual(got, []string{"1.x-dev", "dev-feature/api", "dev-main"}) {
+		t.Errorf("GetDevPackage(acme/lib) versions = %v, want [1.x-dev dev-feature/api dev-main]", got)
+	}
+
+	docs, err := client.GetDevPackage("acme/docs")
+	if err != nil {
+		t.Fatalf("GetDevPackage(acme/docs) returned error: %v", err)
+	}
+	if got := versionList(docs); !reflect.DeepEqual(got, []string{"dev-docs"}) {
+		t.Errorf("GetDevPackage(acme/docs) versions = %v, want [dev-docs]", got)
+	}
+
+	if _, err := client.GetPackage("a/a"); err != nil {
+		t.Errorf("GetPackage(a/a) returned error: %v, want it from Packagist", err)
+	}
+}
+
+func TestClient_PathRepository(t *testing.T) {
+	root := t.TempDir()
+	for dir, manifest := range map[string]string{
+		"packages/tagged": `{"name": "acme/tagged", "version": "1.2.0"}`,
+		"packages/branch": `{"name": "acme/branch"}`,
+		"packages/empty":  ``,
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if manifest != "" {
+			if err := os.WriteFile(filepath.Join(root, dir, "composer.json"), []byte(manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	packagist := newMetadataServer(t, 0)
+	glob := filepath.ToSlash(filepath.Join(root, "packages", "*"))
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "path", "url": "`+glob+`", "options": {"symlink": false}}]`)
+
+	info, err := client.GetPackage("acme/tagged")
+	if err != nil {
+		t.Fatalf("GetPackage(acme/tagged) returned error: %v", err)
+	}
+	tagged := info.Versions["1.2.0"]
+	if tagged == nil {
+		t.Fatalf("GetPackage(acme/tagged) versions = %v, want [1.2.0]", versionList(info))
+	}
+	if want := filepath.ToSlash(filepath.Join(root, "packages", "tagged")); tagged.Dist.Type != "path" || tagged.Dist.URL != want {
+		t.Errorf("dist = %+v, want a path dist for %s", tagged.Dist, want)
+	}
+	if tagged.Dist.Reference == "" {
+		t.Error("dist has no reference")
+	}
+	if symlink, ok := tagged.TransportOptions["symlink"].(bool); !ok || symlink {
+		t.Errorf("transport-options = %v, want symlink false", tagged.TransportOptions)
+	}
+
+	if _, err := exec.LookPath("git"); err == nil {
+		gitRun(t, root, "init", "--quiet", "--initial-branch=2.x")
+		gitRun(t, root, "add", ".")
+		gitRun(t, root, "commit", "--quiet", "-m", "Packages")
+	}
+	client = newRepositoryClient(t, packagist.URL, `[{"type": "path", "url": "`+glob+`"}]`)
+
+	dev, err := client.GetDevPackage("acme/branch")
+	if err != nil {
+		t.Fatalf("GetDevPackage(acme/branch) returned error: %v", err)
+	}
+	want := []string{"2.x-dev"}
+	if _, err := exec.LookPath("git"); err != nil {
+		want = []string{"dev-main"}
+	}
+	if got := versionList(dev); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetDevPackage(acme/branch) versions = %v, want %v", got, want)
+	}
+}
+
+func TestClient_PackageRepository(t *testing.T) {
+	packagist := newMetadataServer(t, 0)
+	client := newRepositoryClient(t, packagist.URL, `[
+		{"type": "package", "package": {"name": "legacy/one", "version": "1.0.0", "dist": {"type": "zip", "url": "https://example.com/one.zip"}}},
+		{"type": "package", "package": [
+			{"name": "legacy/two", "version": "2.0.0", "require": {"legacy/one": "^1.0"}},
+			{"name": "legacy/two", "version": "dev-main", "source": {"type": "git", "url": "https://example.com/two.git", "reference": "main"}}
+		]}
+	]`)
+
+	one, err := client.GetPackage("legacy/one")
+	if err != nil {
+		t.Fatalf("GetPackage(legacy/one) returned error: %v", err)
+	}
+	if url := one.Versions["1.0.0"].Dist.URL; url != "https://example.com/one.zip" {
+		t.Errorf("legacy/one dist url = %q, want https://example.com/one.zip", url)
+	}
+
+	two, err := client.GetPackage("legacy/two")
+	if err != nil {
+		t.Fatalf("GetPackage(legacy/two) returned error: %v", err)
+	}
+	if got := versionList(two); !reflect.DeepEqual(got, []string{"2.0.0"}) {
+		t.Errorf("GetPackage(legacy/two) versions = %v, want [2.0.0]", got)
+	}
+	if got := two.Versions["2.0.0"].Require["legacy/one"]; got != "^1.0" {
+		t.Errorf("legacy/two requires legacy/one %q, want ^1.0", got)
+	}
+	dev, err := client.GetDevPackage("legacy/two")
+	if err != nil || !reflect.DeepEqual(versionList(dev), []string{"dev-main"}) {
+		t.Errorf("GetDevPackage(legacy/two) = %v, %v, want dev-main", dev, err)
+	}
+
+	composer := &parser.ComposerJSON{Repositories: []byte(`[{"type": "package", "package": {"name": "legacy/one"}}]`)}
+	list, err := composer.RepositoryList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRepositories(list); err == nil {
+		t.Error("SetRepositories() expected an error for a package without a version")
+	}
+}
+
+// writeZip creates a zip archive at path holding files.
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, contents := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(contents))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_ArtifactRepository(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "lib-1.0.0.zip"), map[string]string{
+		"composer.json": `{"name": "acme/lib", "version": "1.0.0"}`,
+		"src/Lib.php":   "<?php",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeZip(t, filepath.Join(dir, "old", "lib-0.9.0.zip"), map[string]string{
+		"lib-0.9.0/composer.json": `{"name": "acme/lib", "version": "0.9.0"}`,
+	})
+	writeZip(t, filepath.Join(dir, "unversioned.zip"), map[string]string{
+		"composer.json": `{"name": "acme/lib"}`,
+	})
+	writeZip(t, filepath.Join(dir, "nested.zip"), map[string]string{
+		"a/b/composer.json": `{"name": "acme/lib", "version": "3.0.0"}`,
+	})
+
+	packagist := newMetadataServer(t, 0)
+	client := newRepositoryClient(t, packagist.URL, `[{"type": "artifact", "url": "`+filepath.ToSlash(dir)+`"}]`)
+
+	info, err := client.GetPackage("acme/lib")
+	if err != nil {
+		t.Fatalf("GetPackage(acme/lib) returned error: %v", err)
+	}
+	if got := versionList(info); !reflect.DeepEqual(got, []string{"0.9.0", "1.0.0"}) {
+		t.Errorf("GetPackage(acme/lib) versions = %v, want [0.9.0 1.0.0]", got)
+	}
+
+	dist := info.Versions["1.0.0"].Dist
+	if want := filepath.ToSlash(filepath.Join(dir, "lib-1.0.0.zip")); dist.Type != "zip" || dist.URL != want {
+		t.Errorf("dist = %+v, want the zip at %s", dist, want)
+	}
+	if len(dist.Shasum) != 40 {
+		t.Errorf("dist shasum = %q, want the archive's sha1", dist.Shasum)
+	}
+}
+
+func TestRefVersion(t *testing.T) {
+	tests := []struct {
+		ref  vcs.Ref
+		want string
+	}{
+		{vcs.Ref{Name: "v1.2.3", Tag: true}, "v1.2.3"},
+		{vcs.Ref{Name: "2.0.0-RC1", Tag: true}, "2.0.0-RC1"},
+		{vcs.Ref{Name: "release-2020", Tag: true}, ""},
+		{vcs.Ref{Name: "main"}, "dev-main"},
+		{vcs.Ref{Name: "1.x"}, "1.x-dev"},
+		{vcs.Ref{Name: "v2"}, "2.x-dev"},
+		{vcs.Ref{Name: "2.0"}, "2.0.x-dev"},
+	}
+	for _, tt := range tests {
+		if got := refVersion(tt.ref); got != tt.want {
+			t.Errorf("refVersion(%+v) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package packagist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aras/presto/internal/cache"
+	"github.com/aras/presto/internal/vcs"
+)
+
+var (
+	// tagVersion matches tags that name a release: "v1.2.0", "2.0.0-RC1".
+	tagVersion = regexp.MustCompile(`(?i)^v?\d+(\.\d+){0,3}([.-]?(alpha|beta|rc|a|b|p|pl|patch)([.-]?\d+)?)?$`)
+	// numericBranch matches branches named after a version line: "1.x", "2.0".
+	numericBranch = regexp.MustCompile(`(?i)^v?\d+(\.(\d+|x|\*))*$`)
+)
+
+// vcsRepository reads a git repository without a Composer registry. Its
+// branches and tags are the package's versions, each described by the
+// composer.json committed there.
+type vcsRepository struct {
+	packageList
+	client *Client
+	url    string
+}
+
+func newVCSRepository(c *Client, repoURL string) *vcsRepository {
+	r := &vcsRepository{client: c, url: repoURL}
+	r.load = r.read
+	return r
+}
+
+// read builds a version object for every branch and tag whose composer.json
+// names the package.
+func (r *vcsRepository) read() (map[string][]map[string]json.RawMessage, error) {
+	repo, err := vcs.Mirror(r.client.disk, r.url, r.client.offline)
+	if errors.Is(err, cache.ErrOffline) {
+		r.client.mu.Lock()
+		r.client.missing[r.url] = true
+		r.client.mu.Unlock()
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository %s: %v", r.url, err)
+	}
+
+	refs, err := repo.Refs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository %s: %v", r.url, err)
+	}
+	commits := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		commits = append(commits, ref.Commit)
+	}
+	manifests, err := repo.ReadFiles(commits, "composer.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository %s: %v", r.url, err)
+	}
+
+	packages := make(map[string][]map[string]json.RawMessage)
+	for _, ref := range refs {
+		version := refVersion(ref)
+		if version == "" {
+			continue
+		}
+
+		var v map[string]json.RawMessage
+		if err := json.Unmarshal(manifests[ref.Commit], &v); err != nil {
+			continue
+		}
+		var name string
+		if err := json.Unmarshal(v["name"], &name); err != nil || name == "" {
+			continue
+		}
+
+		v["version"], _ = json.Marshal(version)
+		delete(v, "version_normalized")
+		// Like Composer, the package installs from the commit, whatever
+		// dist its composer.json names.
+		delete(v, "dist")
+		delete(v, "transport-options")
+		v["source"], _ = json.Marshal(SourceInfo{Type: "git", URL: r.url, Reference: ref.Commit})
+		if !ref.Time.IsZero() {
+			v["time"], _ = json.Marshal(ref.Time.UTC().Format(time.RFC3339))
+		}
+
+		name = strings.ToLower(name)
+		packages[name] = append(packages[name], v)
+	}
+	return packages, nil
+}
+
+// refVersion returns the version a branch or tag stands for, the way
+// Composer names them: tags by themselves, "1.x" and "2.0" branches as
+// "1.x-dev" and "2.0.x-dev", and any other branch as "dev-<name>". Tags
+// that aren't versions are skipped.
+func refVersion(ref vcs.Ref) string {
+	if ref.Tag {
+		if tagVersion.MatchString(ref.Name) {
+			return ref.Name
+		}
+		return ""
+	}
+
+	if numericBranch.MatchString(ref.Name) {
+		version := strings.TrimLeft(ref.Name, "vV")
+		for {
+			trimmed, ok := strings.CutSuffix(version, ".x")
+			if !ok {
+				trimmed, ok = strings.CutSuffix(version, ".*")
+			}
+			if !ok {
+				break
+			}
+			version = trimmed
+		}
+		return version + ".x-dev"
+	}
+	return "dev-" + ref.Name
+}
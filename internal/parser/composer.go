@@ -16,11 +16,14 @@ type ComposerJSON struct {
 	Authors          []Author               `json:"authors,omitempty"`
 	Require          map[string]string      `json:"require,omitempty"`
 	RequireDev       map[string]string      `json:"require-dev,omitempty"`
+	Conflict         map[string]string      `json:"conflict,omitempty"`
+	Replace          map[string]string      `json:"replace,omitempty"`
+	Provide          map[string]string      `json:"provide,omitempty"`
 	Autoload         AutoloadConfig         `json:"autoload,omitempty"`
 	AutoloadDev      AutoloadConfig         `json:"autoload-dev,omitempty"`
 	Scripts          map[string]interface{} `json:"scripts,omitempty"`
 	Config           map[string]interface{} `json:"config,omitempty"`
-	Repositories     interface{}            `json:"repositories,omitempty"`
+	Repositories     json.RawMessage        `json:"repositories,omitempty"`
 	Extra            map[string]interface{} `json:"extra,omitempty"`
 	MinimumStability string                 `json:"minimum-stability,omitempty"`
 	PreferStable     bool                   `json:"prefer-stable,omitempty"`
@@ -49,7 +52,7 @@ type ComposerLock struct {
 	ContentHash       string            `json:"content-hash"`
 	Packages          []LockedPackage   `json:"packages"`
 	PackagesDev       []LockedPackage   `json:"packages-dev"`
-	Aliases           []interface{}     `json:"aliases"`
+	Aliases           []Alias           `json:"aliases"`
 	MinimumStability  string            `json:"minimum-stability"`
 	StabilityFlags    map[string]int    `json:"stability-flags"`
 	PreferStable      bool              `json:"prefer-stable"`
@@ -59,22 +62,52 @@ type ComposerLock struct {
 	PlatformOverrides map[string]string `json:"platform-overrides,omitempty"`
 }
 
+// Alias is an inline alias from the root requirements ("dev-main as 1.x-dev")
+// as recorded in composer.lock
+type Alias struct {
+	Package         string `json:"package"`
+	Version         string `json:"version"`
+	Alias           string `json:"alias"`
+	AliasNormalized string `json:"alias_normalized"`
+}
+
 // LockedPackage represents a package in composer.lock
 type LockedPackage struct {
-	Name            string            `json:"name"`
-	Version         string            `json:"version"`
-	Source          SourceInfo        `json:"source,omitempty"`
-	Dist            DistInfo          `json:"dist,omitempty"`
-	Require         map[string]string `json:"require,omitempty"`
-	RequireDev      map[string]string `json:"require-dev,omitempty"`
-	Type            string            `json:"type,omitempty"`
-	Autoload        AutoloadConfig    `json:"autoload,omitempty"`
-	NotificationURL string            `json:"notification-url,omitempty"`
-	License         []string          `json:"license,omitempty"`
-	Authors         []Author          `json:"authors,omitempty"`
-	Description     string            `json:"description,omitempty"`
-	Keywords        []string          `json:"keywords,omitempty"`
-	Time            string            `json:"time,omitempty"`
+	Name            string                 `json:"name"`
+	Version         string                 `json:"version"`
+	Source          SourceInfo             `json:"source,omitempty"`
+	Dist            DistInfo               `json:"dist,omitempty"`
+	Require         map[string]string      `json:"require,omitempty"`
+	Conflict        map[string]string      `json:"conflict,omitempty"`
+	Provide         map[string]string      `json:"provide,omitempty"`
+	Replace         map[string]string      `json:"replace,omitempty"`
+	RequireDev      map[string]string      `json:"require-dev,omitempty"`
+	Type            string                 `json:"type,omitempty"`
+	Extra           map[string]interface{} `json:"extra,omitempty"`
+	Autoload        AutoloadConfig         `json:"autoload,omitempty"`
+	NotificationURL string                 `json:"notification-url,omitempty"`
+	License         []string               `json:"license,omitempty"`
+	Authors         []Author               `json:"authors,omitempty"`
+	Description     string                 `json:"description,omitempty"`
+	Keywords        []string               `json:"keywords,omitempty"`
+	Time            string                 `json:"time,omitempty"`
+	// TransportOptions are the options of the repository the package came
+	// from that matter when installing it, such as "symlink" for path
+	// repositories.
+	TransportOptions map[string]interface{} `json:"transport-options,omitempty"`
+}
+
+// MarshalJSON leaves dist out of a package that has none, such as one
+// installed from its git repository, the way Composer does.
+func (p LockedPackage) MarshalJSON() ([]byte, error) {
+	type plain LockedPackage
+	if p.Dist != (DistInfo{}) {
+		return json.Marshal(plain(p))
+	}
+	return json.Marshal(struct {
+		plain
+		Dist *DistInfo `json:"dist,omitempty"`
+	}{plain: plain(p)})
 }
 
 // SourceInfo represents source repository information
@@ -90,6 +123,7 @@ type DistInfo struct {
 	URL       string `json:"url"`
 	Reference string `json:"reference,omitempty"`
 	Shasum    string `json:"shasum,omitempty"`
+	Integrity string `json:"integrity,omitempty"` // SHA-256 of the archive, "sha256-<base64>"
 }
 
 // ParseComposerJSON reads and parses composer.json
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Repository is one entry of the "repositories" list in composer.json.
+type Repository struct {
+	Name      string                 `json:"-"` // key in the object form, if any
+	Type      string                 `json:"type"`
+	URL       string                 `json:"url"`
+	Canonical *bool                  `json:"canonical,omitempty"`
+	Only      []string               `json:"only,omitempty"`
+	Exclude   []string               `json:"exclude,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Package   json.RawMessage        `json:"package,omitempty"` // one or more versions, for "package"
+	Disabled  bool                   `json:"-"`                 // {"packagist.org": false}
+}
+
+// IsCanonical reports whether the repository hides the packages it has from
+// the repositories after it, which is the default.
+func (r Repository) IsCanonical() bool {
+	return r.Canonical == nil || *r.Canonical
+}
+
+// RepositoryList returns the repositories in declared order, which is their
+// priority. Both the list form and the object form, keyed by name, are
+// accepted; {"packagist.org": false} disables Packagist.
+func (c *ComposerJSON) RepositoryList() ([]Repository, error) {
+	raw := bytes.TrimSpace(c.Repositories)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var entries []json.RawMessage
+	var names []string
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, fmt.Errorf("invalid repositories: %w", err)
+		}
+		names = make([]string, len(entries))
+	} else {
+		var err error
+		if names, entries, err = orderedObject(raw); err != nil {
+			return nil, fmt.Errorf("invalid repositories: %w", err)
+		}
+	}
+
+	var repos []Repository
+	for i, entry := range entries {
+		repo, err := parseRepository(names[i], entry)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// parseRepository reads one entry. A false entry, or an object holding a
+// single name mapped to false, disables the repository of that name.
+func parseRepository(name string, entry json.RawMessage) (Repository, error) {
+	var disabled bool
+	if err := json.Unmarshal(entry, &disabled); err == nil {
+		return Repository{Name: name, Disabled: !disabled}, nil
+	}
+
+	var toggle map[string]bool
+	if err := json.Unmarshal(entry, &toggle); err == nil && len(toggle) == 1 {
+		for key, enabled := range toggle {
+			return Repository{Name: key, Disabled: !enabled}, nil
+		}
+	}
+
+	var repo Repository
+	if err := json.Unmarshal(entry, &repo); err != nil {
+		return Repository{}, fmt.Errorf("invalid repository %s: %w", entry, err)
+	}
+	repo.Name = name
+	return repo, nil
+}
+
+// orderedObject splits a JSON object into its keys and values, keeping their
+// order.
+func orderedObject(raw []byte) ([]string, []json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected a list or an object")
+	}
+
+	var keys []string
+	var values []json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, tok.(string))
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
@@ -0,0 +1,174 @@
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Composer's plugin and runtime API versions, which every installation of
+// Composer 2.x "provides". Presto installs as a compatible implementation.
+const (
+	PluginAPIVersion  = "2.6.0"
+	RuntimeAPIVersion = "2.2.2"
+)
+
+// detectScript prints the platform packages of the running PHP as a JSON
+// object, following Composer's PlatformRepository.
+const detectScript = `
+$p = ['php' => PHP_VERSION];
+if (PHP_INT_SIZE === 8) { $p['php-64bit'] = PHP_VERSION; }
+if (defined('AF_INET6') || @inet_pton('::') !== false) { $p['php-ipv6'] = PHP_VERSION; }
+if (PHP_ZTS) { $p['php-zts'] = PHP_VERSION; }
+if (PHP_DEBUG) { $p['php-debug'] = PHP_VERSION; }
+foreach (get_loaded_extensions() as $e) {
+	$v = phpversion($e);
+	$p['ext-' . str_replace(' ', '-', strtolower($e))] = $v === false ? '0' : (string) $v;
+}
+if (defined('PCRE_VERSION')) { $p['lib-pcre'] = PCRE_VERSION; }
+if (defined('OPENSSL_VERSION_TEXT')) { $p['lib-openssl'] = preg_replace('{^\S+ }', '', OPENSSL_VERSION_TEXT); }
+if (defined('LIBXML_DOTTED_VERSION')) { $p['lib-libxml'] = LIBXML_DOTTED_VERSION; }
+if (defined('INTL_ICU_VERSION')) { $p['lib-icu'] = INTL_ICU_VERSION; }
+if (defined('ZLIB_VERSION')) { $p['lib-zlib'] = ZLIB_VERSION; }
+if (function_exists('curl_version')) { $c = curl_version(); $p['lib-curl'] = $c['version']; }
+echo json_encode($p);
+`
+
+var versionRe = regexp.MustCompile(`^v?(\d+(?:\.\d+){0,3})`)
+
+// IsPlatformPackage reports whether name is provided by the environment
+// rather than installed: PHP itself, its extensions and libraries, and
+// Composer's APIs.
+func IsPlatformPackage(name string) bool {
+	if name == "composer-plugin-api" || name == "composer-runtime-api" {
+		return true
+	}
+
+	if strings.Contains(name, "/") {
+		return false
+	}
+
+	return name == "php" ||
+		strings.HasPrefix(name, "php-") || // php-64bit, etc.
+		strings.HasPrefix(name, "ext-") ||
+		strings.HasPrefix(name, "lib-")
+}
+
+// Binary returns the PHP binary to inspect: $PRESTO_PHP if set, otherwise
+// "php" from the PATH.
+func Binary() string {
+	if binary := os.Getenv("PRESTO_PHP"); binary != "" {
+		return binary
+	}
+	return "php"
+}
+
+// Detect asks the PHP binary for its version, loaded extensions and the
+// libraries they were built against, keyed by platform package name.
+func Detect(binary string) (map[string]string, error) {
+	out, err := exec.Command(binary, "-r", detectScript).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", binary, err)
+	}
+
+	packages, err := parseDetected(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read platform from %s: %w", binary, err)
+	}
+	return packages, nil
+}
+
+func parseDetected(out []byte) (map[string]string, error) {
+	var raw map[string]string
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, err
+	}
+
+	packages := make(map[string]string, len(raw))
+	for name, version := range raw {
+		packages[strings.ToLower(name)] = cleanVersion(version)
+	}
+	return packages, nil
+}
+
+// cleanVersion strips build metadata and distribution suffixes, so
+// "8.1.2-1ubuntu2.14" becomes "8.1.2" and "3.0.2 15 Mar 2022" becomes
+// "3.0.2". Versions that can't be read at all become "0", as in Composer.
+func cleanVersion(version string) string {
+	if m := versionRe.FindStringSubmatch(strings.TrimSpace(version)); m != nil {
+		return m[1]
+	}
+	return "0"
+}
+
+// Overrides returns the packages set in config.platform. A package set to
+// false is returned in removed instead: it is treated as missing even if the
+// runtime has it.
+func Overrides(config map[string]interface{}) (overrides map[string]string, removed []string) {
+	overrides = make(map[string]string)
+
+	for name, value := range config {
+		name = strings.ToLower(name)
+		switch v := value.(type) {
+		case string:
+			overrides[name] = v
+		case bool:
+			if !v {
+				removed = append(removed, name)
+			}
+		}
+	}
+
+	sort.Strings(removed)
+	return overrides, removed
+}
+
+// Runtime returns the platform packages that are really there: the detected
+// runtime, if any, plus Composer's APIs.
+func Runtime(detected map[string]string) map[string]string {
+	packages := map[string]string{
+		"composer-plugin-api":  PluginAPIVersion,
+		"composer-runtime-api": RuntimeAPIVersion,
+	}
+	for name, version := range detected {
+		packages[name] = version
+	}
+	return packages
+}
+
+// Packages returns the platform the project resolves against: the runtime
+// with config.platform applied on top.
+func Packages(config map[string]interface{}, detected map[string]string) map[string]string {
+	packages := Runtime(detected)
+
+	overrides, removed := Overrides(config)
+	for name, version := range overrides {
+		packages[name] = version
+	}
+	for _, name := range removed {
+		delete(packages, name)
+	}
+
+	return packages
+}
+
+// Ignored reports whether a requirement on name is skipped under the given
+// --ignore-platform-req patterns, which may use "*" as a wildcard. Composer's
+// own APIs are never ignored.
+func Ignored(patterns []string, name string) bool {
+	if !IsPlatformPackage(name) || name == "composer-plugin-api" || name == "composer-runtime-api" {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		quoted := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+		if regexp.MustCompile("(?i)^" + quoted + "$").MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDetected(t *testing.T) {
+	out := []byte(`{"php":"8.1.2-1ubuntu2.14","php-64bit":"8.1.2-1ubuntu2.14","ext-json":"8.1.2","ext-zend-opcache":"8.1.2","ext-mongodb":"1.15.0RC1","ext-Core":"0","lib-openssl":"3.0.2 15 Mar 2022","lib-pcre":"10.39 2021-10-29","lib-weird":"unknown"}`)
+
+	got, err := parseDetected(out)
+	if err != nil {
+		t.Fatalf("parseDetected() returned error: %v", err)
+	}
+
+	want := map[string]string{
+		"php":              "8.1.2",
+		"php-64bit":        "8.1.2",
+		"ext-json":         "8.1.2",
+		"ext-zend-opcache": "8.1.2",
+		"ext-mongodb":      "1.15.0",
+		"ext-core":         "0",
+		"lib-openssl":      "3.0.2",
+		"lib-pcre":         "10.39",
+		"lib-weird":        "0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDetected() = %v, want %v", got, want)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	config := map[string]interface{}{
+		"php":         "8.2.0",
+		"ext-redis":   "5.3.7",
+		"ext-xdebug":  false,
+		"ext-ignored": true,
+	}
+	detected := map[string]string{"php": "8.1.2", "ext-json": "8.1.2", "ext-xdebug": "3.1.2"}
+
+	want := map[string]string{
+		"php":                  "8.2.0",
+		"ext-json":             "8.1.2",
+		"ext-redis":            "5.3.7",
+		"composer-plugin-api":  PluginAPIVersion,
+		"composer-runtime-api": RuntimeAPIVersion,
+	}
+	if got := Packages(config, detected); !reflect.DeepEqual(got, want) {
+		t.Errorf("Packages() = %v, want %v", got, want)
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"ext-redis", []string{"ext-redis"}, true},
+		{"ext-redis", []string{"ext-*"}, true},
+		{"ext-redis", []string{"EXT-REDIS"}, true},
+		{"ext-redis", []string{"ext-red"}, false},
+		{"php", []string{"*"}, true},
+		{"composer-plugin-api", []string{"*"}, false},
+		{"vendor/ext-redis", []string{"*"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Ignored(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("Ignored(%v, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package resolver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aras/presto/internal/packagist"
+	"github.com/aras/presto/internal/parser"
+)
+
+var inlineAliasDefinitionRe = regexp.MustCompile(`(?:^|\| *|, *)([^,\s#|]+)(?:#[^ ]+)? +as +([^,\s|]+)(?:$| *\|| *,)`)
+
+// devMetadataSource is implemented by sources that serve dev branches
+// separately from tagged releases, like Packagist's "~dev" metadata files.
+type devMetadataSource interface {
+	GetDevPackage(name string) (*packagist.PackageInfo, error)
+}
+
+// versionAlias is another version a candidate is known as, from a branch
+// alias ("dev-main" as "2.x-dev") or an inline alias in the root
+// requirements.
+type versionAlias struct {
+	version    string
+	normalized string
+}
+
+// InlineAliases returns the inline aliases declared in the root requirements,
+// such as "dev-main as 1.x-dev", the way Composer records them in the lock
+// file.
+func InlineAliases(composer *parser.ComposerJSON) ([]parser.Alias, error) {
+	aliases := []parser.Alias{}
+
+	for _, require := range []map[string]string{composer.Require, composer.RequireDev} {
+		for _, name := range sortedKeys(require) {
+			requirement := require[name]
+
+			m := inlineAliasDefinitionRe.FindStringSubmatch(requirement)
+			if m == nil {
+				if strings.Contains(requirement, " as ") {
+					return nil, fmt.Errorf("invalid alias definition in %q: %q, aliases should be in the form \"exact-version as other-exact-version\"", name, requirement)
+				}
+				continue
+			}
+
+			version, err := parseVersion(m[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid alias definition in %q: %w", name, err)
+			}
+			alias, err := parseVersion(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid alias definition in %q: %w", name, err)
+			}
+
+			aliases = append(aliases, parser.Alias{
+				Package:         strings.ToLower(name),
+				Version:         version,
+				Alias:           m[2],
+				AliasNormalized: alias,
+			})
+		}
+	}
+
+	return aliases, nil
+}
+
+// addAliases attaches the branch aliases a version declares and the root's
+// inline aliases that target it.
+func (p *pool) addAliases(name string, v *poolVersion) {
+	if v.info != nil && parseStability(v.normalized) == "dev" {
+		for branch, alias := range v.info.BranchAliases() {
+			if !strings.EqualFold(branch, v.version) {
+				continue
+			}
+			// The alias has to be a dev version itself, like "2.x-dev".
+			if normalized, err := parseVersion(alias); err == nil && !isBranch(normalized) && strings.HasSuffix(normalized, "-dev") {
+				v.aliases = append(v.aliases, versionAlias{version: alias, normalized: normalized})
+			}
+		}
+	}
+
+	for _, alias := range p.inlineAliases {
+		if alias.Package == name && alias.Version == v.normalized {
+			v.aliases = append(v.aliases, versionAlias{version: alias.Alias, normalized: alias.AliasNormalized})
+		}
+	}
+}
+
+// sortKey is the version a candidate is ordered by: a branch with an alias
+// sorts as the alias, so "dev-main" aliased to "2.x-dev" comes after 2.5.0.
+func (v *poolVersion) sortKey() string {
+	key := v.normalized
+	for _, alias := range v.aliases {
+		if isBranch(key) || compareVersions(alias.normalized, key) > 0 {
+			key = alias.normalized
+		}
+	}
+	return key
+}
+
+// matches reports whether the candidate, under its own version or any alias,
+// satisfies c.
+func (v *poolVersion) matches(c constraint) bool {
+	if c.matches(v.normalized) {
+		return true
+	}
+	for _, alias := range v.aliases {
+		if c.matches(alias.normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfVersion is what "self.version" in the candidate's links stands for: its
+// own version or any of its aliases.
+func (v *poolVersion) selfVersion() string {
+	versions := []string{v.version}
+	for _, alias := range v.aliases {
+		versions = append(versions, alias.version)
+	}
+	return strings.Join(versions, " || ")
+}
@@ -0,0 +1,100 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+func TestInlineAliases(t *testing.T) {
+	composer := &parser.ComposerJSON{
+		Require: map[string]string{
+			"a/a": "dev-main as 1.x-dev",
+			"b/b": "dev-fix#abc123 as 1.0.2",
+			"c/c": "^1.0",
+		},
+		RequireDev: map[string]string{"d/d": "1.2.x-dev as 1.2.0"},
+	}
+
+	got, err := InlineAliases(composer)
+	if err != nil {
+		t.Fatalf("InlineAliases() returned error: %v", err)
+	}
+
+	want := []parser.Alias{
+		{Package: "a/a", Version: "dev-main", Alias: "1.x-dev", AliasNormalized: "1.9999999.9999999.9999999-dev"},
+		{Package: "b/b", Version: "dev-fix", Alias: "1.0.2", AliasNormalized: "1.0.2.0"},
+		{Package: "d/d", Version: "1.2.9999999.9999999-dev", Alias: "1.2.0", AliasNormalized: "1.2.0.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InlineAliases() = %+v, want %+v", got, want)
+	}
+
+	if _, err := InlineAliases(&parser.ComposerJSON{Require: map[string]string{"a/a": "^1.0 as 1.1"}}); err == nil {
+		t.Error("InlineAliases() expected an error for a range alias")
+	}
+}
+
+func TestResolve_Aliases(t *testing.T) {
+	repo := fakeRepository{
+		"a/a": {
+			"1.0.0":       nil,
+			"dev-main":    {"branch-alias:dev-main": "2.x-dev"},
+			"dev-feature": nil,
+		},
+		"b/b":       {"1.0.0": {"a/a": "^2.0"}},
+		"c/c":       {"1.0.0": {"a/a": "^1.1"}},
+		"symfony/a": {"v5.0.0": {"symfony/b": "self.version"}},
+		"symfony/b": {"v4.0.0": nil, "v5.0.0": nil},
+	}
+
+	tests := []struct {
+		name     string
+		composer *parser.ComposerJSON
+		want     map[string]string
+	}{
+		{
+			name:     "Branch requirement",
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "dev-feature"}},
+			want:     map[string]string{"a/a": "dev-feature"},
+		},
+		{
+			name:     "Branch alias satisfies a version range",
+			composer: &parser.ComposerJSON{MinimumStability: "dev", Require: map[string]string{"b/b": "^1.0"}},
+			want:     map[string]string{"a/a": "dev-main", "b/b": "1.0.0"},
+		},
+		{
+			name:     "Branch alias is preferred over older releases",
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "*@dev"}},
+			want:     map[string]string{"a/a": "dev-main"},
+		},
+		{
+			name:     "Inline alias",
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "dev-feature as 1.1.0", "c/c": "^1.0"}},
+			want:     map[string]string{"a/a": "dev-feature", "c/c": "1.0.0"},
+		},
+		{
+			name:     "Self version requirement",
+			composer: &parser.ComposerJSON{Require: map[string]string{"symfony/a": "^5.0"}},
+			want:     map[string]string{"symfony/a": "v5.0.0", "symfony/b": "v5.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveWith(t, repo, tt.composer)
+			if err != nil {
+				t.Fatalf("Resolve() returned error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("Resolve() selected %d packages, want %d", len(got), len(tt.want))
+			}
+			for name, version := range tt.want {
+				if pkg, ok := got[name]; !ok || pkg.Version != version {
+					t.Errorf("Resolve() selected %s %v, want %s", name, pkg, version)
+				}
+			}
+		})
+	}
+}
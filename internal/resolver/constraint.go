@@ -0,0 +1,499 @@
+package resolver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// constraint is a parsed Composer version constraint that can be matched
+// against normalized versions.
+type constraint interface {
+	matches(version string) bool
+	// ranges returns the versions the constraint matches as a union of
+	// intervals, which is what two constraints are compared by.
+	ranges() []versionRange
+	String() string
+}
+
+// versionConstraint is a single "<op> <version>" comparison.
+type versionConstraint struct {
+	op      string
+	version string
+}
+
+func (c *versionConstraint) matches(version string) bool {
+	if c.op == "!=" {
+		if isBranch(version) || isBranch(c.version) {
+			return version != c.version
+		}
+		return compareVersions(version, c.version) != 0
+	}
+
+	if isBranch(version) || isBranch(c.version) {
+		return c.op == "==" && version == c.version
+	}
+
+	cmp := compareVersions(version, c.version)
+	switch c.op {
+	case "==":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func (c *versionConstraint) ranges() []versionRange {
+	if isBranch(c.version) {
+		switch c.op {
+		case "==":
+			return []versionRange{{lo: c.version, hi: c.version, loIncl: true, hiIncl: true}}
+		case "!=":
+			return []versionRange{{}}
+		}
+		return nil
+	}
+
+	switch c.op {
+	case "==":
+		return []versionRange{{lo: c.version, hi: c.version, loIncl: true, hiIncl: true}}
+	case "!=":
+		return []versionRange{{hi: c.version}, {lo: c.version}}
+	case "<", "<=":
+		return []versionRange{{hi: c.version, hiIncl: c.op == "<="}}
+	case ">", ">=":
+		return []versionRange{{lo: c.version, loIncl: c.op == ">="}}
+	}
+	return nil
+}
+
+func (c *versionConstraint) String() string {
+	return c.op + " " + c.version
+}
+
+// multiConstraint combines constraints with AND (conjunctive) or OR.
+type multiConstraint struct {
+	constraints []constraint
+	conjunctive bool
+}
+
+func (c *multiConstraint) matches(version string) bool {
+	for _, inner := range c.constraints {
+		if inner.matches(version) != c.conjunctive {
+			return !c.conjunctive
+		}
+	}
+	return c.conjunctive
+}
+
+func (c *multiConstraint) ranges() []versionRange {
+	if !c.conjunctive {
+		var union []versionRange
+		for _, inner := range c.constraints {
+			union = append(union, inner.ranges()...)
+		}
+		return union
+	}
+
+	result := []versionRange{{}}
+	for _, inner := range c.constraints {
+		var next []versionRange
+		for _, a := range result {
+			for _, b := range inner.ranges() {
+				if r, ok := a.intersect(b); ok {
+					next = append(next, r)
+				}
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+func (c *multiConstraint) String() string {
+	parts := make([]string, len(c.constraints))
+	for i, inner := range c.constraints {
+		parts[i] = inner.String()
+	}
+	if c.conjunctive {
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	return "[" + strings.Join(parts, " || ") + "]"
+}
+
+// matchAllConstraint is "*".
+type matchAllConstraint struct{}
+
+func (matchAllConstraint) matches(string) bool    { return true }
+func (matchAllConstraint) ranges() []versionRange { return []versionRange{{}} }
+func (matchAllConstraint) String() string         { return "*" }
+
+// prettyConstraint keeps the constraint as the user wrote it for messages.
+type prettyConstraint struct {
+	constraint
+	pretty string
+}
+
+func (c *prettyConstraint) String() string {
+	return c.pretty
+}
+
+// versionRange is an interval of normalized versions where an empty bound is
+// unbounded. A dev branch only ever appears as the single point [b, b], and
+// only the fully unbounded range contains branches besides that.
+type versionRange struct {
+	lo, hi         string
+	loIncl, hiIncl bool
+}
+
+func (r versionRange) isFull() bool {
+	return r.lo == "" && r.hi == ""
+}
+
+func (r versionRange) isBranch() bool {
+	return r.lo != "" && r.lo == r.hi && isBranch(r.lo)
+}
+
+func (r versionRange) intersect(o versionRange) (versionRange, bool) {
+	if r.isBranch() || o.isBranch() {
+		switch {
+		case r.isFull():
+			return o, true
+		case o.isFull(), r == o:
+			return r, true
+		}
+		return versionRange{}, false
+	}
+
+	result := r
+	if o.lo != "" {
+		if cmp := compareVersions(o.lo, result.lo); result.lo == "" || cmp > 0 || (cmp == 0 && !o.loIncl) {
+			result.lo, result.loIncl = o.lo, o.loIncl
+		}
+	}
+	if o.hi != "" {
+		if cmp := compareVersions(o.hi, result.hi); result.hi == "" || cmp < 0 || (cmp == 0 && !o.hiIncl) {
+			result.hi, result.hiIncl = o.hi, o.hiIncl
+		}
+	}
+
+	if result.lo != "" && result.hi != "" {
+		cmp := compareVersions(result.lo, result.hi)
+		if cmp > 0 || (cmp == 0 && !(result.loIncl && result.hiIncl)) {
+			return versionRange{}, false
+		}
+	}
+	return result, true
+}
+
+// intersects reports whether some version satisfies both constraints, the
+// way Composer matches a requirement against a provided or replaced version.
+func intersects(a, b constraint) bool {
+	for _, x := range a.ranges() {
+		for _, y := range b.ranges() {
+			if _, ok := x.intersect(y); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const versionPattern = `v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:\.(\d+))?` + modifierPattern + `(?:\+[^\s]+)?`
+
+var (
+	orSplitRe       = regexp.MustCompile(`\s*\|\|?\s*`)
+	aliasRe         = regexp.MustCompile(`^([^,\s]+) +as +([^,\s]+)$`)
+	stabilityFlagRe = regexp.MustCompile(`(?i)^([^,\s]*?)@(stable|RC|beta|alpha|dev)$`)
+	refSuffixRe     = regexp.MustCompile(`(?i)^(dev-[^,\s@]+?|[^,\s@]+?\.x-dev)#.+$`)
+	wildcardRe      = regexp.MustCompile(`(?i)^(v)?[xX*](\.[xX*])*$`)
+	tildeRe         = regexp.MustCompile(`(?i)^~>?` + versionPattern + `$`)
+	caretRe         = regexp.MustCompile(`(?i)^\^` + versionPattern + `$`)
+	xRangeRe        = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:\.[xX*])+$`)
+	rangeBoundRe    = regexp.MustCompile(`(?i)^` + versionPattern + `$`)
+	comparatorRe    = regexp.MustCompile(`^(<>|!=|>=?|<=?|==?)?\s*(.*)`)
+	devBranchNameRe = regexp.MustCompile(`^[0-9a-zA-Z-./]+$`)
+	stableSuffixRe  = regexp.MustCompile(`(?i)-` + modifierPattern + `$`)
+)
+
+// parseConstraints parses a Composer constraint string such as
+// "^1.2 || >=2.0 <2.5@beta" (see Composer\Semver\VersionParser).
+func parseConstraints(constraints string) (constraint, error) {
+	pretty := constraints
+	var orGroups []constraint
+
+	for _, orConstraint := range orSplitRe.Split(strings.TrimSpace(constraints), -1) {
+		var andConstraints []constraint
+		for _, part := range splitAndConstraints(orConstraint) {
+			parsed, err := parseConstraint(part)
+			if err != nil {
+				return nil, err
+			}
+			andConstraints = append(andConstraints, parsed...)
+		}
+
+		if len(andConstraints) == 1 {
+			orGroups = append(orGroups, andConstraints[0])
+		} else {
+			orGroups = append(orGroups, &multiConstraint{constraints: andConstraints, conjunctive: true})
+		}
+	}
+
+	if len(orGroups) == 1 {
+		return &prettyConstraint{constraint: orGroups[0], pretty: pretty}, nil
+	}
+
+	return &prettyConstraint{
+		constraint: &multiConstraint{constraints: orGroups},
+		pretty:     pretty,
+	}, nil
+}
+
+// splitAndConstraints splits an AND group on commas and whitespace while
+// keeping hyphen ranges ("1.0 - 2.0"), aliases ("dev-x as 1.0") and operators
+// separated from their version (">= 1.0") together.
+func splitAndConstraints(group string) []string {
+	tokens := strings.FieldsFunc(group, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	var parts []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		switch {
+		case (token == "-" || token == "as") && len(parts) > 0 && i+1 < len(tokens):
+			parts[len(parts)-1] += " " + token + " " + tokens[i+1]
+			i++
+			continue
+		case isBareOperator(token) && i+1 < len(tokens):
+			token += tokens[i+1]
+			i++
+		}
+
+		parts = append(parts, token)
+	}
+
+	if len(parts) == 0 {
+		return []string{""}
+	}
+	return parts
+}
+
+func isBareOperator(token string) bool {
+	switch token {
+	case "<", "<=", ">", ">=", "=", "==", "!=", "<>", "~", "^":
+		return true
+	}
+	return false
+}
+
+func parseConstraint(c string) ([]constraint, error) {
+	original := c
+
+	if m := aliasRe.FindStringSubmatch(c); m != nil {
+		c = m[1]
+	}
+
+	stabilityModifier := ""
+	if m := stabilityFlagRe.FindStringSubmatch(c); m != nil {
+		c = m[1]
+		if c == "" {
+			c = "*"
+		}
+		if strings.ToLower(m[2]) != "stable" {
+			stabilityModifier = m[2]
+		}
+	}
+
+	if m := refSuffixRe.FindStringSubmatch(c); m != nil {
+		c = m[1]
+	}
+
+	if m := wildcardRe.FindStringSubmatch(c); m != nil {
+		if m[1] != "" || m[2] != "" {
+			return []constraint{&versionConstraint{op: ">=", version: "0.0.0.0-dev"}}, nil
+		}
+		return []constraint{matchAllConstraint{}}, nil
+	}
+
+	if m := tildeRe.FindStringSubmatch(c); m != nil {
+		if strings.HasPrefix(c, "~>") {
+			return nil, fmt.Errorf("could not parse version constraint %s: invalid operator \"~>\", you probably meant to use the \"~\" operator", original)
+		}
+
+		position := 1
+		switch {
+		case m[4] != "":
+			position = 4
+		case m[3] != "":
+			position = 3
+		case m[2] != "":
+			position = 2
+		}
+
+		low, err := parseVersion(c[1:] + stabilitySuffix(m))
+		if err != nil {
+			return nil, err
+		}
+		high := bumpVersion(m, max(1, position-1))
+
+		return []constraint{
+			&versionConstraint{op: ">=", version: low},
+			&versionConstraint{op: "<", version: high + "-dev"},
+		}, nil
+	}
+
+	if m := caretRe.FindStringSubmatch(c); m != nil {
+		position := 3
+		switch {
+		case m[1] != "0" || m[2] == "":
+			position = 1
+		case m[2] != "0" || m[3] == "":
+			position = 2
+		}
+
+		low, err := parseVersion(c[1:] + stabilitySuffix(m))
+		if err != nil {
+			return nil, err
+		}
+		high := bumpVersion(m, position)
+
+		return []constraint{
+			&versionConstraint{op: ">=", version: low},
+			&versionConstraint{op: "<", version: high + "-dev"},
+		}, nil
+	}
+
+	if m := xRangeRe.FindStringSubmatch(c); m != nil {
+		position := 1
+		switch {
+		case m[3] != "":
+			position = 3
+		case m[2] != "":
+			position = 2
+		}
+
+		segments := []string{"", m[1], m[2], m[3], ""}
+		low := padVersion(segments, position) + "-dev"
+		high := bumpVersion(segments, position) + "-dev"
+		if low == "0.0.0.0-dev" {
+			return []constraint{&versionConstraint{op: "<", version: high}}, nil
+		}
+
+		return []constraint{
+			&versionConstraint{op: ">=", version: low},
+			&versionConstraint{op: "<", version: high},
+		}, nil
+	}
+
+	if from, to, ok := strings.Cut(c, " - "); ok {
+		return parseHyphenRange(original, strings.TrimSpace(from), strings.TrimSpace(to))
+	}
+
+	if m := comparatorRe.FindStringSubmatch(c); m != nil {
+		version, err := parseVersion(m[2])
+		if err != nil {
+			// Recover from constraints like "foobar-dev" which mean "dev-foobar".
+			if !strings.HasSuffix(m[2], "-dev") || !devBranchNameRe.MatchString(m[2]) {
+				return nil, fmt.Errorf("could not parse version constraint %s: %w", original, err)
+			}
+			version = "dev-" + strings.TrimSuffix(m[2], "-dev")
+		}
+
+		op := normalizeOperator(m[1])
+		if op != "==" && stabilityModifier != "" && parseStability(version) == "stable" {
+			version += "-" + stabilityModifier
+		} else if op == "<" || op == ">=" {
+			if !stableSuffixRe.MatchString(strings.ToLower(m[2])) && !strings.HasPrefix(m[2], "dev-") {
+				version += "-dev"
+			}
+		}
+
+		return []constraint{&versionConstraint{op: op, version: version}}, nil
+	}
+
+	return nil, fmt.Errorf("could not parse version constraint %s", original)
+}
+
+func parseHyphenRange(original, from, to string) ([]constraint, error) {
+	fm := rangeBoundRe.FindStringSubmatch(from)
+	tm := rangeBoundRe.FindStringSubmatch(to)
+	if fm == nil || tm == nil {
+		return nil, fmt.Errorf("could not parse version constraint %s", original)
+	}
+
+	low, err := parseVersion(from)
+	if err != nil {
+		return nil, err
+	}
+	lower := &versionConstraint{op: ">=", version: low + stabilitySuffix(fm)}
+
+	// A fully specified upper bound is inclusive; a partial one ("2.1") means
+	// "anything below the next minor/major".
+	if (tm[2] != "" && tm[3] != "") || tm[5] != "" || tm[7] != "" {
+		high, err := parseVersion(to)
+		if err != nil {
+			return nil, err
+		}
+		return []constraint{lower, &versionConstraint{op: "<=", version: high}}, nil
+	}
+
+	position := 2
+	if tm[2] == "" {
+		position = 1
+	}
+
+	return []constraint{lower, &versionConstraint{op: "<", version: bumpVersion(tm, position) + "-dev"}}, nil
+}
+
+// stabilitySuffix returns "-dev" when a range's lower bound carries no explicit
+// stability, so pre-releases of the lower bound itself are included.
+func stabilitySuffix(m []string) string {
+	if m[5] == "" && m[7] == "" {
+		return "-dev"
+	}
+	return ""
+}
+
+// padVersion zeroes every segment after position and joins the first four
+// numeric capture groups of m into a normalized version.
+func padVersion(m []string, position int) string {
+	segments := make([]string, 4)
+	for i := 1; i <= 4; i++ {
+		switch {
+		case i > position || m[i] == "":
+			segments[i-1] = "0"
+		default:
+			segments[i-1] = m[i]
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// bumpVersion increments the segment at position and zeroes the rest, the
+// equivalent of VersionParser::manipulateVersionString($m, $position, 1).
+func bumpVersion(m []string, position int) string {
+	segments := strings.Split(padVersion(m, position), ".")
+	n, _ := strconv.Atoi(segments[position-1])
+	segments[position-1] = strconv.Itoa(n + 1)
+	return strings.Join(segments, ".")
+}
+
+func normalizeOperator(op string) string {
+	switch op {
+	case "", "=":
+		return "=="
+	case "<>":
+		return "!="
+	}
+	return op
+}
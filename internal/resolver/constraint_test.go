@@ -0,0 +1,173 @@
+package resolver
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.0.0", "1.0.0.0"},
+		{"v1.2", "1.2.0.0"},
+		{"v9.18.1.10", "9.18.1.10"},
+		{"1.0.0-beta1", "1.0.0.0-beta1"},
+		{"1.0.0-RC2", "1.0.0.0-RC2"},
+		{"2.0.0-alpha.3", "2.0.0.0-alpha3"},
+		{"1.0.0-dev", "1.0.0.0-dev"},
+		{"2.x-dev", "2.9999999.9999999.9999999-dev"},
+		{"dev-main", "dev-main"},
+		{"master", "dev-master"},
+		{"1.0.0+build.5", "1.0.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseVersion(tt.input)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("parseVersion(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseStability(t *testing.T) {
+	tests := map[string]string{
+		"1.0.0.0":        "stable",
+		"1.0.0.0-RC1":    "RC",
+		"1.0.0.0-beta2":  "beta",
+		"1.0.0.0-alpha1": "alpha",
+		"1.0.0.0-dev":    "dev",
+		"dev-main":       "dev",
+		"1.0.0.0-patch1": "stable",
+	}
+
+	for version, expected := range tests {
+		if got := parseStability(version); got != expected {
+			t.Errorf("parseStability(%q) = %q, want %q", version, got, expected)
+		}
+	}
+}
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^1.2", "1.1.0", false},
+		{"^0.3", "0.3.5", true},
+		{"^0.3", "0.4.0", false},
+		{"~1.2", "1.9.0", true},
+		{"~1.2", "2.0.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"1.2.*", "1.2.7", true},
+		{"1.2.*", "1.3.0", false},
+		{">=1.0 <2.0", "1.5.0", true},
+		{">=1.0 <2.0", "2.0.0", false},
+		{">=1.0,<2.0", "2.0.0-beta1", false},
+		{">= 1.0", "1.0.0", true},
+		{"1.0 - 2.0", "2.0.5", true},
+		{"1.0 - 2.0.0", "2.0.5", false},
+		{"^1.0 || ^3.0", "3.1.0", true},
+		{"^1.0 || ^3.0", "2.1.0", false},
+		{"^1.0|^3.0", "3.1.0", true},
+		{"!=1.5.0", "1.5.0", false},
+		{"*", "0.0.1", true},
+		{"1.0.0", "v1.0", true},
+		{"^9.18", "v9.18.1.10", true},
+		{"^1.0@beta", "1.1.0-beta1", true},
+		{"dev-main", "dev-main", true},
+		{"dev-main", "1.0.0", false},
+		{">=1.0", "dev-main", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+" "+tt.version, func(t *testing.T) {
+			c, err := parseConstraints(tt.constraint)
+			if err != nil {
+				t.Fatalf("parseConstraints(%q) returned error: %v", tt.constraint, err)
+			}
+			normalized, err := parseVersion(tt.version)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", tt.version, err)
+			}
+			if got := c.matches(normalized); got != tt.expected {
+				t.Errorf("%q matches %q = %v, want %v", tt.constraint, tt.version, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIntersects(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"^1.0", "1.0.0 || 2.0.0", true},
+		{"^3.0", "1.0.0 || 2.0.0", false},
+		{"^1.0", "*", true},
+		{">=1.0 <2.0", ">=2.0", false},
+		{">=1.0 <=2.0", ">=2.0", true},
+		{"^1.2", "~1.1.0", false},
+		{"!=1.5.0", "1.5.0", false},
+		{"!=1.5.0", "1.5.1", true},
+		{"dev-main", "dev-main", true},
+		{"dev-main", "dev-feature", false},
+		{"dev-main", "*", true},
+		{"dev-main", "^1.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, err := parseConstraints(tt.a)
+			if err != nil {
+				t.Fatalf("parseConstraints(%q) returned error: %v", tt.a, err)
+			}
+			b, err := parseConstraints(tt.b)
+			if err != nil {
+				t.Fatalf("parseConstraints(%q) returned error: %v", tt.b, err)
+			}
+			if got := intersects(a, b); got != tt.expected {
+				t.Errorf("intersects(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.expected)
+			}
+			if got := intersects(b, a); got != tt.expected {
+				t.Errorf("intersects(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.0.0", "1.0.0.0", 0},
+		{"1.0.0.0", "1.0.1.0", -1},
+		{"1.10.0.0", "1.9.0.0", 1},
+		{"1.0.0.0-dev", "1.0.0.0-alpha1", -1},
+		{"1.0.0.0-beta1", "1.0.0.0-RC1", -1},
+		{"1.0.0.0-RC1", "1.0.0.0", -1},
+		{"1.0.0.0-patch1", "1.0.0.0", 1},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.expected {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestParseConstraints_Invalid(t *testing.T) {
+	for _, input := range []string{"~>1.0", "not-a-version", ">=foo"} {
+		if _, err := parseConstraints(input); err == nil {
+			t.Errorf("parseConstraints(%q) expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// causeKind records why an incompatibility holds.
+type causeKind int
+
+const (
+	// causeRoot is the initial "the root package must be selected" fact.
+	causeRoot causeKind = iota
+	// causeDependency comes straight from a package's require list.
+	causeDependency
+	// causeNoVersions means a requirement does not match any candidate.
+	causeNoVersions
+	// causeUnknownPackage means a required package could not be loaded.
+	causeUnknownPackage
+	// causeInvalidConstraint means a requirement could not be parsed.
+	causeInvalidConstraint
+	// causeDeclaredConflict comes from a package's conflict list.
+	causeDeclaredConflict
+	// causeReplace keeps a package from being installed alongside one that
+	// replaces it, or two packages replacing the same name together.
+	causeReplace
+	// causeConflict is derived from two other incompatibilities during
+	// conflict resolution.
+	causeConflict
+)
+
+// incompatibility is a set of terms that must never all be true at once.
+type incompatibility struct {
+	terms []term
+	kind  causeKind
+
+	// For causeConflict: the two incompatibilities this was derived from.
+	conflict, other *incompatibility
+
+	// For causeNoVersions, causeUnknownPackage and causeInvalidConstraint:
+	// the requirement that could not be satisfied. For causeReplace: the
+	// replaced name.
+	dependency string
+	constraint string
+	err        error
+}
+
+// newIncompatibility builds an incompatibility, merging terms that refer to
+// the same package and dropping terms that can never be false.
+func newIncompatibility(terms []term, kind causeKind, rootName string) *incompatibility {
+	// The root package is always selected, so a positive root term adds
+	// nothing to a derived incompatibility except noise in error messages.
+	if kind == causeConflict && len(terms) > 1 {
+		filtered := terms[:0:0]
+		for _, t := range terms {
+			if t.name == rootName && t.positive() {
+				continue
+			}
+			filtered = append(filtered, t)
+		}
+		terms = filtered
+	}
+
+	var merged []term
+	index := make(map[string]int)
+	for _, t := range terms {
+		if i, ok := index[t.name]; ok {
+			merged[i] = merged[i].intersect(t)
+			continue
+		}
+		index[t.name] = len(merged)
+		merged = append(merged, t)
+	}
+
+	result := merged[:0]
+	for _, t := range merged {
+		if !t.set.isFull() {
+			result = append(result, t)
+		}
+	}
+
+	return &incompatibility{terms: result, kind: kind}
+}
+
+// isFailure reports whether the incompatibility proves there is no solution:
+// it either has no terms or only says that the root package can't be chosen.
+func (inc *incompatibility) isFailure(rootName string) bool {
+	return len(inc.terms) == 0 ||
+		(len(inc.terms) == 1 && inc.terms[0].name == rootName && inc.terms[0].positive())
+}
+
+// format renders a single incompatibility as a sentence, for example
+// "foo/bar >=1.2 requires baz/qux ^2" or "foo/bar 1.0 is forbidden".
+func (inc *incompatibility) format(p *pool, rootLabel string) string {
+	terse := func(t term) string {
+		if t.name == rootName {
+			return rootLabel
+		}
+		return t.name + " " + t.describe(p)
+	}
+	// subject names the package a sentence is about, where "every version
+	// of foo/bar" reads better than "foo/bar *".
+	subject := func(t term) string {
+		if t.name != rootName && t.describe(p) == "*" {
+			return "every version of " + t.name
+		}
+		return terse(t)
+	}
+
+	switch inc.kind {
+	case causeRoot:
+		return rootLabel + " is required"
+	case causeDependency:
+		return subject(inc.terms[0]) + " requires " + terse(inc.terms[1].inverse())
+	case causeNoVersions:
+		if pkg := p.packages[inc.dependency]; pkg != nil && pkg.platform && len(pkg.versions) > pkg.virtual {
+			return fmt.Sprintf("%s requires %s %s but your %s version (%s) does not satisfy that requirement", subject(inc.terms[0]), inc.dependency, inc.constraint, inc.dependency, pkg.versions[len(pkg.versions)-1].version)
+		}
+		return fmt.Sprintf("%s requires %s %s which doesn't match any versions", subject(inc.terms[0]), inc.dependency, inc.constraint)
+	case causeUnknownPackage:
+		if pkg := p.packages[inc.dependency]; pkg != nil && pkg.platform {
+			return fmt.Sprintf("%s requires %s %s but it is missing from your system", subject(inc.terms[0]), inc.dependency, inc.constraint)
+		}
+		return fmt.Sprintf("%s requires %s %s which doesn't exist", subject(inc.terms[0]), inc.dependency, inc.constraint)
+	case causeInvalidConstraint:
+		return fmt.Sprintf("%s requires %s with an invalid constraint %q", subject(inc.terms[0]), inc.dependency, inc.constraint)
+	case causeDeclaredConflict:
+		return subject(inc.terms[0]) + " conflicts with " + terse(inc.terms[1])
+	case causeReplace:
+		if inc.terms[1].name == inc.dependency {
+			return subject(inc.terms[0]) + " replaces " + inc.dependency
+		}
+		return subject(inc.terms[0]) + " and " + subject(inc.terms[1]) + " both replace " + inc.dependency
+	}
+
+	if inc.isFailure(rootName) {
+		return "version solving failed"
+	}
+
+	if len(inc.terms) == 1 {
+		t := inc.terms[0]
+		if t.positive() {
+			return subject(t) + " is forbidden"
+		}
+		return terse(t.inverse()) + " is required"
+	}
+
+	var positive, negative []string
+	for _, t := range inc.terms {
+		if t.positive() {
+			positive = append(positive, subject(t))
+		} else {
+			negative = append(negative, terse(t.inverse()))
+		}
+	}
+
+	switch {
+	case len(positive) == 1 && len(negative) > 0:
+		return positive[0] + " requires " + strings.Join(negative, " or ")
+	case len(positive) > 0 && len(negative) > 0:
+		return "if " + strings.Join(positive, " and ") + " then " + strings.Join(negative, " or ")
+	case len(positive) == 2:
+		return positive[0] + " is incompatible with " + positive[1]
+	case len(positive) > 0:
+		return "one of " + strings.Join(positive, " or ") + " must be false"
+	default:
+		return "one of " + strings.Join(negative, " or ") + " must be true"
+	}
+}
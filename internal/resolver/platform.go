@@ -0,0 +1,214 @@
+package resolver
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/platform"
+)
+
+// PlatformLink is one requirement on a platform package.
+type PlatformLink struct {
+	Source     string // the package declaring the requirement
+	Constraint string
+}
+
+// PlatformCheck is the outcome of checking one platform package against
+// every requirement on it.
+type PlatformCheck struct {
+	Name       string
+	Version    string // installed version, "" when missing
+	ProvidedBy string // package that provides or replaces it, if any
+	Links      []PlatformLink
+	Failed     []PlatformLink // links the installed version doesn't satisfy
+}
+
+// Missing reports whether the package is neither installed nor provided.
+func (c PlatformCheck) Missing() bool {
+	return c.Version == "" && c.ProvidedBy == ""
+}
+
+// OK reports whether every requirement on the package holds.
+func (c PlatformCheck) OK() bool {
+	return !c.Missing() && (len(c.Failed) == 0 || c.ProvidedBy != "")
+}
+
+// CheckPlatform checks the platform requirements of packages, and the root
+// requirements given as root, against the installed platform packages. A
+// requirement on something one of packages provides or replaces, like an
+// extension polyfill, holds regardless of the runtime. Results are sorted by
+// name.
+func CheckPlatform(packages []parser.LockedPackage, root map[string]string, rootLabel string, installed map[string]string) []PlatformCheck {
+	checks := make(map[string]*PlatformCheck)
+	addLinks := func(source string, require map[string]string) {
+		require = lowercaseKeys(require)
+		for _, name := range sortedKeys(require) {
+			if !platform.IsPlatformPackage(name) {
+				continue
+			}
+			check, ok := checks[name]
+			if !ok {
+				check = &PlatformCheck{Name: name}
+				checks[name] = check
+			}
+			check.Links = append(check.Links, PlatformLink{Source: source, Constraint: require[name]})
+		}
+	}
+
+	addLinks(rootLabel, root)
+	for _, lp := range packages {
+		addLinks(lp.Name, lp.Require)
+	}
+
+	var result []PlatformCheck
+	for _, name := range sortedCheckNames(checks) {
+		check := checks[name]
+		check.Version = installed[name]
+
+		for _, lp := range packages {
+			if _, ok := lowercaseKeys(lp.Provide)[name]; ok {
+				check.ProvidedBy = lp.Name
+				break
+			}
+			if _, ok := lowercaseKeys(lp.Replace)[name]; ok {
+				check.ProvidedBy = lp.Name
+				break
+			}
+		}
+
+		if check.Version != "" {
+			normalized, err := parseVersion(check.Version)
+			for _, link := range check.Links {
+				c, cerr := parseConstraints(link.Constraint)
+				if err != nil || cerr != nil || !c.matches(normalized) {
+					check.Failed = append(check.Failed, link)
+				}
+			}
+		}
+
+		result = append(result, *check)
+	}
+
+	return result
+}
+
+func sortedCheckNames(checks map[string]*PlatformCheck) []string {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RuntimeRequirements is what the PHP runtime must offer for a set of
+// packages to work, as vendor/composer/platform_check.php enforces it.
+type RuntimeRequirements struct {
+	PHP          string // lowest allowed PHP version, e.g. "8.1.0"; "" if unbounded
+	PHPInclusive bool
+	PHP64Bit     bool
+	Extensions   []string // names as extension_loaded() knows them, sorted
+}
+
+// CollectRuntimeRequirements gathers the PHP version bound and extensions
+// required by the root and packages, the way Composer's autoload generator
+// does: the highest lower bound of all php constraints wins, and extensions
+// that some package provides or replaces, or that match one of ignore, are
+// left out.
+func CollectRuntimeRequirements(composer *parser.ComposerJSON, packages []*Package, ignore []string) RuntimeRequirements {
+	type source struct {
+		require, provide, replace map[string]string
+	}
+	sources := []source{{composer.Require, composer.Provide, composer.Replace}}
+	for _, pkg := range packages {
+		sources = append(sources, source{pkg.Require, pkg.Provide, pkg.Replace})
+	}
+
+	provided := make(map[string]bool)
+	for _, src := range sources {
+		for name := range lowercaseKeys(src.provide) {
+			provided[name] = true
+		}
+		for name := range lowercaseKeys(src.replace) {
+			provided[name] = true
+		}
+	}
+
+	var result RuntimeRequirements
+	var lowest versionRange
+	extensions := make(map[string]bool)
+	for _, src := range sources {
+		require := lowercaseKeys(src.require)
+		for _, name := range sortedKeys(require) {
+			if platform.Ignored(ignore, name) {
+				continue
+			}
+
+			switch {
+			case name == "php":
+				bound, ok := lowerBound(require[name])
+				if ok && (lowest.lo == "" || compareVersions(bound.lo, lowest.lo) > 0 || (compareVersions(bound.lo, lowest.lo) == 0 && !bound.loIncl)) {
+					lowest = bound
+				}
+			case name == "php-64bit":
+				result.PHP64Bit = true
+			case strings.HasPrefix(name, "ext-") && !provided[name]:
+				extension := strings.TrimPrefix(name, "ext-")
+				if extension == "zend-opcache" {
+					extension = "zend opcache"
+				}
+				extensions[extension] = true
+			}
+		}
+	}
+
+	if lowest.lo != "" {
+		result.PHP = strings.Join(versionSegments(lowest.lo, 3), ".")
+		result.PHPInclusive = lowest.loIncl
+	}
+	for extension := range extensions {
+		result.Extensions = append(result.Extensions, extension)
+	}
+	sort.Strings(result.Extensions)
+
+	return result
+}
+
+// lowerBound returns the lowest version a constraint allows, or false when it
+// has none worth checking: no lower bound at all, or 0.
+func lowerBound(requirement string) (versionRange, bool) {
+	c, err := parseConstraints(requirement)
+	if err != nil {
+		return versionRange{}, false
+	}
+
+	var lowest versionRange
+	for _, r := range c.ranges() {
+		if r.isBranch() {
+			continue
+		}
+		if r.lo == "" {
+			return versionRange{}, false
+		}
+		if lowest.lo == "" || compareVersions(r.lo, lowest.lo) < 0 {
+			lowest = r
+		}
+	}
+
+	if lowest.lo == "" || compareVersions(lowest.lo, "0.0.0.0-dev") <= 0 {
+		return versionRange{}, false
+	}
+	return lowest, true
+}
+
+// versionSegments returns the first n numeric segments of a normalized
+// version, so "8.1.0.0-dev" gives ["8", "1", "0"].
+func versionSegments(normalized string, n int) []string {
+	base, _, _ := strings.Cut(normalized, "-")
+	segments := strings.Split(base, ".")
+	for len(segments) < n {
+		segments = append(segments, "0")
+	}
+	return segments[:n]
+}
@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+func TestCheckPlatform(t *testing.T) {
+	packages := []parser.LockedPackage{
+		{Name: "a/a", Version: "2.0.0", Require: map[string]string{"php": ">=8.3", "ext-json": "*"}},
+		{Name: "b/b", Version: "1.0.0", Require: map[string]string{"ext-redis": "^5.0", "psr/log": "^1.0"}},
+		{Name: "c/c", Version: "1.0.0", Require: map[string]string{"ext-mbstring": "*"}},
+		{Name: "symfony/polyfill-mbstring", Version: "v1.28.0", Provide: map[string]string{"ext-mbstring": "*"}},
+	}
+	root := map[string]string{"php": "^8.1"}
+	installed := map[string]string{"php": "8.1.2", "ext-json": "8.1.2"}
+
+	checks := CheckPlatform(packages, root, "my/app", installed)
+
+	want := []PlatformCheck{
+		{
+			Name:    "ext-json",
+			Version: "8.1.2",
+			Links:   []PlatformLink{{Source: "a/a", Constraint: "*"}},
+		},
+		{
+			Name:       "ext-mbstring",
+			ProvidedBy: "symfony/polyfill-mbstring",
+			Links:      []PlatformLink{{Source: "c/c", Constraint: "*"}},
+		},
+		{
+			Name:  "ext-redis",
+			Links: []PlatformLink{{Source: "b/b", Constraint: "^5.0"}},
+		},
+		{
+			Name:    "php",
+			Version: "8.1.2",
+			Links:   []PlatformLink{{Source: "my/app", Constraint: "^8.1"}, {Source: "a/a", Constraint: ">=8.3"}},
+			Failed:  []PlatformLink{{Source: "a/a", Constraint: ">=8.3"}},
+		},
+	}
+	if !reflect.DeepEqual(checks, want) {
+		t.Fatalf("CheckPlatform() = %+v, want %+v", checks, want)
+	}
+
+	ok := make(map[string]bool)
+	for _, check := range checks {
+		ok[check.Name] = check.OK()
+	}
+	wantOK := map[string]bool{"ext-json": true, "ext-mbstring": true, "ext-redis": false, "php": false}
+	if !reflect.DeepEqual(ok, wantOK) {
+		t.Errorf("OK() = %v, want %v", ok, wantOK)
+	}
+}
+
+func TestCollectRuntimeRequirements(t *testing.T) {
+	composer := &parser.ComposerJSON{Require: map[string]string{"php": "^8.0", "ext-json": "*"}}
+	packages := []*Package{
+		{Name: "a/a", Require: map[string]string{"php": ">=7.4 <9.0", "ext-mbstring": "*", "ext-zend-opcache": "*"}},
+		{Name: "b/b", Require: map[string]string{"php": "^8.1 || ^9.0", "php-64bit": "*", "ext-redis": "*"}},
+		{Name: "symfony/polyfill-mbstring", Provide: map[string]string{"ext-mbstring": "*"}},
+	}
+
+	got := CollectRuntimeRequirements(composer, packages, []string{"ext-redis"})
+	want := RuntimeRequirements{
+		PHP:          "8.1.0",
+		PHPInclusive: true,
+		PHP64Bit:     true,
+		Extensions:   []string{"json", "zend opcache"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CollectRuntimeRequirements() = %+v, want %+v", got, want)
+	}
+
+	got = CollectRuntimeRequirements(&parser.ComposerJSON{Require: map[string]string{"php": ">8.0 || *"}}, nil, nil)
+	if got.PHP != "" {
+		t.Errorf("CollectRuntimeRequirements() PHP = %q for an unbounded constraint, want none", got.PHP)
+	}
+}
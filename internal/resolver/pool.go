@@ -0,0 +1,359 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aras/presto/internal/packagist"
+	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/platform"
+)
+
+// metadataSource provides package metadata to the resolver. It is satisfied by
+// *packagist.Client and lets tests plug in an in-memory repository.
+type metadataSource interface {
+	GetPackage(name string) (*packagist.PackageInfo, error)
+}
+
+// pool holds every candidate version the solver may pick from, keyed by
+// lowercase package name. collect loads everything reachable from the root
+// before solving; packages never change afterwards, so version sets built
+// against a package stay valid for the whole solve.
+type pool struct {
+	source        metadataSource
+	fetcher       *prefetcher
+	stability     stabilityRules
+	inlineAliases []parser.Alias
+	locked        map[string]*packagist.VersionInfo // packages a partial update keeps
+	platform      map[string]string                 // installed platform packages, if checked
+	packages      map[string]*poolPackage
+	replacers     map[string][]*poolPackage
+	rootLabel     string
+}
+
+// poolPackage is the ordered list of candidates for a name: first the
+// packages that provide or replace it, then its own versions, lowest first.
+type poolPackage struct {
+	name     string
+	versions []*poolVersion
+	virtual  int   // number of provider candidates at the start of versions
+	err      error // set when the package could not be loaded
+	platform bool  // php, an extension or a library, fixed by the system
+
+	matching map[string]versionSet
+}
+
+// poolVersion is a single candidate version.
+type poolVersion struct {
+	version    string // as published, e.g. "v1.2.3"
+	normalized string // e.g. "1.2.3.0"
+	aliases    []versionAlias
+	require    map[string]string
+	conflict   map[string]string
+	replace    map[string]string
+	provide    map[string]string
+	info       *packagist.VersionInfo
+
+	// provider is set on virtual candidates, which stand for another
+	// package that provides or replaces this name; choosing one requires
+	// the provider and installs nothing under this name.
+	provider *poolVersion
+	provides constraint
+}
+
+func newPool(source metadataSource) *pool {
+	return &pool{
+		source:    source,
+		fetcher:   newPrefetcher(source, prefetchWorkers),
+		packages:  make(map[string]*poolPackage),
+		replacers: make(map[string][]*poolPackage),
+		rootLabel: rootName,
+	}
+}
+
+// collect loads every package reachable from the root, the way Composer's
+// pool builder does: a version's requirements are only followed when some
+// requirement seen so far matches it. Metadata for every newly seen name is
+// requested right away, so requests overlap and the walk only waits on one
+// round-trip per level of the graph. Providers and replacers are then added
+// as candidates for the names they stand in for, which is only possible once
+// the pool is complete.
+func (p *pool) collect(root *poolPackage, skip func(string) bool) {
+	explored := make(map[*poolVersion]bool)
+	seen := make(map[string]bool)
+
+	var queue [][2]string
+	follow := func(v *poolVersion) {
+		explored[v] = true
+		for _, name := range sortedKeys(v.require) {
+			if skip(name) || seen[name+" "+v.require[name]] {
+				continue
+			}
+			seen[name+" "+v.require[name]] = true
+			queue = append(queue, [2]string{name, v.require[name]})
+			p.prefetch(name)
+		}
+	}
+
+	for _, v := range root.versions {
+		follow(v)
+	}
+
+	for len(queue) > 0 {
+		name, requirement := queue[0][0], queue[0][1]
+		queue = queue[1:]
+
+		pkg := p.load(name)
+		c, err := parseConstraints(requirement)
+		if err != nil {
+			continue
+		}
+		for _, v := range pkg.versions {
+			if !explored[v] && v.matches(c) {
+				follow(v)
+			}
+		}
+	}
+
+	p.addProviders()
+}
+
+// addProviders turns every provide and replace link onto a name in the pool
+// into a virtual candidate of that name, and records who replaces what.
+func (p *pool) addProviders() {
+	virtual := make(map[string][]*poolVersion)
+
+	for _, providerName := range p.names() {
+		provider := p.packages[providerName]
+		replaces := make(map[string]bool)
+		for _, v := range provider.versions {
+			for name := range v.replace {
+				if !replaces[name] && name != providerName {
+					replaces[name] = true
+					p.replacers[name] = append(p.replacers[name], provider)
+				}
+			}
+
+			for _, link := range []struct {
+				targets map[string]string
+				verb    string
+			}{{v.provide, "provided"}, {v.replace, "replaced"}} {
+				for _, name := range sortedKeys(link.targets) {
+					if _, ok := p.packages[name]; !ok || name == providerName {
+						continue
+					}
+
+					c, err := parseConstraints(link.targets[name])
+					if err != nil {
+						continue
+					}
+
+					virtual[name] = append(virtual[name], &poolVersion{
+						version:  fmt.Sprintf("%s by %s", link.verb, p.describeVersion(providerName, v)),
+						require:  map[string]string{providerName: v.version},
+						info:     v.info,
+						provider: v,
+						provides: c,
+					})
+				}
+			}
+		}
+	}
+
+	for name, candidates := range virtual {
+		pkg := p.packages[name]
+		pkg.versions = append(candidates, pkg.versions...)
+		pkg.virtual = len(candidates)
+	}
+}
+
+// describeVersion names a single version of a package in messages.
+func (p *pool) describeVersion(name string, v *poolVersion) string {
+	if name == rootName {
+		return p.rootLabel
+	}
+	return name + " " + v.version
+}
+
+// names returns the names of every package in the pool in sorted order.
+func (p *pool) names() []string {
+	names := make([]string, 0, len(p.packages))
+	for name := range p.packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// add registers a package whose versions are already known, such as the root
+// package.
+func (p *pool) add(name string, versions []*poolVersion) *poolPackage {
+	pkg := &poolPackage{name: name, versions: versions, matching: make(map[string]versionSet)}
+	p.packages[name] = pkg
+	return pkg
+}
+
+// load returns the candidates for name, fetching them on first use.
+func (p *pool) load(name string) *poolPackage {
+	name = strings.ToLower(name)
+	if pkg, ok := p.packages[name]; ok {
+		return pkg
+	}
+
+	pkg := &poolPackage{name: name, matching: make(map[string]versionSet)}
+	p.packages[name] = pkg
+
+	// A package kept at its locked version has that single candidate,
+	// taken from the lock file rather than the repository. So does a
+	// platform package, whose version is whatever the system has.
+	lockedInfo, fixed := p.locked[name]
+	versions := []*packagist.VersionInfo{lockedInfo}
+	if p.platform != nil && platform.IsPlatformPackage(name) {
+		pkg.platform = true
+		version, ok := p.platform[name]
+		if !ok {
+			pkg.err = fmt.Errorf("%s is missing from your system", name)
+			return pkg
+		}
+		fixed = true
+		versions = []*packagist.VersionInfo{{Name: name, Version: version, Type: "platform"}}
+	} else if !fixed {
+		info, devInfo, err := p.fetcher.get(name, p.wantsBranches(name))
+		if err != nil {
+			pkg.err = err
+			return pkg
+		}
+
+		versions = make([]*packagist.VersionInfo, 0, len(info.Versions))
+		for _, vi := range info.Versions {
+			versions = append(versions, vi)
+		}
+		if devInfo != nil {
+			for _, vi := range devInfo.Versions {
+				versions = append(versions, vi)
+			}
+		}
+	}
+
+	for _, vi := range versions {
+		normalized := vi.VersionNormalized
+		if normalized == "" {
+			var err error
+			if normalized, err = parseVersion(vi.Version); err != nil {
+				continue
+			}
+		}
+
+		if !fixed && !p.stability.accepts(name, parseStability(normalized)) {
+			continue
+		}
+
+		v := &poolVersion{
+			version:    vi.Version,
+			normalized: normalized,
+			info:       vi,
+		}
+		p.addAliases(name, v)
+
+		// "self.version" in a link stands for the version declaring it.
+		v.require = expandSelfVersion(lowercaseKeys(vi.Require), v)
+		v.conflict = expandSelfVersion(lowercaseKeys(vi.Conflict), v)
+		v.replace = expandSelfVersion(lowercaseKeys(vi.Replace), v)
+		v.provide = expandSelfVersion(lowercaseKeys(vi.Provide), v)
+
+		pkg.versions = append(pkg.versions, v)
+	}
+
+	sort.Slice(pkg.versions, func(i, j int) bool {
+		if cmp := compareVersions(pkg.versions[i].sortKey(), pkg.versions[j].sortKey()); cmp != 0 {
+			return cmp < 0
+		}
+		// Several tags can normalize to the same version ("1.0" and "v1.0.0");
+		// fall back to the published string for a stable order.
+		return pkg.versions[i].version < pkg.versions[j].version
+	})
+
+	return pkg
+}
+
+// prefetch starts fetching the metadata load will need for name, if it comes
+// from the repository at all.
+func (p *pool) prefetch(name string) {
+	name = strings.ToLower(name)
+	if _, loaded := p.packages[name]; loaded {
+		return
+	}
+	if _, locked := p.locked[name]; locked || (p.platform != nil && platform.IsPlatformPackage(name)) {
+		return
+	}
+	p.fetcher.start(name, p.wantsBranches(name))
+}
+
+// wantsBranches reports whether dev branches of name are worth fetching,
+// which they only are when they could be installed.
+func (p *pool) wantsBranches(name string) bool {
+	return p.stability.accepts(name, "dev")
+}
+
+func expandSelfVersion(links map[string]string, v *poolVersion) map[string]string {
+	for name, constraint := range links {
+		if constraint == "self.version" {
+			links[name] = v.selfVersion()
+		}
+	}
+	return links
+}
+
+// stability returns the stability of a candidate; a virtual candidate is as
+// stable as its provider.
+func (v *poolVersion) stability() string {
+	if v.provider != nil {
+		return v.provider.stability()
+	}
+	return parseStability(v.normalized)
+}
+
+// real returns the set of the package's own versions, without providers.
+func (pkg *poolPackage) real() versionSet {
+	return rangeVersionSet(len(pkg.versions), pkg.virtual, len(pkg.versions)-1)
+}
+
+// allowed returns the set of versions matching the given constraint.
+func (pkg *poolPackage) allowed(c constraint) versionSet {
+	key := c.String()
+	if set, ok := pkg.matching[key]; ok {
+		return set
+	}
+
+	set := newVersionSet(len(pkg.versions))
+	for i, v := range pkg.versions {
+		if v.provider != nil {
+			if intersects(c, v.provides) {
+				set = set.with(i)
+			}
+		} else if v.matches(c) {
+			set = set.with(i)
+		}
+	}
+
+	pkg.matching[key] = set
+	return set
+}
+
+func lowercaseKeys(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
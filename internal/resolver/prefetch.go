@@ -0,0 +1,84 @@
+package resolver
+
+import (
+	"sync"
+
+	"github.com/aras/presto/internal/packagist"
+)
+
+// prefetchWorkers bounds the number of metadata requests in flight at once.
+const prefetchWorkers = 16
+
+// prefetcher fetches package metadata in the background, so the pool can
+// keep discovering the dependency graph while earlier requests are still in
+// flight. Each name is fetched once; asking again waits for the first
+// request.
+type prefetcher struct {
+	source metadataSource
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]*prefetch
+}
+
+// prefetch is the outcome of fetching one package, available once done is
+// closed.
+type prefetch struct {
+	done chan struct{}
+	info *packagist.PackageInfo
+	dev  *packagist.PackageInfo // dev branches, if asked for and available
+	err  error
+}
+
+func newPrefetcher(source metadataSource, workers int) *prefetcher {
+	return &prefetcher{
+		source:   source,
+		slots:    make(chan struct{}, workers),
+		inflight: make(map[string]*prefetch),
+	}
+}
+
+// start begins fetching name, and its dev branches if withDev, unless that
+// is already under way.
+func (f *prefetcher) start(name string, withDev bool) *prefetch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if pf, ok := f.inflight[name]; ok {
+		return pf
+	}
+
+	pf := &prefetch{done: make(chan struct{})}
+	f.inflight[name] = pf
+
+	go func() {
+		defer close(pf.done)
+
+		f.slots <- struct{}{}
+		defer func() { <-f.slots }()
+
+		pf.info, pf.err = f.source.GetPackage(name)
+		if !withDev {
+			return
+		}
+		if dev, ok := f.source.(devMetadataSource); ok {
+			// Branches are optional; a package may have none. It may also
+			// have nothing but branches, like an unversioned package from
+			// a path repository.
+			pf.dev, _ = dev.GetDevPackage(name)
+			if pf.err != nil && pf.dev != nil {
+				pf.info = &packagist.PackageInfo{Name: pf.dev.Name, Versions: map[string]*packagist.VersionInfo{}}
+				pf.err = nil
+			}
+		}
+	}()
+
+	return pf
+}
+
+// get waits for the metadata of name, starting the request if nobody has.
+func (f *prefetcher) get(name string, withDev bool) (info, dev *packagist.PackageInfo, err error) {
+	pf := f.start(name, withDev)
+	<-pf.done
+	return pf.info, pf.dev, pf.err
+}
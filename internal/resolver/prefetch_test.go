@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aras/presto/internal/packagist"
+	"github.com/aras/presto/internal/parser"
+)
+
+// slowRepository wraps a fakeRepository with a delay per request and records
+// how many requests were in flight at once.
+type slowRepository struct {
+	repo fakeRepository
+
+	mu          sync.Mutex
+	calls       map[string]int
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *slowRepository) GetPackage(name string) (*packagist.PackageInfo, error) {
+	s.mu.Lock()
+	s.calls[name]++
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return s.repo.GetPackage(name)
+}
+
+func TestResolve_PrefetchesConcurrently(t *testing.T) {
+	repo := fakeRepository{
+		"a/a": {"1.0.0": {"d/d": "^1.0", "e/e": "^1.0"}},
+		"b/b": {"1.0.0": {"d/d": "^1.0", "f/f": "^1.0"}},
+		"c/c": {"1.0.0": {"f/f": "^1.0"}},
+		"d/d": {"1.0.0": nil},
+		"e/e": {"1.0.0": nil},
+		"f/f": {"1.0.0": nil},
+	}
+	source := &slowRepository{repo: repo, calls: make(map[string]int)}
+
+	r := &Resolver{source: source}
+	packages, err := r.Resolve(&parser.ComposerJSON{Require: map[string]string{"a/a": "*", "b/b": "*", "c/c": "*"}})
+	if err != nil {
+		t.Fatalf("Resolve() returned error: %v", err)
+	}
+	if len(packages) != 6 {
+		t.Errorf("Resolve() returned %d packages, want 6", len(packages))
+	}
+
+	for name, calls := range source.calls {
+		if calls != 1 {
+			t.Errorf("%s fetched %d times, want once", name, calls)
+		}
+	}
+	if source.maxInFlight < 2 {
+		t.Errorf("at most %d requests were in flight, want concurrent requests", source.maxInFlight)
+	}
+}
+
+// branchRepository serves the branches of a fakeRepository apart from its
+// releases, as Packagist does.
+type branchRepository struct {
+	repo fakeRepository
+}
+
+func (b branchRepository) GetPackage(name string) (*packagist.PackageInfo, error) {
+	return b.filter(name, false)
+}
+
+func (b branchRepository) GetDevPackage(name string) (*packagist.PackageInfo, error) {
+	return b.filter(name, true)
+}
+
+func (b branchRepository) filter(name string, dev bool) (*packagist.PackageInfo, error) {
+	info, err := b.repo.GetPackage(name)
+	if err != nil {
+		return nil, err
+	}
+	for version := range info.Versions {
+		if strings.HasPrefix(version, "dev-") != dev {
+			delete(info.Versions, version)
+		}
+	}
+	if len(info.Versions) == 0 {
+		return nil, fmt.Errorf("no versions found for package %s", name)
+	}
+	return info, nil
+}
+
+func TestResolve_BranchesOnly(t *testing.T) {
+	r := &Resolver{source: branchRepository{fakeRepository{
+		"a/a": {"dev-main": {"b/b": "^1.0"}},
+		"b/b": {"1.0.0": nil, "dev-main": nil},
+	}}}
+
+	packages, err := r.Resolve(&parser.ComposerJSON{Require: map[string]string{"a/a": "*@dev"}})
+	if err != nil {
+		t.Fatalf("Resolve() returned error: %v", err)
+	}
+	got := map[string]string{}
+	for _, pkg := range packages {
+		got[pkg.Name] = pkg.Version
+	}
+	if want := map[string]string{"a/a": "dev-main", "b/b": "1.0.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve() = %v, want %v", got, want)
+	}
+}
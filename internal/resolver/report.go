@@ -0,0 +1,238 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explain returns a step-by-step account of why resolution failed, following
+// the derivation graph of the final incompatibility:
+//
+//	Because a/a 1.0.0 requires c/c ^1.0 and b/b 1.0.0 requires c/c ^2.0, a/a 1.0.0 is incompatible with b/b 1.0.0.
+//	And because my/app requires a/a ^1.0 and b/b ^1.0, version solving failed.
+func (e *SolveFailure) Explain() string {
+	w := &failureWriter{
+		root:        e.incompatibility,
+		pool:        e.pool,
+		rootLabel:   e.rootLabel,
+		derivations: make(map[*incompatibility]int),
+		lineNumbers: make(map[*incompatibility]int),
+	}
+	return w.write(e.incompatibility)
+}
+
+// failureWriter renders a derivation graph as numbered prose, the same way
+// pub and uv report PubGrub failures. Incompatibilities that are used more
+// than once get a line number so later lines can refer back to them.
+type failureWriter struct {
+	root      *incompatibility
+	pool      *pool
+	rootLabel string
+
+	derivations map[*incompatibility]int
+	lineNumbers map[*incompatibility]int
+	lines       []reportLine
+}
+
+type reportLine struct {
+	message string
+	number  int // 0 when the line is not referenced elsewhere
+}
+
+func (w *failureWriter) write(root *incompatibility) string {
+	if root.kind != causeConflict {
+		return fmt.Sprintf("Because %s, version solving failed.\n", w.format(root))
+	}
+
+	w.countDerivations(root)
+	w.visit(root, false)
+
+	padding := 0
+	if len(w.lineNumbers) > 0 {
+		padding = len(fmt.Sprintf("(%d) ", len(w.lineNumbers)))
+	}
+
+	var out strings.Builder
+	lastWasEmpty := false
+	for _, line := range w.lines {
+		if line.message == "" {
+			if !lastWasEmpty {
+				out.WriteString("\n")
+			}
+			lastWasEmpty = true
+			continue
+		}
+		lastWasEmpty = false
+
+		prefix := strings.Repeat(" ", padding)
+		if line.number > 0 {
+			prefix = fmt.Sprintf("%-*s", padding, fmt.Sprintf("(%d)", line.number))
+		}
+		out.WriteString(prefix + line.message + "\n")
+	}
+
+	return out.String()
+}
+
+func (w *failureWriter) countDerivations(inc *incompatibility) {
+	w.derivations[inc]++
+	if w.derivations[inc] > 1 || inc.kind != causeConflict {
+		return
+	}
+	w.countDerivations(inc.conflict)
+	w.countDerivations(inc.other)
+}
+
+func (w *failureWriter) format(inc *incompatibility) string {
+	return inc.format(w.pool, w.rootLabel)
+}
+
+func (w *failureWriter) emit(inc *incompatibility, message string, numbered bool) {
+	if !numbered {
+		w.lines = append(w.lines, reportLine{message: message})
+		return
+	}
+
+	number := len(w.lineNumbers) + 1
+	w.lineNumbers[inc] = number
+	w.lines = append(w.lines, reportLine{message: message, number: number})
+}
+
+// and joins two incompatibilities into one clause, citing line numbers for
+// those already written out.
+func (w *failureWriter) and(first, second *incompatibility) string {
+	if both, ok := w.requiresBoth(first, second); ok {
+		return both
+	}
+
+	clause := w.format(first)
+	if line, ok := w.lineNumbers[first]; ok {
+		clause += fmt.Sprintf(" (%d)", line)
+	}
+	clause += " and " + w.format(second)
+	if line, ok := w.lineNumbers[second]; ok {
+		clause += fmt.Sprintf(" (%d)", line)
+	}
+	return clause
+}
+
+// requiresBoth shortens "foo requires a and foo requires b" to
+// "foo requires a and b" when two dependencies share their depender.
+func (w *failureWriter) requiresBoth(first, second *incompatibility) (string, bool) {
+	if first.kind != causeDependency || second.kind != causeDependency {
+		return "", false
+	}
+	if _, ok := w.lineNumbers[first]; ok {
+		return "", false
+	}
+	if _, ok := w.lineNumbers[second]; ok {
+		return "", false
+	}
+
+	a, b := first.terms[0], second.terms[0]
+	if a.name != b.name || !a.set.equal(b.set) {
+		return "", false
+	}
+
+	required := second.terms[1].inverse()
+	return w.format(first) + " and " + required.name + " " + required.describe(w.pool), true
+}
+
+func (w *failureWriter) visit(inc *incompatibility, conclusion bool) {
+	numbered := conclusion || w.derivations[inc] > 1
+	conjunction := "And"
+	if conclusion || inc == w.root {
+		conjunction = "So,"
+	}
+	statement := w.format(inc)
+
+	conflict, other := inc.conflict, inc.other
+	conflictDerived := conflict.kind == causeConflict
+	otherDerived := other.kind == causeConflict
+
+	switch {
+	case conflictDerived && otherDerived:
+		conflictLine, conflictNumbered := w.lineNumbers[conflict]
+		otherLine, otherNumbered := w.lineNumbers[other]
+
+		switch {
+		case conflictNumbered && otherNumbered:
+			w.emit(inc, fmt.Sprintf("Because %s, %s.", w.and(conflict, other), statement), numbered)
+
+		case conflictNumbered || otherNumbered:
+			withLine, withoutLine, line := conflict, other, conflictLine
+			if !conflictNumbered {
+				withLine, withoutLine, line = other, conflict, otherLine
+			}
+			w.visit(withoutLine, false)
+			w.emit(inc, fmt.Sprintf("%s because %s (%d), %s.", conjunction, w.format(withLine), line, statement), numbered)
+
+		default:
+			singleLineConflict := isSingleLine(conflict)
+			singleLineOther := isSingleLine(other)
+
+			if singleLineConflict || singleLineOther {
+				first, second := other, conflict
+				if singleLineOther {
+					first, second = conflict, other
+				}
+				w.visit(first, false)
+				w.visit(second, false)
+				w.emit(inc, fmt.Sprintf("Thus, %s.", statement), numbered)
+			} else {
+				w.visit(conflict, true)
+				w.lines = append(w.lines, reportLine{})
+				w.visit(other, false)
+				w.emit(inc, fmt.Sprintf("%s because %s (%d), %s.", conjunction, w.format(conflict), w.lineNumbers[conflict], statement), numbered)
+			}
+		}
+
+	case conflictDerived || otherDerived:
+		derived, external := conflict, other
+		if !conflictDerived {
+			derived, external = other, conflict
+		}
+
+		if line, ok := w.lineNumbers[derived]; ok {
+			w.emit(inc, fmt.Sprintf("Because %s and %s (%d), %s.", w.format(external), w.format(derived), line, statement), numbered)
+		} else if w.isCollapsible(derived) {
+			collapsedDerived, collapsedExternal := derived.conflict, derived.other
+			if collapsedDerived.kind != causeConflict {
+				collapsedDerived, collapsedExternal = derived.other, derived.conflict
+			}
+			w.visit(collapsedDerived, false)
+			w.emit(inc, fmt.Sprintf("%s because %s, %s.", conjunction, w.and(collapsedExternal, external), statement), numbered)
+		} else {
+			w.visit(derived, false)
+			w.emit(inc, fmt.Sprintf("%s because %s, %s.", conjunction, w.format(external), statement), numbered)
+		}
+
+	default:
+		w.emit(inc, fmt.Sprintf("Because %s, %s.", w.and(conflict, other), statement), numbered)
+	}
+}
+
+// isCollapsible reports whether a derived incompatibility can be folded into
+// the line that uses it instead of getting a line of its own.
+func (w *failureWriter) isCollapsible(inc *incompatibility) bool {
+	if w.derivations[inc] > 1 {
+		return false
+	}
+
+	conflictDerived := inc.conflict.kind == causeConflict
+	otherDerived := inc.other.kind == causeConflict
+	if conflictDerived == otherDerived {
+		return false
+	}
+
+	complex := inc.conflict
+	if !conflictDerived {
+		complex = inc.other
+	}
+	_, numbered := w.lineNumbers[complex]
+	return !numbered
+}
+
+func isSingleLine(inc *incompatibility) bool {
+	return inc.conflict.kind != causeConflict && inc.other.kind != causeConflict
+}
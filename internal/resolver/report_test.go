@@ -0,0 +1,70 @@
+package resolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+func TestSolveFailure_Explain(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    fakeRepository
+		require map[string]string
+		want    string
+	}{
+		{
+			name: "Conflicting shared dependency",
+			repo: fakeRepository{
+				"a/a": {"1.0.0": {"c/c": "^1.0"}},
+				"b/b": {"1.0.0": {"c/c": "^2.0"}},
+				"c/c": {"1.0.0": nil, "2.0.0": nil},
+			},
+			require: map[string]string{"a/a": "^1.0", "b/b": "^1.0"},
+			want: "Because a/a 1.0.0 requires c/c ^1.0 and b/b 1.0.0 requires c/c ^2.0, a/a 1.0.0 is incompatible with b/b 1.0.0.\n" +
+				"So, because my/app requires a/a ^1.0 and b/b ^1.0, version solving failed.\n",
+		},
+		{
+			name: "Every version of a dependency conflicts",
+			repo: fakeRepository{
+				"a/a": {"2.0.0": {"b/b": "^3.0"}, "2.1.0": {"b/b": "^3.0"}},
+				"b/b": {"2.0.0": nil, "3.0.0": nil},
+				"c/c": {"1.0.0": {"b/b": "^2.0"}},
+			},
+			require: map[string]string{"a/a": "^2.0", "c/c": "^1.0"},
+			want: "Because c/c 1.0.0 requires b/b ^2.0 and every version of a/a requires b/b ^3.0, c/c 1.0.0 is incompatible with every version of a/a.\n" +
+				"So, because my/app requires a/a ^2.0 and c/c ^1.0, version solving failed.\n",
+		},
+		{
+			name: "Unknown transitive package",
+			repo: fakeRepository{
+				"a/a": {"1.0.0": {"missing/pkg": "^1.0"}},
+			},
+			require: map[string]string{"a/a": "^1.0"},
+			want:    "Because a/a 1.0.0 requires missing/pkg ^1.0 which doesn't exist and my/app requires a/a ^1.0, version solving failed.\n",
+		},
+		{
+			name: "Root requirement matches nothing",
+			repo: fakeRepository{
+				"b/b": {"1.0.0": nil, "2.0.0": nil},
+			},
+			require: map[string]string{"b/b": "^3.0"},
+			want:    "Because my/app requires b/b ^3.0 which doesn't match any versions, version solving failed.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveWith(t, tt.repo, &parser.ComposerJSON{Name: "my/app", Require: tt.require})
+
+			var failure *SolveFailure
+			if !errors.As(err, &failure) {
+				t.Fatalf("Resolve() error = %v, want *SolveFailure", err)
+			}
+			if got := failure.Explain(); got != tt.want {
+				t.Errorf("Explain() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,63 +2,210 @@ package resolver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/aras/presto/internal/packagist"
 	"github.com/aras/presto/internal/parser"
+	"github.com/aras/presto/internal/platform"
 )
 
 type Resolver struct {
-	client   *packagist.Client
-	resolved map[string]string
-	visited  map[string]bool
+	client *packagist.Client
+	source metadataSource
+
+	// platform holds the installed platform packages; when nil, platform
+	// requirements are not checked at all.
+	platform       map[string]string
+	ignorePlatform []string
 }
 
 type Package struct {
-	Name     string
-	Version  string
-	URL      string
-	Require  map[string]string
-	Autoload json.RawMessage
-	IsDev    bool
+	Name    string
+	Version string
+	URL     string // empty when the package is installed from Source
+	Dist    packagist.DistInfo
+	Source  packagist.SourceInfo
+	// TransportOptions tune how the package is installed, e.g. "symlink"
+	// for packages from path repositories.
+	TransportOptions map[string]interface{}
+	Require          map[string]string
+	Provide          map[string]string
+	Replace          map[string]string
+	Autoload         json.RawMessage
+	IsDev            bool
 }
 
 func NewResolver(client *packagist.Client) *Resolver {
 	return &Resolver{
-		client:   client,
-		resolved: make(map[string]string),
-		visited:  make(map[string]bool),
+		client: client,
+		source: client,
 	}
 }
 
+// SetPlatform makes the resolver check platform requirements (php, ext-*,
+// lib-*) against the given installed versions instead of skipping them.
+// Requirements on names matching one of the ignore patterns are still skipped.
+func (r *Resolver) SetPlatform(packages map[string]string, ignore []string) {
+	r.platform = packages
+	r.ignorePlatform = ignore
+}
+
+// Resolve selects a version for every package required, directly or
+// transitively, by composer.json such that all constraints hold at once.
+// When that is impossible the returned error is a *SolveFailure.
 func (r *Resolver) Resolve(composer *parser.ComposerJSON) ([]*Package, error) {
-	var packages []*Package
+	selected, err := r.solve(composer, solveOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.buildPackages(composer, selected)
+}
 
+// WhyNot checks whether packageName can be installed at version alongside the
+// project's requirements. It returns nil if it can, or the failure explaining
+// why not.
+func (r *Resolver) WhyNot(composer *parser.ComposerJSON, packageName, version string) (*SolveFailure, error) {
+	_, err := r.solve(composer, solveOptions{extra: map[string]string{strings.ToLower(packageName): version}})
+	if err == nil {
+		return nil, nil
+	}
+
+	var failure *SolveFailure
+	if errors.As(err, &failure) {
+		return failure, nil
+	}
+	return nil, err
+}
+
+// solveOptions adjusts a single solve beyond what composer.json says.
+type solveOptions struct {
+	extra        map[string]string                 // requirements taking precedence over the root's
+	locked       map[string]*packagist.VersionInfo // packages held at their locked version
+	preferStable bool                              // on top of composer.json's prefer-stable
+	preferLowest bool
+}
+
+// solve runs the solver on composer.json's require and require-dev.
+func (r *Resolver) solve(composer *parser.ComposerJSON, opts solveOptions) (map[string]*poolVersion, error) {
+	require := make(map[string]string)
+	for name, constraint := range composer.RequireDev {
+		require[strings.ToLower(name)] = constraint
+	}
 	for name, constraint := range composer.Require {
-		if r.isPlatformPackage(name) {
+		require[strings.ToLower(name)] = constraint
+	}
+	for name, constraint := range opts.extra {
+		require[name] = constraint
+	}
+
+	aliases, err := InlineAliases(composer)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newPool(r.source)
+	p.rootLabel = rootLabel(composer)
+	p.stability = newStabilityRules(composer)
+	p.inlineAliases = aliases
+	p.locked = opts.locked
+	p.platform = r.platform
+	root := p.add(rootName, []*poolVersion{{
+		version:    "dev-main",
+		normalized: "dev-main",
+		require:    require,
+		conflict:   lowercaseKeys(composer.Conflict),
+		replace:    lowercaseKeys(composer.Replace),
+		provide:    lowercaseKeys(composer.Provide),
+	}})
+	p.collect(root, r.skipRequirement)
+
+	s := newSolver(p, root, r.skipRequirement)
+	s.preferStable = composer.PreferStable || opts.preferStable
+	s.preferLowest = opts.preferLowest
+	return s.solve()
+}
+
+// buildPackages turns the solver's selection into installable packages. A
+// package is a dev package when it is only reachable through require-dev.
+func (r *Resolver) buildPackages(composer *parser.ComposerJSON, selected map[string]*poolVersion) ([]*Package, error) {
+	nonDev := make(map[string]bool)
+	queue := make([]string, 0, len(composer.Require))
+	for name := range composer.Require {
+		queue = append(queue, strings.ToLower(name))
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		v, ok := selected[name]
+		if !ok || nonDev[name] {
 			continue
 		}
+		nonDev[name] = true
+		for dep := range v.require {
+			queue = append(queue, dep)
+		}
+	}
 
-		if err := r.resolveDependency(name, constraint, false, &packages); err != nil {
-			return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+	names := make([]string, 0, len(selected))
+	for name, v := range selected {
+		// Virtual candidates are satisfied by their provider, which is
+		// part of the selection itself, and platform packages are already
+		// installed.
+		if name != rootName && v.provider == nil && !r.isPlatformPackage(name) {
+			names = append(names, name)
 		}
 	}
+	sort.Strings(names)
 
-	for name, constraint := range composer.RequireDev {
-		if r.isPlatformPackage(name) {
+	var packages []*Package
+	for _, name := range names {
+		v := selected[name]
+
+		downloadURL, err := v.info.DownloadURL()
+		if err != nil {
+			if !strings.Contains(err.Error(), "no download URL found") {
+				return nil, err
+			}
+
+			// Metapackages have nothing to download; their requirements
+			// are already part of the selection.
 			continue
 		}
-
-		if err := r.resolveDependency(name, constraint, true, &packages); err != nil {
-			return nil, fmt.Errorf("failed to resolve dev dependency %s: %w", name, err)
+		if v.info.InstallsFromSource() {
+			downloadURL = ""
 		}
+
+		packages = append(packages, &Package{
+			Name:             v.info.Name,
+			Version:          v.version,
+			URL:              downloadURL,
+			Dist:             v.info.Dist,
+			Source:           v.info.Source,
+			TransportOptions: v.info.TransportOptions,
+			Require:          v.info.Require,
+			Provide:          v.info.Provide,
+			Replace:          v.info.Replace,
+			Autoload:         v.info.Autoload,
+			IsDev:            !nonDev[name],
+		})
 	}
 
 	return packages, nil
 }
 
+// rootLabel is how the project itself is referred to in explanations.
+func rootLabel(composer *parser.ComposerJSON) string {
+	if composer.Name != "" {
+		return composer.Name
+	}
+	return rootName
+}
+
 func (r *Resolver) ResolveFromLock(lock *parser.ComposerLock) ([]*Package, error) {
 	var packages []*Package
 
@@ -66,12 +213,17 @@ func (r *Resolver) ResolveFromLock(lock *parser.ComposerLock) ([]*Package, error
 		autoloadJSON, _ := json.Marshal(lp.Autoload)
 
 		pkg := &Package{
-			Name:     lp.Name,
-			Version:  lp.Version,
-			URL:      lp.Dist.URL,
-			Require:  lp.Require,
-			Autoload: autoloadJSON,
-			IsDev:    false,
+			Name:             lp.Name,
+			Version:          lp.Version,
+			URL:              lp.Dist.URL,
+			Dist:             lockedDist(lp),
+			Source:           lockedSource(lp),
+			TransportOptions: lp.TransportOptions,
+			Require:          lp.Require,
+			Provide:          lp.Provide,
+			Replace:          lp.Replace,
+			Autoload:         autoloadJSON,
+			IsDev:            false,
 		}
 		packages = append(packages, pkg)
 	}
@@ -80,12 +232,17 @@ func (r *Resolver) ResolveFromLock(lock *parser.ComposerLock) ([]*Package, error
 		autoloadJSON, _ := json.Marshal(lp.Autoload)
 
 		pkg := &Package{
-			Name:     lp.Name,
-			Version:  lp.Version,
-			URL:      lp.Dist.URL,
-			Require:  lp.Require,
-			Autoload: autoloadJSON,
-			IsDev:    true,
+			Name:             lp.Name,
+			Version:          lp.Version,
+			URL:              lp.Dist.URL,
+			Dist:             lockedDist(lp),
+			Source:           lockedSource(lp),
+			TransportOptions: lp.TransportOptions,
+			Require:          lp.Require,
+			Provide:          lp.Provide,
+			Replace:          lp.Replace,
+			Autoload:         autoloadJSON,
+			IsDev:            true,
 		}
 		packages = append(packages, pkg)
 	}
@@ -93,131 +250,36 @@ func (r *Resolver) ResolveFromLock(lock *parser.ComposerLock) ([]*Package, error
 	return packages, nil
 }
 
-func (r *Resolver) resolveDependency(name, constraint string, isDev bool, packages *[]*Package) error {
-	if r.visited[name] {
-		if resolvedVersion, ok := r.resolved[name]; ok {
-			c, err := semver.NewConstraint(r.normalizeConstraint(constraint))
-			if err == nil {
-				v, err := semver.NewVersion(r.normalizeVersion(resolvedVersion))
-				if err == nil {
-					if !c.Check(v) {
-						fmt.Printf("⚠️  CONFLICT FIX: Package %s v%s does not satisfy '%s'. Re-resolving with new constraint...\n", name, resolvedVersion, constraint)
-
-						for i, pkg := range *packages {
-							if pkg.Name == name {
-								*packages = append((*packages)[:i], (*packages)[i+1:]...)
-								break
-							}
-						}
-
-						r.visited[name] = false
-					} else {
-						return nil
-					}
-				}
-			}
-		} else {
-			return nil
-		}
-	}
-
-	if r.visited[name] {
-		return nil
-	}
-	r.visited[name] = true
-
-	info, err := r.client.GetPackage(name)
-	if err != nil {
-		return err
-	}
-
-	version, err := r.findMatchingVersion(info, constraint)
-	if err != nil {
-		return fmt.Errorf("no matching version for %s %s: %w", name, constraint, err)
-	}
-	versionInfo, err := r.client.GetVersion(name, version)
-	if err != nil {
-		return err
-	}
-
-	downloadURL, err := r.client.DownloadPackage(name, version)
-	if err != nil {
-		if !strings.Contains(err.Error(), "no download URL found") {
-			return err
-		}
-
-		downloadURL = ""
-	}
-
-	if downloadURL == "" {
-		r.resolved[name] = version
-
-		for depName, depConstraint := range versionInfo.Require {
-			if r.isPlatformPackage(depName) {
-				continue
-			}
-
-			if err := r.resolveDependency(depName, depConstraint, isDev, packages); err != nil {
-				return err
-			}
-		}
-
-		return nil
-	}
-
-	r.resolved[name] = version
-
-	for depName, depConstraint := range versionInfo.Require {
-		if r.isPlatformPackage(depName) {
-			continue
-		}
-
-		if err := r.resolveDependency(depName, depConstraint, isDev, packages); err != nil {
-			return err
-		}
-	}
-
-	pkg := &Package{
-		Name:     name,
-		Version:  version,
-		URL:      downloadURL,
-		Require:  versionInfo.Require,
-		Autoload: versionInfo.Autoload,
-		IsDev:    isDev,
-	}
-	*packages = append(*packages, pkg)
+func lockedDist(lp parser.LockedPackage) packagist.DistInfo {
+	return packagist.DistInfo{Type: lp.Dist.Type, URL: lp.Dist.URL, Reference: lp.Dist.Reference, Shasum: lp.Dist.Shasum, Integrity: lp.Dist.Integrity}
+}
 
-	return nil
+// lockedSource returns the repository a locked package is installed from when
+// it has no archive.
+func lockedSource(lp parser.LockedPackage) packagist.SourceInfo {
+	return packagist.SourceInfo{Type: lp.Source.Type, URL: lp.Source.URL, Reference: lp.Source.Reference}
 }
 
-func (r *Resolver) findMatchingVersion(info *packagist.PackageInfo, constraint string) (string, error) {
-	constraint = r.normalizeConstraint(constraint)
-	c, err := semver.NewConstraint(constraint)
+// findMatchingVersion returns the highest version of a package that matches
+// constraint and is stable enough under rules.
+func (r *Resolver) findMatchingVersion(info *packagist.PackageInfo, constraint string, rules stabilityRules) (string, error) {
+	c, err := parseConstraints(constraint)
 	if err != nil {
-		return r.findLatestStable(info), nil
+		return "", err
 	}
 
-	var bestVersion string
-	var bestSemver *semver.Version
-	var bestFourth int // tiebreaker for four-part versions
+	var bestVersion, bestNormalized string
 
 	for version := range info.Versions {
-		if strings.Contains(version, "dev") {
+		normalized, err := parseVersion(version)
+		if err != nil || !rules.accepts(strings.ToLower(info.Name), parseStability(normalized)) {
 			continue
 		}
 
-		normalized := r.normalizeVersion(version)
-		v, err := semver.NewVersion(normalized)
-		if err != nil {
-			continue
-		}
-		if c.Check(v) {
-			fourth := fourthSegment(version)
-			if bestSemver == nil || v.GreaterThan(bestSemver) ||
-				(v.Equal(bestSemver) && fourth > bestFourth) {
-				bestSemver = v
+		if c.matches(normalized) {
+			if bestVersion == "" || compareVersions(normalized, bestNormalized) > 0 {
 				bestVersion = version
-				bestFourth = fourth
+				bestNormalized = normalized
 			}
 		}
 	}
@@ -229,63 +291,6 @@ func (r *Resolver) findMatchingVersion(info *packagist.PackageInfo, constraint s
 	return "", fmt.Errorf("no version matches constraint: %s", constraint)
 }
 
-func (r *Resolver) findLatestStable(info *packagist.PackageInfo) string {
-	var latest string
-	var latestSemver *semver.Version
-	var latestFourth int
-
-	for version := range info.Versions {
-		if strings.Contains(version, "dev") {
-			continue
-		}
-
-		v, err := semver.NewVersion(r.normalizeVersion(version))
-		if err != nil {
-			continue
-		}
-		if v.Prerelease() != "" {
-			continue
-		}
-		fourth := fourthSegment(version)
-		if latestSemver == nil || v.GreaterThan(latestSemver) ||
-			(v.Equal(latestSemver) && fourth > latestFourth) {
-			latestSemver = v
-			latest = version
-			latestFourth = fourth
-		}
-	}
-
-	if latest == "" {
-		for version := range info.Versions {
-			return version
-		}
-	}
-
-	return latest
-}
-
-// fourthSegment extracts the numeric fourth version segment from a Composer
-// four-part version string (e.g. "v9.18.1.10" → 10). Returns 0 if absent.
-func fourthSegment(version string) int {
-	version = strings.TrimPrefix(version, "v")
-	parts := strings.SplitN(version, ".", 5)
-	if len(parts) != 4 {
-		return 0
-	}
-	// Only parse if purely numeric (no pre-release suffix)
-	if strings.ContainsAny(parts[3], "-+") {
-		return 0
-	}
-	n := 0
-	for _, ch := range parts[3] {
-		if ch < '0' || ch > '9' {
-			return 0
-		}
-		n = n*10 + int(ch-'0')
-	}
-	return n
-}
-
 func (r *Resolver) normalizeConstraint(constraint string) string {
 	constraint = strings.TrimSpace(constraint)
 
@@ -297,42 +302,18 @@ func (r *Resolver) normalizeConstraint(constraint string) string {
 	return constraint
 }
 
-func (r *Resolver) normalizeVersion(version string) string {
-	version = strings.TrimPrefix(version, "v")
-
-	version = strings.ReplaceAll(version, "-dev", "-alpha")
-
-	// Composer allows four-part versions like 9.18.1.10 (MAJOR.MINOR.PATCH.BUILD).
-	// The Masterminds semver library only understands three parts, so we strip the
-	// fourth segment before parsing. Constraints are written against the first three
-	// parts (e.g. ^9.18), so this is safe and matches Composer's own behaviour.
-	if parts := strings.SplitN(version, ".", 5); len(parts) == 4 {
-		// Only truncate when the fourth part is purely numeric (no pre-release suffix).
-		// If there's a pre-release tag it will be attached to the third segment already.
-		if !strings.ContainsAny(parts[3], "-+") {
-			version = strings.Join(parts[:3], ".")
-		}
-	}
-
-	return version
-}
-
 func (r *Resolver) isPlatformPackage(name string) bool {
-	if name == "composer-plugin-api" || name == "composer-runtime-api" {
-		return true
-	}
+	return platform.IsPlatformPackage(name)
+}
 
-	if strings.Contains(name, "/") {
-		if strings.HasSuffix(name, "-implementation") {
-			return true
-		}
+// skipRequirement reports whether a requirement on name is left out of
+// resolution: platform requirements are when no platform is set or when
+// they are ignored.
+func (r *Resolver) skipRequirement(name string) bool {
+	if !r.isPlatformPackage(name) {
 		return false
 	}
-
-	return name == "php" ||
-		strings.HasPrefix(name, "php-") || // php-64bit, etc.
-		strings.HasPrefix(name, "ext-") ||
-		strings.HasPrefix(name, "lib-")
+	return r.platform == nil || platform.Ignored(r.ignorePlatform, name)
 }
 
 func (r *Resolver) BuildDependencyTree(composer *parser.ComposerJSON, targetPackage string) (string, error) {
@@ -365,7 +346,12 @@ func (r *Resolver) searchInDependencies(composer *parser.ComposerJSON, target st
 			continue
 		}
 
-		versionInfo, err := r.client.GetVersion(pkg, r.findLatestStable(info))
+		matched, err := r.findMatchingVersion(info, version, newStabilityRules(composer))
+		if err != nil {
+			continue
+		}
+
+		versionInfo, err := r.client.GetVersion(pkg, matched)
 		if err != nil {
 			continue
 		}
@@ -384,40 +370,3 @@ func (r *Resolver) searchInDependencies(composer *parser.ComposerJSON, target st
 
 	return false
 }
-
-func (r *Resolver) CheckConflicts(composer *parser.ComposerJSON, packageName, version string) ([]string, error) {
-	var conflicts []string
-
-	versionInfo, err := r.client.GetVersion(packageName, version)
-	if err != nil {
-		return nil, err
-	}
-
-	if phpVersion, ok := versionInfo.Require["php"]; ok {
-		conflicts = append(conflicts, fmt.Sprintf("Requires PHP %s (check your version)", phpVersion))
-	}
-
-	for req := range versionInfo.Require {
-		if strings.HasPrefix(req, "ext-") {
-			conflicts = append(conflicts, fmt.Sprintf("Requires PHP extension: %s", req))
-		}
-	}
-
-	for existingPkg, existingVersion := range composer.Require {
-		if r.isPlatformPackage(existingPkg) {
-			continue
-		}
-
-		if requiredVersion, ok := versionInfo.Require[existingPkg]; ok {
-			if !r.versionsCompatible(existingVersion, requiredVersion) {
-				conflicts = append(conflicts, fmt.Sprintf("%s requires %s %s (you have %s)", packageName, existingPkg, requiredVersion, existingVersion))
-			}
-		}
-	}
-
-	return conflicts, nil
-}
-
-func (r *Resolver) versionsCompatible(v1, v2 string) bool {
-	return true
-}
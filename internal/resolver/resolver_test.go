@@ -1,9 +1,14 @@
 package resolver
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aras/presto/internal/packagist"
+	"github.com/aras/presto/internal/parser"
 )
 
 func TestNormalizeConstraint(t *testing.T) {
@@ -46,41 +51,36 @@ func TestNormalizeConstraint(t *testing.T) {
 	}
 }
 
-func TestNormalizeVersion(t *testing.T) {
+func TestIsPlatformPackage(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    string
-		expected string
+		expected bool
 	}{
 		{
-			name:     "Version with v prefix",
-			input:    "v1.2.3",
-			expected: "1.2.3",
-		},
-		{
-			name:     "Dev version",
-			input:    "1.0.0-dev",
-			expected: "1.0.0-alpha",
+			name:     "PHP package",
+			input:    "php",
+			expected: true,
 		},
 		{
-			name:     "Normal version",
-			input:    "2.3.4",
-			expected: "2.3.4",
+			name:     "Extension",
+			input:    "ext-json",
+			expected: true,
 		},
 		{
-			name:     "Four-part version (scrivo/highlight.php style)",
-			input:    "v9.18.1.10",
-			expected: "9.18.1",
+			name:     "Library",
+			input:    "lib-curl",
+			expected: true,
 		},
 		{
-			name:     "Four-part version without v prefix",
-			input:    "9.18.1.10",
-			expected: "9.18.1",
+			name:     "Regular package",
+			input:    "symfony/console",
+			expected: false,
 		},
 		{
-			name:     "Four-part version with pre-release on fourth segment is left alone",
-			input:    "1.2.3.0-beta",
-			expected: "1.2.3.0-beta",
+			name:     "Virtual package",
+			input:    "psr/log-implementation",
+			expected: false,
 		},
 	}
 
@@ -88,58 +88,412 @@ func TestNormalizeVersion(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := r.normalizeVersion(tt.input)
+			result := r.isPlatformPackage(tt.input)
 			if result != tt.expected {
-				t.Errorf("normalizeVersion(%q) = %q, want %q", tt.input, result, tt.expected)
+				t.Errorf("isPlatformPackage(%q) = %v, want %v", tt.input, result, tt.expected)
 			}
 		})
 	}
 }
 
-func TestIsPlatformPackage(t *testing.T) {
+// fakeRepository is an in-memory package source: name -> version -> links.
+// Links are requirements unless prefixed with "conflict:", "replace:" or
+// "provide:"; "branch-alias:" entries go to extra.branch-alias.
+type fakeRepository map[string]map[string]map[string]string
+
+func (f fakeRepository) GetPackage(name string) (*packagist.PackageInfo, error) {
+	versions, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("package not found: %s (status: 404)", name)
+	}
+
+	info := &packagist.PackageInfo{Name: name, Versions: map[string]*packagist.VersionInfo{}}
+	for version, links := range versions {
+		vi := &packagist.VersionInfo{
+			Name:     name,
+			Version:  version,
+			Require:  map[string]string{},
+			Conflict: map[string]string{},
+			Replace:  map[string]string{},
+			Provide:  map[string]string{},
+			Dist:     packagist.DistInfo{Type: "zip", URL: "https://example.com/" + name + "/" + version + ".zip"},
+		}
+		for target, constraint := range links {
+			kind, linked, ok := strings.Cut(target, ":")
+			if !ok {
+				vi.Require[target] = constraint
+				continue
+			}
+			if kind == "branch-alias" {
+				vi.Extra = map[string]interface{}{"branch-alias": map[string]interface{}{linked: constraint}}
+				continue
+			}
+			map[string]map[string]string{"conflict": vi.Conflict, "replace": vi.Replace, "provide": vi.Provide}[kind][linked] = constraint
+		}
+		info.Versions[version] = vi
+	}
+	return info, nil
+}
+
+func resolveWith(t *testing.T, repo fakeRepository, composer *parser.ComposerJSON) (map[string]*Package, error) {
+	t.Helper()
+
+	r := &Resolver{source: repo}
+	packages, err := r.Resolve(composer)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Package)
+	for _, pkg := range packages {
+		byName[pkg.Name] = pkg
+	}
+	return byName, nil
+}
+
+func TestResolve(t *testing.T) {
 	tests := []struct {
-		name     string
-		input    string
-		expected bool
+		name    string
+		repo    fakeRepository
+		require map[string]string
+		want    map[string]string
 	}{
 		{
-			name:     "PHP package",
-			input:    "php",
-			expected: true,
+			name: "Picks highest matching version",
+			repo: fakeRepository{
+				"a/a": {"1.0.0": nil, "1.1.0": nil, "2.0.0": nil},
+			},
+			require: map[string]string{"a/a": "^1.0"},
+			want:    map[string]string{"a/a": "1.1.0"},
 		},
 		{
-			name:     "Extension",
-			input:    "ext-json",
-			expected: true,
+			name: "Considers every constraint on a shared dependency",
+			repo: fakeRepository{
+				"a/a": {
+					"1.0.0": {"c/c": "^1.0"},
+					"2.0.0": {"c/c": "^2.0"},
+				},
+				"b/b": {"1.0.0": {"c/c": "^1.0"}},
+				"c/c": {"1.0.0": nil, "1.5.0": nil, "2.0.0": nil},
+			},
+			require: map[string]string{"a/a": "*", "b/b": "*"},
+			want:    map[string]string{"a/a": "1.0.0", "b/b": "1.0.0", "c/c": "1.5.0"},
 		},
 		{
-			name:     "Library",
-			input:    "lib-curl",
-			expected: true,
+			name: "Backtracks out of a conflicting transitive dependency",
+			repo: fakeRepository{
+				"foo/foo": {
+					"1.0.0": nil,
+					"1.1.0": {"bar/bar": "^2.0"},
+				},
+				"bar/bar": {"2.0.0": {"baz/baz": "^2.0"}},
+				"baz/baz": {"1.0.0": nil, "2.0.0": nil},
+			},
+			require: map[string]string{"foo/foo": "^1.0", "baz/baz": "^1.0"},
+			want:    map[string]string{"foo/foo": "1.0.0", "baz/baz": "1.0.0"},
 		},
 		{
-			name:     "Regular package",
-			input:    "symfony/console",
-			expected: false,
+			name: "Skips platform requirements",
+			repo: fakeRepository{
+				"a/a": {"1.0.0": {"php": ">=8.1", "ext-json": "*"}},
+			},
+			require: map[string]string{"php": "^8.1", "a/a": "^1.0"},
+			want:    map[string]string{"a/a": "1.0.0"},
 		},
 	}
 
-	r := NewResolver(packagist.NewClient())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveWith(t, tt.repo, &parser.ComposerJSON{Require: tt.require})
+			if err != nil {
+				t.Fatalf("Resolve() returned error: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("Resolve() selected %d packages, want %d", len(got), len(tt.want))
+			}
+			for name, version := range tt.want {
+				pkg, ok := got[name]
+				if !ok {
+					t.Errorf("Resolve() did not select %s", name)
+					continue
+				}
+				if pkg.Version != version {
+					t.Errorf("Resolve() selected %s %s, want %s", name, pkg.Version, version)
+				}
+			}
+		})
+	}
+}
+
+func TestResolve_Unsatisfiable(t *testing.T) {
+	repo := fakeRepository{
+		"a/a": {"1.0.0": {"c/c": "^1.0"}},
+		"b/b": {"1.0.0": {"c/c": "^2.0"}},
+		"c/c": {"1.0.0": nil, "2.0.0": nil},
+	}
+
+	_, err := resolveWith(t, repo, &parser.ComposerJSON{
+		Require: map[string]string{"a/a": "^1.0", "b/b": "^1.0"},
+	})
+
+	var failure *SolveFailure
+	if !errors.As(err, &failure) {
+		t.Fatalf("Resolve() error = %v, want *SolveFailure", err)
+	}
+}
+
+func TestResolve_UnknownPackage(t *testing.T) {
+	_, err := resolveWith(t, fakeRepository{}, &parser.ComposerJSON{
+		Require: map[string]string{"missing/package": "^1.0"},
+	})
+
+	var failure *SolveFailure
+	if !errors.As(err, &failure) {
+		t.Fatalf("Resolve() error = %v, want *SolveFailure", err)
+	}
+}
+
+func TestResolve_DevPackages(t *testing.T) {
+	repo := fakeRepository{
+		"app/lib":     {"1.0.0": {"shared/util": "^1.0"}},
+		"dev/tool":    {"1.0.0": {"shared/util": "^1.0", "dev/helper": "^1.0"}},
+		"shared/util": {"1.0.0": nil},
+		"dev/helper":  {"1.0.0": nil},
+	}
+
+	got, err := resolveWith(t, repo, &parser.ComposerJSON{
+		Require:    map[string]string{"app/lib": "^1.0"},
+		RequireDev: map[string]string{"dev/tool": "^1.0"},
+	})
+	if err != nil {
+		t.Fatalf("Resolve() returned error: %v", err)
+	}
+
+	wantDev := map[string]bool{
+		"app/lib":     false,
+		"shared/util": false,
+		"dev/tool":    true,
+		"dev/helper":  true,
+	}
+	for name, isDev := range wantDev {
+		if got[name] == nil {
+			t.Fatalf("Resolve() did not select %s", name)
+		}
+		if got[name].IsDev != isDev {
+			t.Errorf("%s IsDev = %v, want %v", name, got[name].IsDev, isDev)
+		}
+	}
+}
+
+func TestResolve_Links(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     fakeRepository
+		composer *parser.ComposerJSON
+		want     map[string]string
+	}{
+		{
+			name: "Replaced package is not installed next to its replacer",
+			repo: fakeRepository{
+				"symfony/symfony": {"v5.0.0": {"replace:symfony/console": "self.version"}},
+				"symfony/console": {"v5.0.0": nil},
+				"x/lib":           {"1.0.0": {"symfony/console": "^5.0"}},
+			},
+			composer: &parser.ComposerJSON{Require: map[string]string{"symfony/symfony": "^5.0", "x/lib": "^1.0"}},
+			want:     map[string]string{"symfony/symfony": "v5.0.0", "x/lib": "1.0.0"},
+		},
+		{
+			name: "Virtual package is satisfied by a provider",
+			repo: fakeRepository{
+				"monolog/monolog": {"2.0.0": {"provide:psr/log-implementation": "1.0.0"}},
+				"x/logger-user":   {"1.0.0": {"psr/log-implementation": "^1.0"}},
+			},
+			composer: &parser.ComposerJSON{Require: map[string]string{"monolog/monolog": "^2.0", "x/logger-user": "^1.0"}},
+			want:     map[string]string{"monolog/monolog": "2.0.0", "x/logger-user": "1.0.0"},
+		},
+		{
+			name: "Conflicting version is avoided",
+			repo: fakeRepository{
+				"a/a": {"1.0.0": nil, "1.1.0": {"conflict:b/b": "^2.0"}},
+				"b/b": {"2.0.0": nil},
+			},
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "^1.0", "b/b": "^2.0"}},
+			want:     map[string]string{"a/a": "1.0.0", "b/b": "2.0.0"},
+		},
+		{
+			name: "Root replace keeps a polyfill out",
+			repo: fakeRepository{
+				"symfony/polyfill-php72": {"v1.20.0": nil},
+				"x/lib":                  {"1.0.0": {"symfony/polyfill-php72": "^1.17"}},
+			},
+			composer: &parser.ComposerJSON{
+				Require: map[string]string{"x/lib": "^1.0"},
+				Replace: map[string]string{"symfony/polyfill-php72": "*"},
+			},
+			want: map[string]string{"x/lib": "1.0.0"},
+		},
+	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := r.isPlatformPackage(tt.input)
-			if result != tt.expected {
-				t.Errorf("isPlatformPackage(%q) = %v, want %v", tt.input, result, tt.expected)
+			got, err := resolveWith(t, tt.repo, tt.composer)
+			if err != nil {
+				t.Fatalf("Resolve() returned error: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("Resolve() selected %d packages, want %d", len(got), len(tt.want))
+			}
+			for name, version := range tt.want {
+				if pkg, ok := got[name]; !ok || pkg.Version != version {
+					t.Errorf("Resolve() selected %s %v, want %s", name, pkg, version)
+				}
 			}
 		})
 	}
 }
 
-func TestResolve(t *testing.T) {
-	// This would require mocking the Packagist client
-	// For now, we'll skip this test
-	t.Skip("Requires Packagist client mocking")
+func TestResolve_ConflictUnsatisfiable(t *testing.T) {
+	repo := fakeRepository{
+		"a/a":             {"1.0.0": {"conflict:b/b": "<3.0"}},
+		"b/b":             {"2.0.0": nil},
+		"monolog/monolog": {"2.0.0": {"provide:psr/log-implementation": "1.0.0"}},
+		"x/logger-user":   {"1.0.0": {"psr/log-implementation": "^3.0"}},
+	}
+
+	tests := []struct {
+		require map[string]string
+		want    string
+	}{
+		{
+			require: map[string]string{"a/a": "^1.0", "b/b": "^2.0"},
+			want: "Because a/a 1.0.0 conflicts with b/b <3.0 and my/app requires a/a ^1.0, b/b <3.0 is forbidden.\n" +
+				"So, because my/app requires b/b ^2.0, version solving failed.\n",
+		},
+		{
+			require: map[string]string{"monolog/monolog": "^2.0", "x/logger-user": "^1.0"},
+			want:    "Because x/logger-user 1.0.0 requires psr/log-implementation ^3.0 which doesn't match any versions and my/app requires x/logger-user ^1.0, version solving failed.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := resolveWith(t, repo, &parser.ComposerJSON{Name: "my/app", Require: tt.require})
+
+		var failure *SolveFailure
+		if !errors.As(err, &failure) {
+			t.Fatalf("Resolve() error = %v, want *SolveFailure", err)
+		}
+		if got := failure.Explain(); got != tt.want {
+			t.Errorf("Explain() =\n%s\nwant:\n%s", got, tt.want)
+		}
+	}
+}
+
+func TestWhyNot(t *testing.T) {
+	repo := fakeRepository{
+		"a/a": {"1.0.0": {"c/c": "^1.0"}},
+		"c/c": {"1.0.0": nil, "2.0.0": nil},
+	}
+	r := &Resolver{source: repo}
+	composer := &parser.ComposerJSON{Name: "my/app", Require: map[string]string{"a/a": "^1.0"}}
+
+	failure, err := r.WhyNot(composer, "c/c", "1.0.0")
+	if err != nil || failure != nil {
+		t.Fatalf("WhyNot(c/c, 1.0.0) = %v, %v, want nil, nil", failure, err)
+	}
+
+	failure, err = r.WhyNot(composer, "c/c", "2.0.0")
+	if err != nil {
+		t.Fatalf("WhyNot(c/c, 2.0.0) returned error: %v", err)
+	}
+	if failure == nil {
+		t.Fatal("WhyNot(c/c, 2.0.0) = nil, want a failure")
+	}
+
+	want := "Because a/a 1.0.0 requires c/c ^1.0 and my/app requires a/a ^1.0, c/c ^1.0 is required.\n" +
+		"So, because my/app requires c/c 2.0.0, version solving failed.\n"
+	if got := failure.Explain(); got != want {
+		t.Errorf("Explain() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestResolve_Platform(t *testing.T) {
+	repo := fakeRepository{
+		"a/a": {
+			"1.0.0": {"php": ">=8.0"},
+			"2.0.0": {"php": ">=8.3"},
+		},
+		"b/b":                       {"1.0.0": {"ext-redis": "*"}},
+		"c/c":                       {"1.0.0": {"ext-mbstring": "*"}},
+		"symfony/polyfill-mbstring": {"v1.28.0": {"provide:ext-mbstring": "*"}},
+	}
+	installed := map[string]string{"php": "8.1.2", "ext-json": "8.1.2"}
+
+	tests := []struct {
+		name    string
+		require map[string]string
+		ignore  []string
+		want    map[string]string
+		explain string
+	}{
+		{
+			name:    "Picks the newest version the PHP version allows",
+			require: map[string]string{"a/a": "*"},
+			want:    map[string]string{"a/a": "1.0.0"},
+		},
+		{
+			name:    "Ignored platform requirement",
+			require: map[string]string{"a/a": "^2.0"},
+			ignore:  []string{"php"},
+			want:    map[string]string{"a/a": "2.0.0"},
+		},
+		{
+			name:    "Provided extension",
+			require: map[string]string{"c/c": "*", "symfony/polyfill-mbstring": "*"},
+			want:    map[string]string{"c/c": "1.0.0", "symfony/polyfill-mbstring": "v1.28.0"},
+		},
+		{
+			name:    "PHP version too low",
+			require: map[string]string{"a/a": "^2.0"},
+			explain: "Because a/a 2.0.0 requires php >=8.3 but your php version (8.1.2) does not satisfy that requirement and my/app requires a/a ^2.0, version solving failed.\n",
+		},
+		{
+			name:    "Missing extension",
+			require: map[string]string{"b/b": "^1.0"},
+			explain: "Because b/b 1.0.0 requires ext-redis * but it is missing from your system and my/app requires b/b ^1.0, version solving failed.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{source: repo}
+			r.SetPlatform(installed, tt.ignore)
+			packages, err := r.Resolve(&parser.ComposerJSON{Name: "my/app", Require: tt.require})
+
+			if tt.explain != "" {
+				var failure *SolveFailure
+				if !errors.As(err, &failure) {
+					t.Fatalf("Resolve() error = %v, want *SolveFailure", err)
+				}
+				if got := failure.Explain(); got != tt.explain {
+					t.Errorf("Explain() =\n%s\nwant:\n%s", got, tt.explain)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Resolve() returned error: %v", err)
+			}
+			got := make(map[string]string)
+			for _, pkg := range packages {
+				got[pkg.Name] = pkg.Version
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
 
 // TestFindMatchingVersion_FourPartVersions verifies that four-part Composer
@@ -170,7 +524,7 @@ func TestFindMatchingVersion_FourPartVersions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.constraint, func(t *testing.T) {
-			got, err := r.findMatchingVersion(info, tt.constraint)
+			got, err := r.findMatchingVersion(info, tt.constraint, stabilityRules{})
 			if err != nil {
 				t.Fatalf("findMatchingVersion(%q) returned error: %v", tt.constraint, err)
 			}
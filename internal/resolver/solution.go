@@ -0,0 +1,120 @@
+package resolver
+
+// assignment is one entry of the partial solution: either a decision (cause is
+// nil) or a term derived from an incompatibility by unit propagation.
+type assignment struct {
+	term
+	level int
+	index int
+	cause *incompatibility
+}
+
+func (a *assignment) isDecision() bool {
+	return a.cause == nil
+}
+
+// partialSolution is the ordered list of assignments made so far, together
+// with the accumulated term for every package it mentions.
+type partialSolution struct {
+	assignments []*assignment
+	decisions   map[string]int
+	terms       map[string]versionSet
+}
+
+func newPartialSolution() *partialSolution {
+	return &partialSolution{
+		decisions: make(map[string]int),
+		terms:     make(map[string]versionSet),
+	}
+}
+
+// level is the current decision level: the number of decisions made.
+func (s *partialSolution) level() int {
+	return len(s.decisions)
+}
+
+// decide selects version index of package name.
+func (s *partialSolution) decide(name string, index, n int) {
+	s.decisions[name] = index
+	s.assign(term{name: name, set: newVersionSet(n).with(index)}, nil)
+}
+
+// derive records a term implied by cause.
+func (s *partialSolution) derive(t term, cause *incompatibility) {
+	s.assign(t, cause)
+}
+
+func (s *partialSolution) assign(t term, cause *incompatibility) {
+	s.assignments = append(s.assignments, &assignment{
+		term:  t,
+		level: s.level(),
+		index: len(s.assignments),
+		cause: cause,
+	})
+
+	if current, ok := s.terms[t.name]; ok {
+		s.terms[t.name] = current.intersect(t.set)
+	} else {
+		s.terms[t.name] = t.set.clone()
+	}
+}
+
+// backtrack removes every assignment made after decision level.
+func (s *partialSolution) backtrack(level int) {
+	kept := s.assignments[:0]
+	for _, a := range s.assignments {
+		if a.level <= level {
+			kept = append(kept, a)
+			continue
+		}
+		if a.isDecision() {
+			delete(s.decisions, a.name)
+		}
+	}
+	s.assignments = kept
+
+	s.terms = make(map[string]versionSet)
+	for _, a := range s.assignments {
+		if current, ok := s.terms[a.name]; ok {
+			s.terms[a.name] = current.intersect(a.set)
+		} else {
+			s.terms[a.name] = a.set.clone()
+		}
+	}
+}
+
+// accumulated returns what the partial solution knows about a package; with
+// no assignments anything is still possible.
+func (s *partialSolution) accumulated(t term) versionSet {
+	if set, ok := s.terms[t.name]; ok {
+		return set
+	}
+	return anyVersionSet(t.set.n)
+}
+
+// satisfies reports whether the partial solution implies t.
+func (s *partialSolution) satisfies(t term) bool {
+	return s.accumulated(t).subsetOf(t.set)
+}
+
+// contradicts reports whether the partial solution rules t out.
+func (s *partialSolution) contradicts(t term) bool {
+	return s.accumulated(t).intersect(t.set).isEmpty()
+}
+
+// satisfier returns the earliest assignment after which the partial solution
+// satisfies t.
+func (s *partialSolution) satisfier(t term) *assignment {
+	acc := anyVersionSet(t.set.n)
+	for _, a := range s.assignments {
+		if a.name != t.name {
+			continue
+		}
+		acc = acc.intersect(a.set)
+		if acc.subsetOf(t.set) {
+			return a
+		}
+	}
+
+	panic("resolver: no satisfier for term " + t.name)
+}
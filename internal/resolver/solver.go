@@ -0,0 +1,441 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// rootName identifies the project's own composer.json inside the solver. It
+// can't clash with a real package because package names always contain "/".
+const rootName = "__root__"
+
+// SolveFailure is returned when the requirements can't be satisfied. It
+// carries the incompatibility that proves it; Explain walks its derivation.
+type SolveFailure struct {
+	incompatibility *incompatibility
+	pool            *pool
+	rootLabel       string
+}
+
+func (e *SolveFailure) Error() string {
+	return strings.TrimSpace(e.Explain())
+}
+
+// solver implements the PubGrub algorithm (https://nex3.medium.com/pubgrub-2fb6470504f)
+// over a pool of candidate versions. Unlike greedy resolution it considers
+// every constraint on a package at once, learns from conflicts and
+// backtracks, so it either finds a globally consistent selection or proves
+// that none exists.
+type solver struct {
+	pool     *pool
+	root     *poolPackage
+	skip     func(name string) bool
+	solution *partialSolution
+
+	// preferStable tries the most stable allowed version first instead of
+	// the highest one.
+	preferStable bool
+	// preferLowest tries the lowest allowed version first.
+	preferLowest bool
+
+	incompatibilities map[string][]*incompatibility
+	addedDependencies map[string]bool
+}
+
+func newSolver(p *pool, root *poolPackage, skip func(string) bool) *solver {
+	return &solver{
+		pool:              p,
+		root:              root,
+		skip:              skip,
+		solution:          newPartialSolution(),
+		incompatibilities: make(map[string][]*incompatibility),
+		addedDependencies: make(map[string]bool),
+	}
+}
+
+// solve returns the selected candidate for every package in the solution,
+// including the root package.
+func (s *solver) solve() (map[string]*poolVersion, error) {
+	rootTerm := term{name: rootName, set: newVersionSet(1).with(0)}
+	s.addIncompatibility(&incompatibility{terms: []term{rootTerm.inverse()}, kind: causeRoot})
+
+	next := rootName
+	for next != "" {
+		if err := s.propagate(next); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if next, err = s.choosePackageVersion(); err != nil {
+			return nil, err
+		}
+	}
+
+	selected := make(map[string]*poolVersion, len(s.solution.decisions))
+	for name, index := range s.solution.decisions {
+		selected[name] = s.pool.packages[name].versions[index]
+	}
+	return selected, nil
+}
+
+func (s *solver) addIncompatibility(inc *incompatibility) {
+	for _, t := range inc.terms {
+		s.incompatibilities[t.name] = append(s.incompatibilities[t.name], inc)
+	}
+}
+
+// propagate performs unit propagation starting from the given package,
+// deriving every term the incompatibilities force.
+func (s *solver) propagate(name string) error {
+	changed := []string{name}
+	pending := map[string]bool{name: true}
+
+	for len(changed) > 0 {
+		pkg := changed[0]
+		changed = changed[1:]
+		delete(pending, pkg)
+
+		incompatibilities := s.incompatibilities[pkg]
+		for i := len(incompatibilities) - 1; i >= 0; i-- {
+			derived, conflict := s.propagateIncompatibility(incompatibilities[i])
+			if conflict {
+				rootCause, err := s.resolveConflict(incompatibilities[i])
+				if err != nil {
+					return err
+				}
+
+				derived, conflict = s.propagateIncompatibility(rootCause)
+				if conflict || derived == "" {
+					return fmt.Errorf("resolver: learned incompatibility did not propagate")
+				}
+				changed = []string{derived}
+				pending = map[string]bool{derived: true}
+				break
+			}
+
+			if derived != "" && !pending[derived] {
+				changed = append(changed, derived)
+				pending[derived] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// propagateIncompatibility derives the inverse of the single term of inc not
+// yet satisfied, if every other term is. It returns the name of the package a
+// term was derived for, or conflict if inc is fully satisfied.
+func (s *solver) propagateIncompatibility(inc *incompatibility) (derived string, conflict bool) {
+	var unsatisfied *term
+	for i := range inc.terms {
+		t := &inc.terms[i]
+		if s.solution.contradicts(*t) {
+			return "", false
+		}
+		if s.solution.satisfies(*t) {
+			continue
+		}
+		if unsatisfied != nil {
+			return "", false
+		}
+		unsatisfied = t
+	}
+
+	if unsatisfied == nil {
+		return "", true
+	}
+
+	s.solution.derive(unsatisfied.inverse(), inc)
+	return unsatisfied.name, false
+}
+
+// resolveConflict learns a new incompatibility from a satisfied one and
+// backjumps to the point where it first becomes unit, or reports failure when
+// the conflict can be traced back to the root package.
+func (s *solver) resolveConflict(inc *incompatibility) (*incompatibility, error) {
+	createdNew := false
+
+	for !inc.isFailure(rootName) {
+		var mostRecentTerm *term
+		var mostRecentSatisfier *assignment
+		var difference *term
+		previousSatisfierLevel := 1
+
+		for i := range inc.terms {
+			t := &inc.terms[i]
+			satisfier := s.solution.satisfier(*t)
+
+			if mostRecentSatisfier == nil || mostRecentSatisfier.index < satisfier.index {
+				if mostRecentSatisfier != nil {
+					previousSatisfierLevel = max(previousSatisfierLevel, mostRecentSatisfier.level)
+				}
+				mostRecentTerm = t
+				mostRecentSatisfier = satisfier
+				difference = nil
+			} else {
+				previousSatisfierLevel = max(previousSatisfierLevel, satisfier.level)
+			}
+
+			if mostRecentTerm == t {
+				// The satisfier may say more than the term needs; whatever
+				// it adds must have been satisfied by an earlier assignment.
+				if rest := mostRecentSatisfier.set.minus(t.set); !rest.isEmpty() {
+					difference = &term{name: t.name, set: rest}
+					previousSatisfierLevel = max(previousSatisfierLevel, s.solution.satisfier(difference.inverse()).level)
+				}
+			}
+		}
+
+		if previousSatisfierLevel < mostRecentSatisfier.level || mostRecentSatisfier.isDecision() {
+			s.solution.backtrack(previousSatisfierLevel)
+			if createdNew {
+				s.addIncompatibility(inc)
+			}
+			return inc, nil
+		}
+
+		var terms []term
+		for i := range inc.terms {
+			if &inc.terms[i] != mostRecentTerm {
+				terms = append(terms, inc.terms[i])
+			}
+		}
+		for _, t := range mostRecentSatisfier.cause.terms {
+			if t.name != mostRecentSatisfier.name {
+				terms = append(terms, t)
+			}
+		}
+		if difference != nil {
+			terms = append(terms, difference.inverse())
+		}
+
+		derived := newIncompatibility(terms, causeConflict, rootName)
+		derived.conflict = inc
+		derived.other = mostRecentSatisfier.cause
+		inc = derived
+		createdNew = true
+	}
+
+	return nil, &SolveFailure{incompatibility: inc, pool: s.pool, rootLabel: s.pool.rootLabel}
+}
+
+// choosePackageVersion decides on a version for the undecided package with
+// the fewest remaining candidates. It returns "" once every required package
+// has been decided.
+func (s *solver) choosePackageVersion() (string, error) {
+	var names []string
+	for name, set := range s.solution.terms {
+		if _, decided := s.solution.decisions[name]; decided || set.includesNone() {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+
+	name := names[0]
+	for _, candidate := range names[1:] {
+		if s.solution.terms[candidate].count() < s.solution.terms[name].count() {
+			name = candidate
+		}
+	}
+
+	pkg := s.pool.packages[name]
+	allowed := s.solution.terms[name].versions()
+	if len(allowed) == 0 {
+		return "", fmt.Errorf("resolver: no candidates left for %s", name)
+	}
+	index := s.preferredVersion(pkg, allowed)
+
+	conflict := false
+	for _, inc := range s.dependencyIncompatibilities(pkg, index) {
+		s.addIncompatibility(inc)
+
+		// If the new incompatibility is already violated, don't decide on
+		// this version; propagation will rule it out.
+		violated := true
+		for _, t := range inc.terms {
+			if t.name != name && !s.solution.satisfies(t) {
+				violated = false
+				break
+			}
+		}
+		conflict = conflict || violated
+	}
+
+	if !conflict {
+		s.solution.decide(name, index, len(pkg.versions))
+	}
+
+	return name, nil
+}
+
+// preferredVersion picks which of the allowed candidates to try: the highest
+// version or, with prefer-lowest, the lowest. With prefer-stable, it is the
+// highest or lowest of the most stable ones.
+func (s *solver) preferredVersion(pkg *poolPackage, allowed []int) int {
+	order := make([]int, 0, len(allowed))
+	if s.preferLowest {
+		// Providers come first in the candidate list, but the package's own
+		// versions should still be tried before them.
+		own := sort.SearchInts(allowed, pkg.virtual)
+		order = append(order, allowed[own:]...)
+		order = append(order, allowed[:own]...)
+	} else {
+		for i := len(allowed) - 1; i >= 0; i-- {
+			order = append(order, allowed[i])
+		}
+	}
+
+	best := order[0]
+	if !s.preferStable {
+		return best
+	}
+
+	for _, candidate := range order[1:] {
+		if stabilities[pkg.versions[candidate].stability()] < stabilities[pkg.versions[best].stability()] {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// dependencyIncompatibilities returns the not-yet-added incompatibilities
+// describing the requirements, conflicts and replacements of one candidate.
+// Each covers the contiguous run of versions around the candidate that declare
+// the same link, which keeps explanations short ("foo >=1.2 <=1.9 requires
+// bar ^2").
+func (s *solver) dependencyIncompatibilities(pkg *poolPackage, index int) []*incompatibility {
+	version := pkg.versions[index]
+	var result []*incompatibility
+
+	for _, depName := range sortedKeys(version.require) {
+		if depName == pkg.name || s.skip(depName) {
+			continue
+		}
+		depender, ok := s.linkTerm("require", pkg, index, depName, func(v *poolVersion) map[string]string { return v.require })
+		if !ok {
+			continue
+		}
+		result = append(result, s.dependencyIncompatibility(depender, depName, version.require[depName]))
+	}
+
+	for _, name := range sortedKeys(version.conflict) {
+		target, loaded := s.pool.packages[name]
+		if name == pkg.name || !loaded {
+			// Anything that could be installed is already in the pool.
+			continue
+		}
+		c, err := parseConstraints(version.conflict[name])
+		if err != nil {
+			continue
+		}
+		conflicting := target.allowed(c)
+		if conflicting.isEmpty() {
+			continue
+		}
+		depender, ok := s.linkTerm("conflict", pkg, index, name, func(v *poolVersion) map[string]string { return v.conflict })
+		if !ok {
+			continue
+		}
+		conflicted := term{name: name, set: conflicting, label: version.conflict[name]}
+		result = append(result, newIncompatibility([]term{depender, conflicted}, causeDeclaredConflict, rootName))
+	}
+
+	for _, name := range sortedKeys(version.replace) {
+		if _, loaded := s.pool.packages[name]; name == pkg.name || !loaded {
+			continue
+		}
+		depender, ok := s.linkTerm("replace", pkg, index, name, func(v *poolVersion) map[string]string { return v.replace })
+		if !ok {
+			continue
+		}
+		result = append(result, s.replaceIncompatibilities(depender, name)...)
+	}
+
+	return result
+}
+
+// linkTerm returns a term covering the run of versions around index that
+// declare the same link to name, or false if it was already handled.
+func (s *solver) linkTerm(kind string, pkg *poolPackage, index int, name string, links func(*poolVersion) map[string]string) (term, bool) {
+	link := links(pkg.versions[index])[name]
+
+	lo, hi := index, index
+	for lo > pkg.virtual && links(pkg.versions[lo-1])[name] == link {
+		lo--
+	}
+	for hi < len(pkg.versions)-1 && links(pkg.versions[hi+1])[name] == link {
+		hi++
+	}
+
+	key := fmt.Sprintf("%s|%s|%s|%d", kind, pkg.name, name, lo)
+	if s.addedDependencies[key] {
+		return term{}, false
+	}
+	s.addedDependencies[key] = true
+
+	return term{name: pkg.name, set: rangeVersionSet(len(pkg.versions), lo, hi)}, true
+}
+
+// replaceIncompatibilities keeps a replacer from being installed next to the
+// package it replaces or next to another package replacing the same name.
+func (s *solver) replaceIncompatibilities(replacer term, name string) []*incompatibility {
+	var result []*incompatibility
+
+	replaced := s.pool.packages[name]
+	if real := replaced.real(); !real.isEmpty() {
+		inc := newIncompatibility([]term{replacer, {name: name, set: real}}, causeReplace, rootName)
+		inc.dependency = name
+		result = append(result, inc)
+	}
+
+	for _, other := range s.pool.replacers[name] {
+		if other.name == replacer.name {
+			continue
+		}
+		set := newVersionSet(len(other.versions))
+		for i, v := range other.versions {
+			if _, ok := v.replace[name]; ok {
+				set = set.with(i)
+			}
+		}
+		inc := newIncompatibility([]term{replacer, {name: other.name, set: set}}, causeReplace, rootName)
+		inc.dependency = name
+		result = append(result, inc)
+	}
+
+	return result
+}
+
+func (s *solver) dependencyIncompatibility(depender term, depName, requirement string) *incompatibility {
+	unsatisfiable := func(kind causeKind, err error) *incompatibility {
+		inc := newIncompatibility([]term{depender}, kind, rootName)
+		inc.dependency = depName
+		inc.constraint = requirement
+		inc.err = err
+		return inc
+	}
+
+	c, err := parseConstraints(requirement)
+	if err != nil {
+		return unsatisfiable(causeInvalidConstraint, err)
+	}
+
+	dep := s.pool.load(depName)
+	if dep.err != nil && len(dep.versions) == 0 {
+		return unsatisfiable(causeUnknownPackage, dep.err)
+	}
+
+	allowed := dep.allowed(c)
+	if allowed.isEmpty() {
+		return unsatisfiable(causeNoVersions, nil)
+	}
+
+	required := term{name: dep.name, set: allowed, label: requirement}
+	return newIncompatibility([]term{depender, required.inverse()}, causeDependency, rootName)
+}
@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+// stabilities ranks stability names from most to least stable, using the
+// values Composer writes to the lock file's "stability-flags".
+var stabilities = map[string]int{
+	"stable": 0,
+	"RC":     5,
+	"beta":   10,
+	"alpha":  15,
+	"dev":    20,
+}
+
+var (
+	explicitStabilityRe = regexp.MustCompile(`(?i)^[^@]*?@(stable|RC|beta|alpha|dev)$`)
+	singleVersionRe     = regexp.MustCompile(`^[^,\s@]+$`)
+	inlineAliasRe       = regexp.MustCompile(`^([^,\s@]+) as .+$`)
+)
+
+// normalizeStability maps a stability name in any case to its canonical
+// spelling, or "" if it isn't one.
+func normalizeStability(stability string) string {
+	for name := range stabilities {
+		if strings.EqualFold(name, stability) {
+			return name
+		}
+	}
+	return ""
+}
+
+// stabilityRules decides which versions are candidates at all: those at least
+// as stable as minimum-stability, or as the package's own stability flag when
+// the root requirement has one.
+type stabilityRules struct {
+	minimum int
+	flags   map[string]int
+}
+
+func newStabilityRules(composer *parser.ComposerJSON) stabilityRules {
+	return stabilityRules{
+		minimum: minimumStability(composer),
+		flags:   StabilityFlags(composer),
+	}
+}
+
+// accepts reports whether a version of the given stability may be installed
+// for package name.
+func (r stabilityRules) accepts(name, stability string) bool {
+	if flag, ok := r.flags[name]; ok {
+		return stabilities[stability] <= flag
+	}
+	return stabilities[stability] <= r.minimum
+}
+
+func minimumStability(composer *parser.ComposerJSON) int {
+	if stability := normalizeStability(composer.MinimumStability); stability != "" {
+		return stabilities[stability]
+	}
+	return stabilities["stable"]
+}
+
+// StabilityFlags returns the per-package stability flags of the root
+// requirements, as Composer's root package loader extracts them: an explicit
+// "@beta" style flag wins, otherwise a requirement on a single unstable
+// version such as "1.0.0-RC1" or "dev-main" allows that stability for the
+// package if minimum-stability doesn't already.
+func StabilityFlags(composer *parser.ComposerJSON) map[string]int {
+	minimum := minimumStability(composer)
+	flags := make(map[string]int)
+
+	for _, require := range []map[string]string{composer.Require, composer.RequireDev} {
+		for _, name := range sortedKeys(require) {
+			requirement := require[name]
+			name = strings.ToLower(name)
+
+			explicit := false
+			for _, orConstraint := range orSplitRe.Split(strings.TrimSpace(requirement), -1) {
+				for _, andConstraint := range splitAndConstraints(orConstraint) {
+					m := explicitStabilityRe.FindStringSubmatch(andConstraint)
+					if m == nil {
+						continue
+					}
+					explicit = true
+
+					stability := stabilities[normalizeStability(m[1])]
+					if current, ok := flags[name]; ok && current > stability {
+						continue
+					}
+					flags[name] = stability
+				}
+			}
+			if explicit {
+				continue
+			}
+
+			if m := inlineAliasRe.FindStringSubmatch(requirement); m != nil {
+				requirement = m[1]
+			}
+			if !singleVersionRe.MatchString(requirement) {
+				continue
+			}
+			stability := stabilities[parseStability(requirement)]
+			if stability == stabilities["stable"] || minimum > stability {
+				continue
+			}
+			if current, ok := flags[name]; ok && current > stability {
+				continue
+			}
+			flags[name] = stability
+		}
+	}
+
+	return flags
+}
@@ -0,0 +1,119 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+func TestStabilityFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		composer *parser.ComposerJSON
+		want     map[string]int
+	}{
+		{
+			name:     "No flags",
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "^1.0"}},
+			want:     map[string]int{},
+		},
+		{
+			name: "Explicit flags",
+			composer: &parser.ComposerJSON{
+				Require:    map[string]string{"a/a": "^1.0@beta", "B/B": "@dev", "c/c": "^1.0@stable"},
+				RequireDev: map[string]string{"d/d": ">=1.0@RC <2.0"},
+			},
+			want: map[string]int{"a/a": 10, "b/b": 20, "c/c": 0, "d/d": 5},
+		},
+		{
+			name:     "Most unstable flag wins",
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "^1.0@beta || ^2.0@alpha"}},
+			want:     map[string]int{"a/a": 15},
+		},
+		{
+			name: "Inferred from an unstable version",
+			composer: &parser.ComposerJSON{Require: map[string]string{
+				"a/a": "1.0.0-RC1",
+				"b/b": "dev-main",
+				"c/c": "dev-main as 1.0.x-dev",
+				"d/d": "^1.0-beta",
+			}},
+			want: map[string]int{"a/a": 5, "b/b": 20, "c/c": 20, "d/d": 10},
+		},
+		{
+			name: "Not inferred when minimum-stability allows it",
+			composer: &parser.ComposerJSON{
+				MinimumStability: "beta",
+				Require:          map[string]string{"a/a": "1.0.0-RC1", "b/b": "1.0.0-alpha1"},
+			},
+			want: map[string]int{"b/b": 15},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StabilityFlags(tt.composer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StabilityFlags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve_Stability(t *testing.T) {
+	repo := fakeRepository{
+		"a/a": {"1.0.0": nil, "1.1.0-beta1": nil, "1.2.0-alpha1": nil, "dev-main": nil},
+		"b/b": {"2.0.0-RC1": nil},
+	}
+
+	tests := []struct {
+		name     string
+		composer *parser.ComposerJSON
+		want     map[string]string
+	}{
+		{
+			name:     "Stable by default",
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "^1.0"}},
+			want:     map[string]string{"a/a": "1.0.0"},
+		},
+		{
+			name:     "Minimum stability",
+			composer: &parser.ComposerJSON{MinimumStability: "beta", Require: map[string]string{"a/a": "^1.0"}},
+			want:     map[string]string{"a/a": "1.1.0-beta1"},
+		},
+		{
+			name:     "Stability flag",
+			composer: &parser.ComposerJSON{Require: map[string]string{"a/a": "^1.0@alpha"}},
+			want:     map[string]string{"a/a": "1.2.0-alpha1"},
+		},
+		{
+			name:     "Stability flag is stricter than minimum stability",
+			composer: &parser.ComposerJSON{MinimumStability: "dev", Require: map[string]string{"a/a": "^1.0@stable"}},
+			want:     map[string]string{"a/a": "1.0.0"},
+		},
+		{
+			name:     "Prefer stable",
+			composer: &parser.ComposerJSON{MinimumStability: "alpha", PreferStable: true, Require: map[string]string{"a/a": "^1.0"}},
+			want:     map[string]string{"a/a": "1.0.0"},
+		},
+		{
+			name:     "Prefer stable falls back to unstable",
+			composer: &parser.ComposerJSON{MinimumStability: "RC", PreferStable: true, Require: map[string]string{"b/b": "^2.0"}},
+			want:     map[string]string{"b/b": "2.0.0-RC1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveWith(t, repo, tt.composer)
+			if err != nil {
+				t.Fatalf("Resolve() returned error: %v", err)
+			}
+			for name, version := range tt.want {
+				if pkg, ok := got[name]; !ok || pkg.Version != version {
+					t.Errorf("Resolve() selected %s %v, want %s", name, pkg, version)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package resolver
+
+import (
+	"math/bits"
+	"strings"
+)
+
+// versionSet is a set over the candidates of one package plus an extra
+// "not installed" member at index n. Treating absence as just another value
+// turns every PubGrub term operation (intersection, difference, negation,
+// subset) into plain bit arithmetic.
+type versionSet struct {
+	n     int // number of candidate versions
+	words []uint64
+}
+
+func newVersionSet(n int) versionSet {
+	return versionSet{n: n, words: make([]uint64, (n+1+63)/64)}
+}
+
+// anyVersionSet contains every version as well as "not installed".
+func anyVersionSet(n int) versionSet {
+	s := newVersionSet(n)
+	for i := range s.words {
+		s.words[i] = ^uint64(0)
+	}
+	return s.trim()
+}
+
+// rangeVersionSet contains the candidates lo through hi inclusive.
+func rangeVersionSet(n, lo, hi int) versionSet {
+	s := newVersionSet(n)
+	for i := lo; i <= hi; i++ {
+		s.words[i/64] |= 1 << (uint(i) % 64)
+	}
+	return s
+}
+
+func (s versionSet) clone() versionSet {
+	c := versionSet{n: s.n, words: make([]uint64, len(s.words))}
+	copy(c.words, s.words)
+	return c
+}
+
+// trim clears the bits past the "not installed" member.
+func (s versionSet) trim() versionSet {
+	if extra := (s.n + 1) % 64; extra != 0 {
+		s.words[len(s.words)-1] &= (1 << uint(extra)) - 1
+	}
+	return s
+}
+
+func (s versionSet) with(i int) versionSet {
+	c := s.clone()
+	c.words[i/64] |= 1 << (uint(i) % 64)
+	return c
+}
+
+func (s versionSet) has(i int) bool {
+	return s.words[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+// includesNone reports whether "not installed" is a member.
+func (s versionSet) includesNone() bool {
+	return s.has(s.n)
+}
+
+func (s versionSet) intersect(o versionSet) versionSet {
+	c := s.clone()
+	for i := range c.words {
+		c.words[i] &= o.words[i]
+	}
+	return c
+}
+
+func (s versionSet) minus(o versionSet) versionSet {
+	c := s.clone()
+	for i := range c.words {
+		c.words[i] &^= o.words[i]
+	}
+	return c
+}
+
+func (s versionSet) complement() versionSet {
+	c := s.clone()
+	for i := range c.words {
+		c.words[i] = ^c.words[i]
+	}
+	return c.trim()
+}
+
+func (s versionSet) isEmpty() bool {
+	for _, w := range s.words {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s versionSet) isFull() bool {
+	return s.complement().isEmpty()
+}
+
+func (s versionSet) subsetOf(o versionSet) bool {
+	return s.minus(o).isEmpty()
+}
+
+func (s versionSet) equal(o versionSet) bool {
+	for i := range s.words {
+		if s.words[i] != o.words[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// count returns the number of candidate versions in the set, ignoring
+// "not installed".
+func (s versionSet) count() int {
+	total := 0
+	for _, w := range s.words {
+		total += bits.OnesCount64(w)
+	}
+	if s.includesNone() {
+		total--
+	}
+	return total
+}
+
+// versions returns the candidate indexes in the set in ascending order.
+func (s versionSet) versions() []int {
+	var out []int
+	for i := 0; i < s.n; i++ {
+		if s.has(i) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// term is a statement about one package: "the installed version of name (or
+// its absence) is a member of set". A term that does not include "not
+// installed" is positive: it requires the package to be selected.
+type term struct {
+	name string
+	set  versionSet
+	// label is the constraint the term was created from, if any, used to
+	// describe it in error messages.
+	label string
+}
+
+func (t term) positive() bool {
+	return !t.set.includesNone()
+}
+
+// inverse negates the term. The label still applies because it always
+// describes the versions named by the term, not its polarity.
+func (t term) inverse() term {
+	return term{name: t.name, set: t.set.complement(), label: t.label}
+}
+
+func (t term) intersect(o term) term {
+	result := term{name: t.name, set: t.set.intersect(o.set)}
+	if t.label != "" && result.set.equal(t.set) {
+		result.label = t.label
+	} else if o.label != "" && result.set.equal(o.set) {
+		result.label = o.label
+	}
+	return result
+}
+
+// describe renders the versions a term allows (or, for a negative term, the
+// versions it forbids) using the constraint it came from when possible and
+// ranges over the candidate list otherwise.
+func (t term) describe(p *pool) string {
+	set := t.set
+	if !t.positive() {
+		set = set.complement()
+	}
+
+	if t.label != "" {
+		return t.label
+	}
+
+	pkg := p.packages[t.name]
+	indexes := set.versions()
+	if pkg == nil || len(indexes) == 0 {
+		return "*"
+	}
+	if len(indexes) == len(pkg.versions) && len(indexes) > 1 {
+		return "*"
+	}
+
+	var ranges []string
+	for start := 0; start < len(indexes); {
+		// Providers are listed one by one; ranges only make sense over the
+		// package's own versions.
+		if indexes[start] < pkg.virtual {
+			ranges = append(ranges, pkg.versions[indexes[start]].version)
+			start++
+			continue
+		}
+
+		end := start
+		for end+1 < len(indexes) && indexes[end+1] == indexes[end]+1 {
+			end++
+		}
+
+		lo, hi := indexes[start], indexes[end]
+		switch {
+		case lo == hi:
+			ranges = append(ranges, pkg.versions[lo].version)
+		case lo == pkg.virtual:
+			ranges = append(ranges, "<="+pkg.versions[hi].version)
+		case hi == len(pkg.versions)-1:
+			ranges = append(ranges, ">="+pkg.versions[lo].version)
+		default:
+			ranges = append(ranges, ">="+pkg.versions[lo].version+" <="+pkg.versions[hi].version)
+		}
+		start = end + 1
+	}
+
+	return strings.Join(ranges, " || ")
+}
@@ -0,0 +1,197 @@
+package resolver
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aras/presto/internal/packagist"
+	"github.com/aras/presto/internal/parser"
+)
+
+// UpdateOptions selects which packages an update may change. Every locked
+// package outside the selection keeps its composer.lock version.
+type UpdateOptions struct {
+	// Packages lists the names to update, with "*" as a wildcard
+	// ("symfony/*"). When empty, everything is updated.
+	Packages []string
+	// WithDependencies also updates the dependencies of the listed
+	// packages, except those that are root requirements.
+	WithDependencies bool
+	// WithAllDependencies also updates the dependencies of the listed
+	// packages, root requirements included.
+	WithAllDependencies bool
+	// PreferStable tries the most stable versions first, as if composer.json
+	// set prefer-stable.
+	PreferStable bool
+	// PreferLowest picks the lowest matching versions instead of the
+	// highest, to test declared lower bounds.
+	PreferLowest bool
+}
+
+// ResolveUpdate resolves composer.json like Resolve, with the preferences in
+// opts, but only the packages opts selects may move away from their version
+// in lock.
+func (r *Resolver) ResolveUpdate(composer *parser.ComposerJSON, lock *parser.ComposerLock, opts UpdateOptions) ([]*Package, error) {
+	solveOpts := solveOptions{preferStable: opts.PreferStable, preferLowest: opts.PreferLowest}
+
+	if lock != nil && len(opts.Packages) > 0 {
+		unlocked := opts.unlocked(composer, lock)
+		solveOpts.locked = make(map[string]*packagist.VersionInfo)
+		for _, lp := range lockedPackages(lock) {
+			name := strings.ToLower(lp.Name)
+			if !unlocked[name] {
+				solveOpts.locked[name] = lockedVersionInfo(lp)
+			}
+		}
+	}
+
+	selected, err := r.solve(composer, solveOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.buildPackages(composer, selected)
+}
+
+// Unmatched returns the listed packages that match neither a locked package
+// nor a root requirement, for which an update can do nothing.
+func (o UpdateOptions) Unmatched(composer *parser.ComposerJSON, lock *parser.ComposerLock) []string {
+	names := updatableNames(composer, lock)
+
+	var unmatched []string
+	for _, pattern := range o.Packages {
+		re := updatePatternRe(pattern)
+		found := false
+		for _, name := range names {
+			if re.MatchString(name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return unmatched
+}
+
+// unlocked returns the lowercase names the update may change: those matching
+// the listed packages and, when asked for, their dependencies as recorded in
+// the lock file.
+func (o UpdateOptions) unlocked(composer *parser.ComposerJSON, lock *parser.ComposerLock) map[string]bool {
+	rootRequires := make(map[string]bool)
+	for _, require := range []map[string]string{composer.Require, composer.RequireDev} {
+		for name := range require {
+			rootRequires[strings.ToLower(name)] = true
+		}
+	}
+
+	unlocked := make(map[string]bool)
+	var queue []string
+	for _, name := range updatableNames(composer, lock) {
+		for _, pattern := range o.Packages {
+			if updatePatternRe(pattern).MatchString(name) {
+				unlocked[name] = true
+				queue = append(queue, name)
+				break
+			}
+		}
+	}
+
+	if !o.WithDependencies && !o.WithAllDependencies {
+		return unlocked
+	}
+
+	requires := make(map[string]map[string]string)
+	for _, lp := range lockedPackages(lock) {
+		requires[strings.ToLower(lp.Name)] = lowercaseKeys(lp.Require)
+	}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for dep := range requires[name] {
+			if unlocked[dep] || (rootRequires[dep] && !o.WithAllDependencies) {
+				continue
+			}
+			unlocked[dep] = true
+			queue = append(queue, dep)
+		}
+	}
+
+	return unlocked
+}
+
+// updatableNames returns the lowercase names of every locked package and root
+// requirement in sorted order.
+func updatableNames(composer *parser.ComposerJSON, lock *parser.ComposerLock) []string {
+	seen := make(map[string]bool)
+	for _, lp := range lockedPackages(lock) {
+		seen[strings.ToLower(lp.Name)] = true
+	}
+	for _, require := range []map[string]string{composer.Require, composer.RequireDev} {
+		for name := range require {
+			seen[strings.ToLower(name)] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// updatePatternRe compiles a package name with "*" wildcards into a
+// case-insensitive, anchored regular expression.
+func updatePatternRe(pattern string) *regexp.Regexp {
+	quoted := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+func lockedPackages(lock *parser.ComposerLock) []parser.LockedPackage {
+	packages := make([]parser.LockedPackage, 0, len(lock.Packages)+len(lock.PackagesDev))
+	packages = append(packages, lock.Packages...)
+	return append(packages, lock.PackagesDev...)
+}
+
+// lockedVersionInfo turns a composer.lock entry back into the metadata the
+// repository would have served for it.
+func lockedVersionInfo(lp parser.LockedPackage) *packagist.VersionInfo {
+	autoloadJSON, _ := json.Marshal(lp.Autoload)
+
+	return &packagist.VersionInfo{
+		Name:             lp.Name,
+		Version:          lp.Version,
+		Description:      lp.Description,
+		Type:             lp.Type,
+		Keywords:         lp.Keywords,
+		License:          lp.License,
+		Require:          lp.Require,
+		RequireDev:       lp.RequireDev,
+		Conflict:         lp.Conflict,
+		Replace:          lp.Replace,
+		Provide:          lp.Provide,
+		Autoload:         autoloadJSON,
+		Extra:            lp.Extra,
+		Time:             lp.Time,
+		NotificationURL:  lp.NotificationURL,
+		TransportOptions: lp.TransportOptions,
+		Dist: packagist.DistInfo{
+			Type:      lp.Dist.Type,
+			URL:       lp.Dist.URL,
+			Reference: lp.Dist.Reference,
+			Shasum:    lp.Dist.Shasum,
+			Integrity: lp.Dist.Integrity,
+		},
+		Source: packagist.SourceInfo{
+			Type:      lp.Source.Type,
+			URL:       lp.Source.URL,
+			Reference: lp.Source.Reference,
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aras/presto/internal/parser"
+)
+
+func TestResolveUpdate(t *testing.T) {
+	repo := fakeRepository{
+		"a/a":       {"1.0.0": {"c/c": "^1.0"}, "1.1.0": {"c/c": "^1.0"}},
+		"b/b":       {"1.0.0": nil, "1.1.0": nil},
+		"c/c":       {"1.0.0": nil, "1.1.0": nil},
+		"symfony/a": {"v5.0.0": nil, "v5.1.0": nil},
+		"symfony/b": {"v5.0.0": nil, "v5.1.0": nil},
+	}
+	composer := &parser.ComposerJSON{Require: map[string]string{
+		"a/a":       "^1.0",
+		"b/b":       "^1.0",
+		"symfony/a": "^5.0",
+		"symfony/b": "^5.0",
+	}}
+	lock := &parser.ComposerLock{Packages: []parser.LockedPackage{
+		{Name: "a/a", Version: "1.0.0", Require: map[string]string{"c/c": "^1.0"}, Dist: parser.DistInfo{Type: "zip", URL: "https://example.com/a/a/1.0.0.zip"}},
+		{Name: "b/b", Version: "1.0.0", Dist: parser.DistInfo{Type: "zip", URL: "https://example.com/b/b/1.0.0.zip"}},
+		{Name: "c/c", Version: "1.0.0", Dist: parser.DistInfo{Type: "zip", URL: "https://example.com/c/c/1.0.0.zip"}},
+		{Name: "symfony/a", Version: "v5.0.0", Dist: parser.DistInfo{Type: "zip", URL: "https://example.com/symfony/a/v5.0.0.zip"}},
+		{Name: "symfony/b", Version: "v5.0.0", Dist: parser.DistInfo{Type: "zip", URL: "https://example.com/symfony/b/v5.0.0.zip"}},
+	}}
+
+	tests := []struct {
+		name string
+		opts UpdateOptions
+		want map[string]string
+	}{
+		{
+			name: "Only the listed package moves",
+			opts: UpdateOptions{Packages: []string{"a/a"}},
+			want: map[string]string{"a/a": "1.1.0", "b/b": "1.0.0", "c/c": "1.0.0", "symfony/a": "v5.0.0", "symfony/b": "v5.0.0"},
+		},
+		{
+			name: "With dependencies",
+			opts: UpdateOptions{Packages: []string{"a/a"}, WithDependencies: true},
+			want: map[string]string{"a/a": "1.1.0", "b/b": "1.0.0", "c/c": "1.1.0", "symfony/a": "v5.0.0", "symfony/b": "v5.0.0"},
+		},
+		{
+			name: "Wildcard",
+			opts: UpdateOptions{Packages: []string{"Symfony/*"}},
+			want: map[string]string{"a/a": "1.0.0", "b/b": "1.0.0", "c/c": "1.0.0", "symfony/a": "v5.1.0", "symfony/b": "v5.1.0"},
+		},
+		{
+			name: "No packages updates everything",
+			opts: UpdateOptions{},
+			want: map[string]string{"a/a": "1.1.0", "b/b": "1.1.0", "c/c": "1.1.0", "symfony/a": "v5.1.0", "symfony/b": "v5.1.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{source: repo}
+			packages, err := r.ResolveUpdate(composer, lock, tt.opts)
+			if err != nil {
+				t.Fatalf("ResolveUpdate() returned error: %v", err)
+			}
+
+			got := make(map[string]string)
+			for _, pkg := range packages {
+				got[pkg.Name] = pkg.Version
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveUpdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateOptions_Unlocked(t *testing.T) {
+	composer := &parser.ComposerJSON{Require: map[string]string{"a/a": "^1.0", "b/b": "^1.0"}}
+	lock := &parser.ComposerLock{
+		Packages: []parser.LockedPackage{
+			{Name: "a/a", Version: "1.0.0", Require: map[string]string{"b/b": "^1.0", "c/c": "^1.0"}},
+			{Name: "b/b", Version: "1.0.0", Require: map[string]string{"d/d": "^1.0"}},
+			{Name: "c/c", Version: "1.0.0", Require: map[string]string{"e/e": "^1.0"}},
+			{Name: "d/d", Version: "1.0.0"},
+		},
+		PackagesDev: []parser.LockedPackage{{Name: "e/e", Version: "1.0.0"}},
+	}
+
+	tests := []struct {
+		name string
+		opts UpdateOptions
+		want []string
+	}{
+		{
+			name: "Listed package only",
+			opts: UpdateOptions{Packages: []string{"A/A"}},
+			want: []string{"a/a"},
+		},
+		{
+			name: "With dependencies skips root requirements",
+			opts: UpdateOptions{Packages: []string{"a/a"}, WithDependencies: true},
+			want: []string{"a/a", "c/c", "e/e"},
+		},
+		{
+			name: "With all dependencies",
+			opts: UpdateOptions{Packages: []string{"a/a"}, WithAllDependencies: true},
+			want: []string{"a/a", "b/b", "c/c", "d/d", "e/e"},
+		},
+		{
+			name: "Wildcard",
+			opts: UpdateOptions{Packages: []string{"*/d", "x/*"}},
+			want: []string{"d/d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, name := range updatableNames(composer, lock) {
+				if tt.opts.unlocked(composer, lock)[name] {
+					got = append(got, name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unlocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	unmatched := UpdateOptions{Packages: []string{"*/d", "x/*"}}.Unmatched(composer, lock)
+	if !reflect.DeepEqual(unmatched, []string{"x/*"}) {
+		t.Errorf("Unmatched() = %v, want [x/*]", unmatched)
+	}
+}
+
+func TestResolveUpdate_Preferences(t *testing.T) {
+	repo := fakeRepository{
+		"a/a": {"1.0.0": {"c/c": "^1.0"}, "1.1.0": {"c/c": "^1.1"}, "1.2.0-RC1": nil},
+		"c/c": {"1.0.0": nil, "1.1.0": nil, "1.2.0": nil},
+		"d/d": {"1.0.0": nil},
+		"e/e": {"1.0.0": {"replace:d/d": "1.0.0"}},
+		"f/f": {"1.0.0-RC1": nil, "1.0.0": nil, "1.1.0": nil},
+	}
+	composer := &parser.ComposerJSON{
+		MinimumStability: "RC",
+		Require:          map[string]string{"a/a": "^1.0", "d/d": "^1.0", "e/e": "^1.0", "f/f": "^1.0"},
+	}
+
+	tests := []struct {
+		name string
+		opts UpdateOptions
+		want map[string]string
+	}{
+		{
+			name: "Highest",
+			opts: UpdateOptions{},
+			want: map[string]string{"a/a": "1.2.0-RC1", "e/e": "1.0.0", "f/f": "1.1.0"},
+		},
+		{
+			name: "Prefer stable",
+			opts: UpdateOptions{PreferStable: true},
+			want: map[string]string{"a/a": "1.1.0", "c/c": "1.2.0", "e/e": "1.0.0", "f/f": "1.1.0"},
+		},
+		{
+			name: "Prefer lowest",
+			opts: UpdateOptions{PreferLowest: true},
+			want: map[string]string{"a/a": "1.0.0", "c/c": "1.0.0", "e/e": "1.0.0", "f/f": "1.0.0-RC1"},
+		},
+		{
+			name: "Prefer lowest and stable",
+			opts: UpdateOptions{PreferLowest: true, PreferStable: true},
+			want: map[string]string{"a/a": "1.0.0", "c/c": "1.0.0", "e/e": "1.0.0", "f/f": "1.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{source: repo}
+			packages, err := r.ResolveUpdate(composer, nil, tt.opts)
+			if err != nil {
+				t.Fatalf("ResolveUpdate() returned error: %v", err)
+			}
+
+			got := make(map[string]string)
+			for _, pkg := range packages {
+				got[pkg.Name] = pkg.Version
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveUpdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
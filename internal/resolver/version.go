@@ -0,0 +1,271 @@
+package resolver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// modifierPattern matches Composer's stability modifiers (see
+// Composer\Semver\VersionParser::$modifierRegex).
+const modifierPattern = `[._-]?(?:(stable|beta|b|RC|alpha|a|patch|pl|p)((?:[.-]?\d+)*)?)?([.-]?dev)?`
+
+var (
+	classicalVersionRe = regexp.MustCompile(`(?i)^v?(\d{1,5})(\.\d+)?(\.\d+)?(\.\d+)?` + modifierPattern + `$`)
+	dateVersionRe      = regexp.MustCompile(`(?i)^v?(\d{4}(?:[.:-]?\d{2}){1,6}(?:[.:-]?\d{1,3}){0,2})` + modifierPattern + `$`)
+	devSuffixRe        = regexp.MustCompile(`(?i)^(.*?)[.-]?dev$`)
+	numericBranchRe    = regexp.MustCompile(`(?i)^v?(\d+)(\.(?:\d+|[xX*]))?(\.(?:\d+|[xX*]))?(\.(?:\d+|[xX*]))?$`)
+	buildMetadataRe    = regexp.MustCompile(`^([^,\s+]+)\+[^\s]+$`)
+	stabilitySuffixRe  = regexp.MustCompile(`(?i)` + modifierPattern + `(?:\+.*)?$`)
+	nonDigitRe         = regexp.MustCompile(`\D`)
+)
+
+// parseVersion normalizes a version string the same way Composer does, so that
+// "v1.2", "1.2.0" and "1.2.0.0" all compare equal and "2.x-dev" becomes
+// "2.9999999.9999999.9999999-dev".
+func parseVersion(version string) (string, error) {
+	version = strings.TrimSpace(version)
+	original := version
+
+	if version == "master" || version == "trunk" || version == "default" {
+		version = "dev-" + version
+	}
+
+	if strings.HasPrefix(strings.ToLower(version), "dev-") {
+		return "dev-" + version[4:], nil
+	}
+
+	if m := buildMetadataRe.FindStringSubmatch(version); m != nil {
+		version = m[1]
+	}
+
+	var matches []string
+	index := 0
+	if m := classicalVersionRe.FindStringSubmatch(version); m != nil {
+		matches = m
+		version = m[1] + defaultSegment(m[2]) + defaultSegment(m[3]) + defaultSegment(m[4])
+		index = 5
+	} else if m := dateVersionRe.FindStringSubmatch(version); m != nil {
+		matches = m
+		version = nonDigitRe.ReplaceAllString(m[1], ".")
+		index = 2
+	}
+
+	if index > 0 {
+		if matches[index] != "" {
+			if strings.ToLower(matches[index]) == "stable" {
+				return version, nil
+			}
+			version += "-" + expandStability(matches[index]) + strings.TrimLeft(matches[index+1], ".-")
+		}
+		if matches[index+2] != "" {
+			version += "-dev"
+		}
+		return version, nil
+	}
+
+	if m := devSuffixRe.FindStringSubmatch(version); m != nil {
+		if normalized := normalizeBranch(m[1]); !strings.HasPrefix(normalized, "dev-") {
+			return normalized, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid version string %q", original)
+}
+
+func defaultSegment(segment string) string {
+	if segment == "" {
+		return ".0"
+	}
+	return segment
+}
+
+// normalizeBranch turns a branch name into a version. Numeric branches such as
+// "2.x" become "2.9999999.9999999.9999999-dev"; anything else is "dev-<name>".
+func normalizeBranch(name string) string {
+	name = strings.TrimSpace(name)
+
+	if m := numericBranchRe.FindStringSubmatch(name); m != nil {
+		var version strings.Builder
+		for i := 1; i < 5; i++ {
+			if m[i] == "" {
+				version.WriteString(".x")
+				continue
+			}
+			version.WriteString(strings.NewReplacer("*", "x", "X", "x").Replace(m[i]))
+		}
+		return strings.ReplaceAll(version.String(), "x", "9999999") + "-dev"
+	}
+
+	return "dev-" + name
+}
+
+func expandStability(stability string) string {
+	switch strings.ToLower(stability) {
+	case "a":
+		return "alpha"
+	case "b":
+		return "beta"
+	case "p", "pl":
+		return "patch"
+	case "rc":
+		return "RC"
+	default:
+		return strings.ToLower(stability)
+	}
+}
+
+// parseStability returns the stability of a version: "stable", "RC", "beta",
+// "alpha" or "dev".
+func parseStability(version string) string {
+	if i := strings.Index(version, "#"); i >= 0 {
+		version = version[:i]
+	}
+
+	if strings.HasPrefix(version, "dev-") || strings.HasSuffix(version, "-dev") {
+		return "dev"
+	}
+
+	m := stabilitySuffixRe.FindStringSubmatch(strings.ToLower(version))
+	if m == nil {
+		return "stable"
+	}
+	if m[3] != "" {
+		return "dev"
+	}
+
+	switch m[1] {
+	case "beta", "b":
+		return "beta"
+	case "alpha", "a":
+		return "alpha"
+	case "rc":
+		return "RC"
+	}
+
+	return "stable"
+}
+
+// isBranch reports whether a normalized version is a named dev branch.
+func isBranch(version string) bool {
+	return strings.HasPrefix(version, "dev-")
+}
+
+// compareVersions compares two normalized versions with the semantics of PHP's
+// version_compare(), which is what Composer uses under the hood.
+func compareVersions(a, b string) int {
+	return compareVersionParts(canonicalVersionParts(a), canonicalVersionParts(b))
+}
+
+// canonicalVersionParts splits a version the way php_canonicalize_version()
+// does: separators become dots and a dot is inserted wherever the string
+// switches between digits and letters.
+func canonicalVersionParts(version string) []string {
+	var parts []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(version); i++ {
+		ch := version[i]
+		isDigit := ch >= '0' && ch <= '9'
+		isAlpha := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+
+		if !isDigit && !isAlpha {
+			flush()
+			continue
+		}
+
+		if current.Len() > 0 {
+			last := current.String()[current.Len()-1]
+			lastIsDigit := last >= '0' && last <= '9'
+			if lastIsDigit != isDigit {
+				flush()
+			}
+		}
+		current.WriteByte(ch)
+	}
+	flush()
+
+	return parts
+}
+
+func compareVersionParts(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if cmp := compareVersionPart(a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+
+	switch {
+	case len(a) > len(b):
+		if isNumericPart(a[len(b)]) {
+			return 1
+		}
+		return compareVersionPart(a[len(b)], "#")
+	case len(b) > len(a):
+		if isNumericPart(b[len(a)]) {
+			return -1
+		}
+		return compareVersionPart("#", b[len(a)])
+	}
+
+	return 0
+}
+
+func compareVersionPart(a, b string) int {
+	aNumeric, bNumeric := isNumericPart(a), isNumericPart(b)
+
+	switch {
+	case aNumeric && bNumeric:
+		ai, _ := strconv.ParseInt(a, 10, 64)
+		bi, _ := strconv.ParseInt(b, 10, 64)
+		return sign(int(ai - bi))
+	case aNumeric:
+		return sign(specialFormOrder("#") - specialFormOrder(b))
+	case bNumeric:
+		return sign(specialFormOrder(a) - specialFormOrder("#"))
+	default:
+		return sign(specialFormOrder(a) - specialFormOrder(b))
+	}
+}
+
+// specialFormOrder ranks the non-numeric version parts PHP knows about.
+// Anything unknown sorts below "dev".
+func specialFormOrder(form string) int {
+	specialForms := []struct {
+		name  string
+		order int
+	}{
+		{"dev", 0}, {"alpha", 1}, {"a", 1}, {"beta", 2}, {"b", 2},
+		{"RC", 3}, {"rc", 3}, {"#", 4}, {"pl", 5}, {"p", 5},
+	}
+
+	for _, f := range specialForms {
+		if strings.HasPrefix(form, f.name) {
+			return f.order
+		}
+	}
+
+	return -6
+}
+
+func isNumericPart(part string) bool {
+	return part != "" && part[0] >= '0' && part[0] <= '9'
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
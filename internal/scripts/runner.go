@@ -1,24 +1,32 @@
 package scripts
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aras/presto/internal/parser"
 )
 
 // Runner handles the execution of Composer scripts
 type Runner struct {
-	Verbose bool
+	Verbose   bool
+	VendorDir string
+	BinDir    string        // prepended to PATH
+	Timeout   time.Duration // per command; 0 for no limit
 }
 
 // NewRunner creates a new script runner
 func NewRunner(verbose bool) *Runner {
 	return &Runner{
-		Verbose: verbose,
+		Verbose:   verbose,
+		VendorDir: "vendor",
+		BinDir:    "vendor/bin",
 	}
 }
 
@@ -75,14 +83,7 @@ func (r *Runner) executeCommand(command string, composer *parser.ComposerJSON, s
 		}
 		// Wrap class call in a PHP runner command
 		// We need to include vendor/autoload.php if it exists
-		vendorDir := "vendor"
-		if composer != nil && composer.Config != nil {
-			if v, ok := composer.Config["vendor-dir"].(string); ok {
-				vendorDir = v
-			} else if v, ok := composer.Config["vendorDir"].(string); ok {
-				vendorDir = v
-			}
-		}
+		vendorDir := r.VendorDir
 
 		autoloadPath := filepath.Join(vendorDir, "autoload.php")
 		if _, err := os.Stat(autoloadPath); os.IsNotExist(err) {
@@ -138,23 +139,35 @@ if (!class_exists('Composer\Script\Event')) {
 		command = command + " " + strings.Join(quoted, " ")
 	}
 
-	// Prepend vendor/bin to PATH so packages can use their binaries
+	// Prepend the bin dir to PATH so packages can use their binaries
 	path := os.Getenv("PATH")
-	vendorBin, _ := filepath.Abs("vendor/bin")
-	newPath := vendorBin + string(os.PathListSeparator) + path
+	binDir, _ := filepath.Abs(r.BinDir)
+	newPath := binDir + string(os.PathListSeparator) + path
 
 	shell := os.Getenv("SHELL")
 	if shell == "" {
 		shell = "sh"
 	}
 
-	cmd := exec.Command(shell, "-c", command)
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, shell, "-c", command)
 	cmd.Env = append(os.Environ(), "PATH="+newPath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
+	// Don't wait on children that outlive a killed shell.
+	cmd.WaitDelay = time.Second
 
 	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("the process %q exceeded the timeout of %s (process-timeout)", command, r.Timeout)
+		}
 		return fmt.Errorf("command execution failed: %w", err)
 	}
 
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aras/presto/internal/parser"
 )
@@ -291,3 +292,24 @@ func TestShellQuote(t *testing.T) {
 		}
 	}
 }
+
+// TestRunner_Timeout verifies that a command running past the process
+// timeout is killed and reported.
+func TestRunner_Timeout(t *testing.T) {
+	runner := NewRunner(false)
+	runner.Timeout = 100 * time.Millisecond
+	composer := &parser.ComposerJSON{
+		Scripts: map[string]interface{}{
+			"slow": "sleep 5",
+		},
+	}
+
+	start := time.Now()
+	err := runner.Run("slow", composer)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected a timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("command ran for %s, want it killed after the timeout", elapsed)
+	}
+}
@@ -1,20 +1,32 @@
 package security
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aras/presto/internal/cache"
 	"github.com/aras/presto/internal/parser"
 )
 
+// Auditor checks packages against the OSV and Packagist advisory databases.
+// Every answer is kept in the user cache directory, so that offline the
+// last known advisories are used.
 type Auditor struct {
 	httpClient *http.Client
 	osvURL     string
 	githubURL  string
 	packagist  string
+	cache      *cache.Cache
+	offline    bool
 }
 
 type Vulnerability struct {
@@ -35,20 +47,43 @@ func NewAuditor() *Auditor {
 		osvURL:    "https://api.osv.dev/v1/query",
 		githubURL: "https://api.github.com/advisories",
 		packagist: "https://packagist.org/api/security-advisories",
+		cache:     cache.New(cache.Dir()),
 	}
 }
 
+// SetCache sets where advisories are cached. nil disables the cache.
+func (a *Auditor) SetCache(c *cache.Cache) {
+	a.cache = c
+}
+
+// SetOffline makes the auditor use cached advisories only.
+func (a *Auditor) SetOffline(offline bool) {
+	a.offline = offline
+}
+
+// ScanProject checks the project's requirements. Offline, packages without
+// cached advisories are reported in a *cache.MissingError, along with the
+// vulnerabilities found for the others.
 func (a *Auditor) ScanProject(composer *parser.ComposerJSON) ([]*Vulnerability, error) {
 	var vulnerabilities []*Vulnerability
+	var missing []string
 
 	for pkg, version := range composer.Require {
 		vulns, err := a.checkPackage(pkg, version)
+		if errors.Is(err, cache.ErrOffline) {
+			missing = append(missing, "security advisories for "+pkg)
+			continue
+		}
 		if err != nil {
 			continue // Skip errors, continue scanning
 		}
 		vulnerabilities = append(vulnerabilities, vulns...)
 	}
 
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return vulnerabilities, &cache.MissingError{Items: missing}
+	}
 	return vulnerabilities, nil
 }
 
@@ -60,10 +95,16 @@ func (a *Auditor) checkPackage(name, version string) ([]*Vulnerability, error) {
 	var allVulns []*Vulnerability
 
 	osvVulns, err := a.checkOSV(name, version)
+	if errors.Is(err, cache.ErrOffline) {
+		return nil, err
+	}
 	if err == nil && len(osvVulns) > 0 {
 		allVulns = append(allVulns, osvVulns...)
 	}
 	packagistVulns, err := a.checkPackagist(name, version)
+	if errors.Is(err, cache.ErrOffline) {
+		return nil, err
+	}
 	if err == nil && len(packagistVulns) > 0 {
 		allVulns = append(allVulns, packagistVulns...)
 	}
@@ -71,6 +112,48 @@ func (a *Auditor) checkPackage(name, version string) ([]*Vulnerability, error) {
 	return deduplicateVulnerabilities(allVulns), nil
 }
 
+// fetch returns the body of a successful response to req, or nil for any
+// other status. Bodies are stored in the cache under key; offline they are
+// read from there instead.
+func (a *Auditor) fetch(req *http.Request, key string) ([]byte, error) {
+	if a.offline {
+		if a.cache == nil {
+			return nil, cache.ErrOffline
+		}
+		body, _, err := a.cache.Read(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, cache.ErrOffline)
+		}
+		return body, nil
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if a.cache != nil {
+		_ = a.cache.Write(key, body)
+	}
+	return body, nil
+}
+
+// osvCacheKey names a cached OSV response:
+// advisories/osv/vendor/name/<sha1 of the version>.json.
+func osvCacheKey(name, version string) string {
+	sum := sha1.Sum([]byte(version))
+	return "advisories/osv/" + name + "/" + hex.EncodeToString(sum[:]) + ".json"
+}
+
 func (a *Auditor) checkOSV(name, version string) ([]*Vulnerability, error) {
 	payload := map[string]interface{}{
 		"package": map[string]string{
@@ -93,18 +176,13 @@ func (a *Auditor) checkOSV(name, version string) ([]*Vulnerability, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Presto/1.0")
 
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
+	body, err := a.fetch(req, osvCacheKey(name, version))
+	if err != nil || body == nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil
-	}
 
 	var osvResp OSVResponse
-	if err := json.NewDecoder(resp.Body).Decode(&osvResp); err != nil {
+	if err := json.Unmarshal(body, &osvResp); err != nil {
 		return nil, err
 	}
 
@@ -150,18 +228,14 @@ func (a *Auditor) checkPackagist(name, version string) ([]*Vulnerability, error)
 	req.Header.Set("User-Agent", "Presto/1.0") // version doesnt matter
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
+	// Packagist answers for every version at once.
+	body, err := a.fetch(req, "advisories/packagist/"+name+".json")
+	if err != nil || body == nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil
-	}
 
 	var advisories map[string][]Advisory
-	if err := json.NewDecoder(resp.Body).Decode(&advisories); err != nil {
+	if err := json.Unmarshal(body, &advisories); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package store
+
+// linkCount can't tell the number of hard links here, so entries are never
+// taken for unused.
+func linkCount(path string) (uint64, bool) {
+	return 0, false
+}
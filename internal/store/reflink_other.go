@@ -0,0 +1,13 @@
+//go:build !linux
+
+package store
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// reflink is only supported on Linux; elsewhere files are copied.
+func reflink(src, dest string, perm fs.FileMode) error {
+	return errors.ErrUnsupported
+}
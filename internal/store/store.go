@@ -0,0 +1,433 @@
+// Package store keeps extracted packages in a content-addressable store,
+// shared by every project on the machine, and links them into vendor
+// directories instead of extracting them again. An entry is addressed by the
+// SHA-256 of the archive it was extracted from, so the same release installs
+// from the same files wherever it comes from.
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// layout is the version of the directory layout, the first level under the
+// store's root.
+const layout = "v1"
+
+// Store is a directory of extracted packages:
+// <root>/v1/<first two hex digits>/<rest of the SHA-256>/files holds the
+// package, and index.json next to it lists its files. An entry without an
+// index is incomplete and isn't used.
+type Store struct {
+	root string
+}
+
+// Entry describes an extracted package in the store.
+type Entry struct {
+	Integrity string // of the archive, "sha256-<base64>"
+	Dir       string // the package's files
+	Files     int
+	Size      int64
+	Linked    bool // into a vendor directory, as far as link counts tell
+}
+
+// index lists the files of an entry, by slash-separated path.
+type index struct {
+	Integrity string               `json:"integrity"`
+	Files     map[string]indexFile `json:"files"`
+}
+
+type indexFile struct {
+	Size   int64       `json:"size,omitempty"`
+	Mode   fs.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256,omitempty"`
+	Link   string      `json:"link,omitempty"` // a symlink's target
+}
+
+// New returns the store rooted at root, which is created on first use.
+func New(root string) *Store {
+	return &Store{root: root}
+}
+
+// Root returns the store directory.
+func (s *Store) Root() string {
+	return s.root
+}
+
+// entryDir returns the directory of the entry for integrity.
+func (s *Store) entryDir(integrity string) (string, error) {
+	b64, ok := strings.CutPrefix(integrity, "sha256-")
+	sum, err := base64.StdEncoding.DecodeString(b64)
+	if !ok || err != nil || len(sum) != sha256.Size {
+		return "", fmt.Errorf("invalid integrity %q", integrity)
+	}
+	h := hex.EncodeToString(sum)
+	return filepath.Join(s.root, layout, h[:2], h[2:]), nil
+}
+
+// Lookup returns the files of the entry for integrity, if there is one and it
+// passes a quick check: every file is there, with the size and type it was
+// stored with. A damaged entry is removed.
+func (s *Store) Lookup(integrity string) (string, bool) {
+	dir, err := s.entryDir(integrity)
+	if err != nil {
+		return "", false
+	}
+	idx, err := readIndex(dir)
+	if err != nil {
+		return "", false
+	}
+	if check(dir, idx, false) != nil {
+		os.RemoveAll(dir)
+		return "", false
+	}
+	return filepath.Join(dir, "files"), true
+}
+
+// Add returns the files of the entry for integrity, first creating it with
+// fill, which extracts the archive into the directory it is given, when the
+// store doesn't have it. Stored files are made read-only, as every vendor
+// directory linking to them shares them.
+func (s *Store) Add(integrity string, fill func(dir string) error) (string, error) {
+	if files, ok := s.Lookup(integrity); ok {
+		return files, nil
+	}
+	dir, err := s.entryDir(integrity)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	files := filepath.Join(tmp, "files")
+	if err := fill(files); err != nil {
+		return "", err
+	}
+	idx, err := build(files, integrity)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "index.json"), data, 0644); err != nil {
+		return "", err
+	}
+
+	// The entry appears whole or not at all. Another process may have
+	// added it meanwhile, which is as good: its entry is kept, as that
+	// process may be linking from it.
+	if err := os.Rename(tmp, dir); err != nil {
+		if files, ok := s.Lookup(integrity); ok {
+			return files, nil
+		}
+		// Otherwise what is there is a damaged or partial entry.
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+		if err := os.Rename(tmp, dir); err != nil {
+			if files, ok := s.Lookup(integrity); ok {
+				return files, nil
+			}
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "files"), nil
+}
+
+// build lists the files under dir, hashing them, and makes them read-only.
+func build(dir, integrity string) (*index, error) {
+	idx := &index{Integrity: integrity, Files: make(map[string]indexFile)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			idx.Files[filepath.ToSlash(rel)] = indexFile{Mode: fs.ModeSymlink, Link: target}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		perm := fs.FileMode(0444)
+		if info.Mode()&0111 != 0 {
+			perm = 0555
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+		idx.Files[filepath.ToSlash(rel)] = indexFile{Size: info.Size(), Mode: perm, SHA256: sum}
+		return nil
+	})
+	return idx, err
+}
+
+func readIndex(dir string) (*index, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+// check compares the files of the entry in dir with its index: their type and
+// size, and with full also their content.
+func check(dir string, idx *index, full bool) error {
+	files := filepath.Join(dir, "files")
+	for name, want := range idx.Files {
+		path := filepath.Join(files, filepath.FromSlash(name))
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		if want.Mode&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil || target != want.Link {
+				return fmt.Errorf("%s: symlink changed", name)
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() || info.Size() != want.Size {
+			return fmt.Errorf("%s: changed since it was stored", name)
+		}
+		if full {
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			if sum != want.SHA256 {
+				return fmt.Errorf("%s: content changed since it was stored", name)
+			}
+		}
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Link populates dest, which must not exist, with the files of an entry:
+// directories are created, files are hard links into the store, or reflinks
+// or copies where the store is on another file system, and symlinks are
+// recreated.
+func Link(files, dest string) error {
+	err := filepath.WalkDir(files, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(files, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return linkFile(path, target, info.Mode())
+		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(dest)
+	}
+	return err
+}
+
+// linkFile hard links dest to src, or else clones or copies it, as a
+// writable file of its own.
+func linkFile(src, dest string, mode fs.FileMode) error {
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+	perm := fs.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	if err := reflink(src, dest, perm); err == nil {
+		return nil
+	}
+	return copyFile(src, dest, perm)
+}
+
+func copyFile(src, dest string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Entries lists the complete entries of the store, sorted by integrity. A
+// missing store has none.
+func (s *Store) Entries() ([]Entry, error) {
+	dirs, err := filepath.Glob(filepath.Join(s.root, layout, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, dir := range dirs {
+		if strings.HasPrefix(filepath.Base(dir), ".") {
+			continue
+		}
+		idx, err := readIndex(dir)
+		if err != nil {
+			continue
+		}
+		e := Entry{Integrity: idx.Integrity, Dir: filepath.Join(dir, "files")}
+		for name, f := range idx.Files {
+			e.Files++
+			e.Size += f.Size
+			if f.Mode&fs.ModeSymlink == 0 && !e.Linked {
+				n, ok := linkCount(filepath.Join(e.Dir, filepath.FromSlash(name)))
+				e.Linked = !ok || n > 1
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Integrity < entries[j].Integrity })
+	return entries, nil
+}
+
+// Verify checks the content of every entry against its index, removes the
+// damaged ones, and returns them.
+func (s *Store) Verify() ([]Entry, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var damaged []Entry
+	for _, e := range entries {
+		dir := filepath.Dir(e.Dir)
+		idx, err := readIndex(dir)
+		if err == nil {
+			err = check(dir, idx, true)
+		}
+		if err == nil {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return damaged, err
+		}
+		damaged = append(damaged, e)
+	}
+	return damaged, nil
+}
+
+// Prune removes the entries that no vendor directory links to any more, and
+// any left incomplete, and returns the entries removed. Packages linked by
+// copying rather than hard links don't count, so their entries go too.
+func (s *Store) Prune() ([]Entry, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Entry
+	for _, e := range entries {
+		if e.Linked {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Dir(e.Dir)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, e)
+	}
+
+	// Entries without an index, and those still being extracted an hour
+	// later, are from installs that were interrupted.
+	dirs, _ := filepath.Glob(filepath.Join(s.root, layout, "*", "*"))
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		_, err = os.Stat(filepath.Join(dir, "index.json"))
+		incomplete := errors.Is(err, fs.ErrNotExist)
+		if strings.HasPrefix(filepath.Base(dir), ".tmp-") {
+			incomplete = time.Since(info.ModTime()) > time.Hour
+		}
+		if incomplete {
+			if err := os.RemoveAll(dir); err != nil {
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// integrity returns an integrity for a made-up archive.
+func integrity(archive string) string {
+	sum := sha256.Sum256([]byte(archive))
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// fill writes a small package to dir.
+func fill(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "composer.json"), []byte(`{"name": "acme/lib"}`), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin/tool"), []byte("#!/usr/bin/env php"), 0755); err != nil {
+		return err
+	}
+	return os.Symlink("bin/tool", filepath.Join(dir, "tool"))
+}
+
+func TestStore_AddAndLink(t *testing.T) {
+	s := New(t.TempDir())
+	id := integrity("lib-1.0.0.zip")
+
+	if _, ok := s.Lookup(id); ok {
+		t.Fatal("Lookup() found an entry in an empty store")
+	}
+	files, err := s.Add(id, fill)
+	if err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+	if again, err := s.Add(id, func(string) error { t.Error("Add() extracted a stored package again"); return nil }); err != nil || again != files {
+		t.Errorf("Add() of a stored package = %s, %v, want %s", again, err, files)
+	}
+
+	dest := filepath.Join(t.TempDir(), "vendor", "acme", "lib")
+	if err := Link(files, dest); err != nil {
+		t.Fatalf("Link() returned error: %v", err)
+	}
+	stored, _ := os.Stat(filepath.Join(files, "bin/tool"))
+	linked, err := os.Stat(filepath.Join(dest, "bin/tool"))
+	if err != nil || !os.SameFile(stored, linked) {
+		t.Errorf("bin/tool = %v, %v, want a hard link into the store", linked, err)
+	}
+	if stored.Mode() != 0555 {
+		t.Errorf("stored bin/tool mode = %v, want read-only 0555", stored.Mode())
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "tool")); err != nil || target != "bin/tool" {
+		t.Errorf("tool links to %q, %v, want bin/tool", target, err)
+	}
+
+	// A truncated file fails the quick check, and the entry is dropped.
+	os.Chmod(filepath.Join(files, "composer.json"), 0644)
+	os.WriteFile(filepath.Join(files, "composer.json"), []byte("{}"), 0644)
+	if _, ok := s.Lookup(id); ok {
+		t.Error("Lookup() returned a damaged entry")
+	}
+	if _, err := os.Stat(files); !os.IsNotExist(err) {
+		t.Error("damaged entry left in the store")
+	}
+
+	if _, err := s.Add("sha1-abc", fill); err == nil {
+		t.Error("Add() with an invalid integrity expected an error")
+	}
+}
+
+func TestStore_AddRace(t *testing.T) {
+	s := New(t.TempDir())
+	id := integrity("lib-1.0.0.zip")
+
+	// Another process adds the entry while this one extracts it, and
+	// starts linking from it.
+	var theirs string
+	var linked os.FileInfo
+	files, err := s.Add(id, func(dir string) error {
+		var err error
+		if theirs, err = New(s.Root()).Add(id, fill); err != nil {
+			return err
+		}
+		if linked, err = os.Stat(filepath.Join(theirs, "composer.json")); err != nil {
+			return err
+		}
+		return fill(dir)
+	})
+	if err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+	if files != theirs {
+		t.Errorf("Add() = %s, want the entry the other process added, %s", files, theirs)
+	}
+	if info, err := os.Stat(filepath.Join(theirs, "composer.json")); err != nil || !os.SameFile(info, linked) {
+		t.Error("Add() replaced the files of an entry another process had added")
+	}
+
+	// A partial entry, without its index, is replaced.
+	partial := integrity("partial")
+	if _, err := s.Add(partial, fill); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(mustLookup(t, s, partial))
+	os.Remove(filepath.Join(dir, "index.json"))
+	if _, err := s.Add(partial, fill); err != nil {
+		t.Fatalf("Add() over a partial entry returned error: %v", err)
+	}
+	mustLookup(t, s, partial)
+}
+
+func mustLookup(t *testing.T, s *Store, integrity string) string {
+	t.Helper()
+	files, ok := s.Lookup(integrity)
+	if !ok {
+		t.Fatalf("Lookup(%s) found no entry", integrity)
+	}
+	return files
+}
+
+func TestStore_VerifyAndPrune(t *testing.T) {
+	s := New(t.TempDir())
+	used, unused, damaged := integrity("used"), integrity("unused"), integrity("damaged")
+	for _, id := range []string{used, unused, damaged} {
+		files, err := s.Add(id, fill)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == used {
+			if err := Link(files, filepath.Join(t.TempDir(), "lib")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The same size, so only a full check notices.
+	files, _ := s.Lookup(damaged)
+	os.Chmod(filepath.Join(files, "composer.json"), 0644)
+	os.WriteFile(filepath.Join(files, "composer.json"), []byte(`{"name": "evil/lib"}`), 0644)
+	if _, ok := s.Lookup(damaged); !ok {
+		t.Fatal("Lookup() dropped an entry of the right sizes")
+	}
+
+	removed, err := s.Verify()
+	if err != nil {
+		t.Fatalf("Verify() returned error: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Integrity != damaged {
+		t.Errorf("Verify() removed %v, want the damaged entry", removed)
+	}
+
+	removed, err = s.Prune()
+	if err != nil {
+		t.Fatalf("Prune() returned error: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Integrity != unused {
+		t.Errorf("Prune() removed %v, want the unused entry", removed)
+	}
+	if _, ok := s.Lookup(used); !ok {
+		t.Error("Prune() removed an entry a vendor directory links to")
+	}
+}
@@ -0,0 +1,307 @@
+// Package vcs reads git repositories through the git binary. Each repository
+// is kept as a bare mirror in the cache, so later runs only fetch what's new
+// and offline runs can still use it.
+package vcs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aras/presto/internal/cache"
+)
+
+var unsafeKeyChars = regexp.MustCompile(`[^a-zA-Z0-9.]`)
+
+// commitID matches a full SHA-1 or SHA-256 commit name.
+var commitID = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// Ref is a branch or tag of a repository.
+type Ref struct {
+	Name   string // without refs/heads/ or refs/tags/
+	Tag    bool
+	Commit string
+	Time   time.Time // when Commit was made
+}
+
+// Repository is the local mirror of a git repository.
+type Repository struct {
+	URL string
+	dir string
+}
+
+// update fetches a mirror once per process.
+type update struct {
+	once sync.Once
+	err  error
+}
+
+var updates sync.Map // mirror directory -> *update
+
+// MirrorKey returns the cache key of the mirror of url, e.g.
+// vcs/https---example.com-acme-private.git.
+func MirrorKey(url string) string {
+	return cache.VCSDir + "/" + unsafeKeyChars.ReplaceAllString(url, "-")
+}
+
+// Mirror returns the mirror of url in c. It is cloned on first use and
+// brought up to date once per process; if that fails, an existing mirror is
+// used as it is. Offline, only an existing mirror is used.
+func Mirror(c *cache.Cache, url string, offline bool) (*Repository, error) {
+	// The URL comes from package metadata, and git would take one starting
+	// with a dash for an option.
+	if url == "" || strings.HasPrefix(url, "-") {
+		return nil, fmt.Errorf("invalid git repository URL %q", url)
+	}
+	key := MirrorKey(url)
+	repo := &Repository{URL: url, dir: c.Path(key)}
+
+	if offline {
+		if !repo.exists() {
+			return nil, fmt.Errorf("git repository %s: %w", url, cache.ErrOffline)
+		}
+	} else {
+		u, _ := updates.LoadOrStore(repo.dir, &update{})
+		up := u.(*update)
+		up.once.Do(func() {
+			up.err = repo.update()
+		})
+		if up.err != nil {
+			return nil, up.err
+		}
+	}
+
+	_ = c.Touch(key)
+	return repo, nil
+}
+
+// exists reports whether the mirror has been cloned.
+func (r *Repository) exists() bool {
+	_, err := os.Stat(filepath.Join(r.dir, "HEAD"))
+	return err == nil
+}
+
+// update fetches new commits into the mirror, or clones it.
+func (r *Repository) update() error {
+	if r.exists() {
+		// A stale mirror beats none when the remote can't be reached.
+		_, _ = r.git("remote", "update", "--prune")
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.dir), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(r.dir), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := run("", "clone", "--mirror", "--quiet", "--", r.URL, tmp); err != nil {
+		return fmt.Errorf("failed to clone %s: %w", r.URL, err)
+	}
+	return os.Rename(tmp, r.dir)
+}
+
+// Refs lists the branches and tags of the repository.
+func (r *Repository) Refs() ([]Ref, error) {
+	out, err := r.git("for-each-ref",
+		"--format=%(refname)%00%(objectname)%00%(*objectname)%00%(committerdate:iso-strict)%00%(*committerdate:iso-strict)",
+		"refs/heads", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []Ref
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 5 {
+			continue
+		}
+
+		ref := Ref{Commit: fields[1]}
+		date := fields[3]
+		// Annotated tags point at a tag object; use the commit it tags.
+		if fields[2] != "" {
+			ref.Commit, date = fields[2], fields[4]
+		}
+		ref.Time, _ = time.Parse(time.RFC3339, date)
+
+		if name, ok := strings.CutPrefix(fields[0], "refs/tags/"); ok {
+			ref.Name, ref.Tag = name, true
+		} else {
+			ref.Name = strings.TrimPrefix(fields[0], "refs/heads/")
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// ReadFiles returns the contents of path at each of commits, keyed by commit.
+// Commits that don't have the file are left out.
+func (r *Repository) ReadFiles(commits []string, path string) (map[string][]byte, error) {
+	var input bytes.Buffer
+	for _, commit := range commits {
+		fmt.Fprintf(&input, "%s:%s\n", commit, path)
+	}
+
+	cmd := gitCommand(r.dir, "cat-file", "--batch")
+	cmd.Stdin = &input
+	out, err := output(cmd, "cat-file")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each object is "<oid> <type> <size>\n<contents>\n", or a line ending in
+	// "missing" if there's no such file.
+	files := make(map[string][]byte)
+	reader := bufio.NewReader(bytes.NewReader(out))
+	for _, commit := range commits {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from %s: %w", path, r.URL, err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from %s: %w", path, r.URL, err)
+		}
+
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("failed to read %s from %s: %w", path, r.URL, err)
+		}
+		if fields[1] == "blob" {
+			files[commit] = data[:size]
+		}
+	}
+	return files, nil
+}
+
+// Archive writes the tree of commit to dest as a zip archive, with every
+// path under prefix.
+func (r *Repository) Archive(commit, prefix, dest string) error {
+	if err := CheckRef(commit); err != nil {
+		return err
+	}
+	_, err := r.git("archive", "--format=zip", "--prefix="+prefix, "--output="+dest, "--end-of-options", commit)
+	return err
+}
+
+// Checkout makes dest a working copy of commit, with the repository's URL as
+// its origin, the way a source install leaves a package.
+func (r *Repository) Checkout(commit, dest string) error {
+	if err := CheckRef(commit); err != nil {
+		return err
+	}
+	// checkout doesn't take --end-of-options with --detach, so the ref is
+	// resolved to a commit name first.
+	out, err := r.git("rev-parse", "--verify", "--quiet", "--end-of-options", commit+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("unknown commit %q: %w", commit, err)
+	}
+	id := strings.TrimSpace(string(out))
+
+	if _, err := run("", "clone", "--quiet", "--no-checkout", "--", r.dir, dest); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"remote", "set-url", "--", "origin", r.URL},
+		{"checkout", "--quiet", "--detach", id},
+	} {
+		cmd := gitCommand("", args...)
+		cmd.Dir = dest
+		if _, err := output(cmd, args[0]); err != nil {
+			os.RemoveAll(dest)
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckRef returns an error unless ref, which comes from package metadata or
+// composer.lock, is a full commit name or a valid ref name, so that it can't
+// pass for an option of git.
+func CheckRef(ref string) error {
+	if commitID.MatchString(ref) {
+		return nil
+	}
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid git reference %q", ref)
+	}
+	if _, err := run("", "check-ref-format", "--allow-onelevel", ref); err != nil {
+		return fmt.Errorf("invalid git reference %q", ref)
+	}
+	return nil
+}
+
+func (r *Repository) git(args ...string) ([]byte, error) {
+	return run(r.dir, args...)
+}
+
+// Head returns the tag or branch checked out in the working tree at dir. A
+// tag on the checked out commit wins over the branch.
+func Head(dir string) (Ref, error) {
+	git := func(args ...string) (string, error) {
+		cmd := gitCommand("", args...)
+		cmd.Dir = dir
+		out, err := output(cmd, args[0])
+		return strings.TrimSpace(string(out)), err
+	}
+
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return Ref{}, err
+	}
+	if tag, err := git("describe", "--tags", "--exact-match", "HEAD"); err == nil {
+		return Ref{Name: tag, Tag: true, Commit: commit}, nil
+	}
+	branch, err := git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return Ref{}, err
+	}
+	return Ref{Name: branch, Commit: commit}, nil
+}
+
+// run runs git with args, against the repository in gitDir if set.
+func run(gitDir string, args ...string) ([]byte, error) {
+	return output(gitCommand(gitDir, args...), args[0])
+}
+
+// output runs cmd and returns its output, or an error with what git printed
+// about the failure.
+func output(cmd *exec.Cmd, name string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", name, msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", name, err)
+	}
+	return out, nil
+}
+
+func gitCommand(gitDir string, args ...string) *exec.Cmd {
+	if gitDir != "" {
+		args = append([]string{"--git-dir", gitDir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	// Never wait for credentials on the terminal.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
@@ -0,0 +1,198 @@
+package vcs
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aras/presto/internal/cache"
+)
+
+// gitRun runs git in dir with a fixed identity.
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+// newBareRepository returns a bare repository with a main branch of two
+// commits, the first tagged v1.0.0, and a feature branch without
+// composer.json.
+func newBareRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	work := t.TempDir()
+	gitRun(t, work, "init", "--quiet", "--initial-branch=main")
+	os.WriteFile(filepath.Join(work, "composer.json"), []byte(`{"name": "acme/lib"}`), 0644)
+	gitRun(t, work, "add", ".")
+	gitRun(t, work, "commit", "--quiet", "-m", "First")
+	gitRun(t, work, "tag", "-a", "v1.0.0", "-m", "Release")
+	os.WriteFile(filepath.Join(work, "README"), []byte("readme"), 0644)
+	gitRun(t, work, "add", ".")
+	gitRun(t, work, "commit", "--quiet", "-m", "Second")
+	gitRun(t, work, "checkout", "--quiet", "--orphan", "feature")
+	gitRun(t, work, "rm", "--quiet", "-rf", ".")
+	os.WriteFile(filepath.Join(work, "other"), []byte("other"), 0644)
+	gitRun(t, work, "add", ".")
+	gitRun(t, work, "commit", "--quiet", "-m", "Other")
+
+	bare := filepath.Join(t.TempDir(), "lib.git")
+	gitRun(t, work, "clone", "--quiet", "--bare", work, bare)
+	return bare
+}
+
+func TestMirror(t *testing.T) {
+	url := newBareRepository(t)
+	c := cache.New(t.TempDir())
+
+	if _, err := Mirror(c, url, true); !errors.Is(err, cache.ErrOffline) {
+		t.Fatalf("Mirror() offline before cloning = %v, want ErrOffline", err)
+	}
+
+	repo, err := Mirror(c, url, false)
+	if err != nil {
+		t.Fatalf("Mirror() returned error: %v", err)
+	}
+	if !c.Has(MirrorKey(url)) {
+		t.Errorf("mirror not stored under %s", MirrorKey(url))
+	}
+
+	refs, err := repo.Refs()
+	if err != nil {
+		t.Fatalf("Refs() returned error: %v", err)
+	}
+	var names []string
+	commits := map[string]string{}
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+		commits[ref.Name] = ref.Commit
+		if ref.Time.IsZero() {
+			t.Errorf("ref %s has no commit time", ref.Name)
+		}
+	}
+	sort.Strings(names)
+	if want := []string{"feature", "main", "v1.0.0"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Refs() = %v, want %v", names, want)
+	}
+
+	files, err := repo.ReadFiles([]string{commits["v1.0.0"], commits["feature"], commits["main"]}, "composer.json")
+	if err != nil {
+		t.Fatalf("ReadFiles() returned error: %v", err)
+	}
+	if len(files) != 2 || string(files[commits["v1.0.0"]]) != `{"name": "acme/lib"}` {
+		t.Errorf("ReadFiles() = %q, want composer.json of main and v1.0.0 only", files)
+	}
+
+	dest := filepath.Join(t.TempDir(), "lib.zip")
+	if err := repo.Archive(commits["main"], "lib/", dest); err != nil {
+		t.Fatalf("Archive() returned error: %v", err)
+	}
+	archive, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var paths []string
+	for _, f := range archive.File {
+		paths = append(paths, f.Name)
+	}
+	sort.Strings(paths)
+	if want := []string{"lib/", "lib/README", "lib/composer.json"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("archive holds %v, want %v", paths, want)
+	}
+
+	if _, err := Mirror(c, url, true); err != nil {
+		t.Errorf("Mirror() offline after cloning returned error: %v", err)
+	}
+}
+
+func TestRepository_Checkout(t *testing.T) {
+	url := newBareRepository(t)
+	repo, err := Mirror(cache.New(t.TempDir()), url, false)
+	if err != nil {
+		t.Fatalf("Mirror() returned error: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "lib")
+	if err := repo.Checkout("v1.0.0", dest); err != nil {
+		t.Fatalf("Checkout() returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "README")); !os.IsNotExist(err) {
+		t.Error("checkout of v1.0.0 holds README, added by a later commit")
+	}
+	if head, err := Head(dest); err != nil || head.Name != "v1.0.0" {
+		t.Errorf("Head() = %+v, %v, want v1.0.0 checked out", head, err)
+	}
+
+	out, err := exec.Command("git", "-C", dest, "remote", "get-url", "origin").Output()
+	if err != nil || string(out) != url+"\n" {
+		t.Errorf("origin = %q, %v, want %s", out, err, url)
+	}
+}
+
+func TestRepository_MaliciousRef(t *testing.T) {
+	repo, err := Mirror(cache.New(t.TempDir()), newBareRepository(t), false)
+	if err != nil {
+		t.Fatalf("Mirror() returned error: %v", err)
+	}
+
+	dir := t.TempDir()
+	evil := filepath.Join(dir, "evil")
+	for _, ref := range []string{"--output=" + evil, "-h", "", "main..v1.0.0", "HEAD@{1}", "a b"} {
+		if err := repo.Archive(ref, "lib/", filepath.Join(dir, "lib.zip")); err == nil {
+			t.Errorf("Archive(%q) expected an error", ref)
+		}
+		if err := repo.Checkout(ref, filepath.Join(dir, "checkout")); err == nil {
+			t.Errorf("Checkout(%q) expected an error", ref)
+		}
+	}
+	if _, err := os.Stat(evil); !os.IsNotExist(err) {
+		t.Error("a ref passed as an option wrote a file")
+	}
+
+	if _, err := Mirror(cache.New(t.TempDir()), "--upload-pack=touch "+evil, false); err == nil {
+		t.Error("Mirror() of a URL starting with a dash expected an error")
+	}
+	if _, err := os.Stat(evil); !os.IsNotExist(err) {
+		t.Error("a URL passed as an option ran a command")
+	}
+}
+
+func TestHead(t *testing.T) {
+	bare := newBareRepository(t)
+	work := filepath.Join(t.TempDir(), "work")
+	gitRun(t, filepath.Dir(work), "clone", "--quiet", "--branch", "main", bare, work)
+
+	head, err := Head(work)
+	if err != nil {
+		t.Fatalf("Head() returned error: %v", err)
+	}
+	if head.Name != "main" || head.Tag || len(head.Commit) != 40 {
+		t.Errorf("Head() = %+v, want the main branch", head)
+	}
+
+	gitRun(t, work, "checkout", "--quiet", "v1.0.0")
+	if head, err := Head(work); err != nil || head.Name != "v1.0.0" || !head.Tag {
+		t.Errorf("Head() = %+v, %v, want the v1.0.0 tag", head, err)
+	}
+
+	if _, err := Head(t.TempDir()); err == nil {
+		t.Error("Head() outside a repository expected an error")
+	}
+}